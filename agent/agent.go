@@ -19,14 +19,19 @@ import (
 	"time"
 
 	"github.com/subutai-io/agent/agent/alert"
+	"github.com/subutai-io/agent/agent/bus"
 	"github.com/subutai-io/agent/agent/connect"
 	"github.com/subutai-io/agent/agent/container"
 	"github.com/subutai-io/agent/agent/discovery"
 	"github.com/subutai-io/agent/agent/executer"
+	"github.com/subutai-io/agent/agent/health"
 	"github.com/subutai-io/agent/agent/logger"
 	"github.com/subutai-io/agent/agent/monitor"
+	"github.com/subutai-io/agent/agent/registry"
 	"github.com/subutai-io/agent/agent/utils"
+	"github.com/subutai-io/agent/cli"
 	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/lib/event"
 	"github.com/subutai-io/agent/lib/gpg"
 	"github.com/subutai-io/agent/lib/net"
 	"github.com/subutai-io/agent/log"
@@ -48,6 +53,7 @@ type heartbeat struct {
 	Instance   string                `json:"instance"`
 	Containers []container.Container `json:"containers,omitempty"`
 	Alert      []alert.Load          `json:"alert,omitempty"`
+	Events     []event.Event         `json:"events,omitempty"`
 }
 
 var (
@@ -86,8 +92,13 @@ func Start() {
 	go monitor.Collect()
 	go connectionMonitor()
 	go alert.Processing()
+	go health.Monitor()
 	go logger.SyslogServer()
 	go restoreContainers()
+	go container.Reaper(cli.Destroy)
+	go bus.Monitor()
+	go pushEvents()
+	go registry.Serve()
 
 	/**
 	This routine does best effort to stop RUNNING containers on a custom signal (SIGUSR1)
@@ -145,6 +156,24 @@ func restoreContainers() {
 	}
 }
 
+// pushEvents sends heartbeat with pending events as soon as new events appear, respecting heartbeat rate limit
+func pushEvents() {
+	events := bus.Subscribe()
+	for range events {
+		mutex.Lock()
+		wait := time.Second*5 - time.Since(lastHeartbeatTime)
+		mutex.Unlock()
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+		// events received while waiting are sent in the same heartbeat
+		for len(events) > 0 {
+			<-events
+		}
+		sendHeartbeat()
+	}
+}
+
 func checkSS() (status bool) {
 	resp, err := client.Get("https://" + config.Management.Host + ":8443/rest/v1/peer/inited")
 	if err == nil {
@@ -203,6 +232,7 @@ func sendHeartbeat() bool {
 	}
 
 	pool = container.Active(false)
+	events := event.Pending()
 	res := response{Beat: heartbeat{
 		Type:       "HEARTBEAT",
 		Hostname:   hostname,
@@ -212,6 +242,7 @@ func sendHeartbeat() bool {
 		Instance:   instanceType,
 		Containers: alert.Quota(pool),
 		Alert:      alert.Current(pool),
+		Events:     events,
 	}}
 	jbeat, err := json.Marshal(&res)
 	log.Check(log.WarnLevel, "Marshaling heartbeat JSON", err)
@@ -230,6 +261,7 @@ func sendHeartbeat() bool {
 			defer utils.Close(resp)
 
 			if resp.StatusCode == http.StatusAccepted {
+				event.Delivered(events)
 				return true
 			}
 		}
@@ -4,7 +4,7 @@ package alert
 import (
 	"bufio"
 	"bytes"
-	"io/ioutil"
+	"fmt"
 	"os"
 	"os/exec"
 	"runtime"
@@ -14,7 +14,9 @@ import (
 
 	"github.com/subutai-io/agent/agent/container"
 	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/lib/cgroup"
 	cont "github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/lib/event"
 )
 
 type values struct {
@@ -22,6 +24,11 @@ type values struct {
 	Quota   int `json:"quota,omitempty"`
 }
 
+type ioValues struct {
+	Current int               `json:"current,omitempty"`
+	Quota   container.IOQuota `json:"quota"`
+}
+
 type hdd struct {
 	Partition string `json:"partition"`
 	Current   int    `json:"current"`
@@ -30,25 +37,22 @@ type hdd struct {
 
 //Load describes container usage stats. If alert active for this container the Management server receives this data.
 type Load struct {
-	Container string  `json:"id,omitempty"`
-	CPU       *values `json:"cpu,omitempty"`
-	RAM       *values `json:"ram,omitempty"`
-	Disk      []hdd   `json:"hdd,omitempty"`
+	Container string    `json:"id,omitempty"`
+	CPU       *values   `json:"cpu,omitempty"`
+	RAM       *values   `json:"ram,omitempty"`
+	Disk      []hdd     `json:"hdd,omitempty"`
+	IO        *ioValues `json:"io,omitempty"`
+	Pids      *values   `json:"pids,omitempty"`
 }
 
 var (
-	cpu   = make(map[string][]int)
-	stats = make(map[string]Load)
+	cpu    = make(map[string][]int)
+	ioStat = make(map[string][]int)
+	oom    = make(map[string]int)
+	thr    = make(map[string][]int)
+	stats  = make(map[string]Load)
 )
 
-func read(path string) (int, error) {
-	out, err := ioutil.ReadFile(path)
-	if err != nil {
-		return -1, err
-	}
-	return strconv.Atoi(strings.TrimSpace(string(out)))
-}
-
 func id() (list map[string]string) {
 	list = map[string]string{}
 	out, err := exec.Command("btrfs", "subvolume", "list", config.Agent.LxcPrefix).Output()
@@ -73,58 +77,33 @@ func stat() string {
 	return string(out)
 }
 
-func ramMax() (int, error) {
-	file, err := os.Open("/sys/fs/cgroup/memory/memory.stat")
-	if err != nil {
-		return 0, err
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(bufio.NewReader(file))
-	for scanner.Scan() {
-		line := strings.Fields(scanner.Text())
-		if len(line) > 1 && line[0] == "hierarchical_memory_limit" {
-			return strconv.Atoi(strings.TrimSpace(line[1]))
-		}
-	}
-	return 0, nil
-}
-
-func ramQuota(cont string) []int {
-	u, err := read("/sys/fs/cgroup/memory/lxc/" + cont + "/memory.usage_in_bytes")
+func ramQuota(name string) []int {
+	u, err := cgroup.MemoryUsage(name)
 	if err != nil {
 		return nil
 	}
 
-	l, err := read("/sys/fs/cgroup/memory/lxc/" + cont + "/memory.limit_in_bytes")
+	l, err := cgroup.MemoryLimit(name)
 	if err != nil {
 		return nil
 	}
 
-	var ramUsage = []int{0, l / 1024 / 1024}
-	if l != 0 {
-		ramUsage[0] = u * 100 / l
-	}
-
-	if mlimit, err := ramMax(); err == nil && l == mlimit {
-		ramUsage[1] = 0
+	var ramUsage = []int{0, 0}
+	if l > 0 {
+		ramUsage = []int{u * 100 / l, l / 1024 / 1024}
 	}
 	return ramUsage
 }
 
 func quotaCPU(name string) int {
-	cfsPeriod := 100000
-	cfsQuotaUs, err := ioutil.ReadFile("/sys/fs/cgroup/cpu,cpuacct/lxc/" + name + "/cpu.cfs_quota_us")
-	if err != nil {
+	quota, period, err := cgroup.CPULimit(name)
+	if err != nil || period == 0 {
 		return -1
 	}
-
-	quota, err := strconv.Atoi(strings.TrimSpace(string(cfsQuotaUs)))
-	if err != nil {
-		return -1
+	if quota < 0 {
+		return 0
 	}
-
-	return quota * 100 / cfsPeriod / runtime.NumCPU()
+	return quota * 100 / period / runtime.NumCPU()
 }
 
 func cpuLoad(cont string) []int {
@@ -132,22 +111,7 @@ func cpuLoad(cont string) []int {
 	if len(cpu[cont]) == 0 {
 		cpu[cont] = []int{0, 0, 0, 0, 0}
 	}
-	ticks, err := ioutil.ReadFile("/sys/fs/cgroup/cpuacct/lxc/" + cont + "/cpuacct.stat")
-	if err != nil {
-		return avgload
-	}
-
-	tick := strings.Fields(string(ticks))
-	if len(tick) != 4 {
-		return avgload
-	}
-
-	usertick, err := strconv.Atoi(tick[1])
-	if err != nil {
-		return avgload
-	}
-
-	systick, err := strconv.Atoi(tick[3])
+	usertick, systick, err := cgroup.CPUStat(cont)
 	if err != nil {
 		return avgload
 	}
@@ -191,6 +155,78 @@ func diskQuota(mountid, diskMap string) []int {
 	return diskUsage
 }
 
+// ioLoad returns block I/O limits of the container and usage in percents of the most utilized limit since previous call
+func ioLoad(cont string) *ioValues {
+	if _, err := os.Stat(cgroup.Path("blkio", cont)); err != nil {
+		return nil
+	}
+	limits := cgroup.IOLimits(cont, "")
+	load := &ioValues{Quota: container.IOQuota{
+		ReadBps:   limits["rbps"],
+		WriteBps:  limits["wbps"],
+		ReadIops:  limits["riops"],
+		WriteIops: limits["wiops"],
+	}}
+
+	rbytes, wbytes, rops, wops := cgroup.IOStat(cont)
+	now := int(time.Now().Unix())
+	sample := []int{rbytes, wbytes, rops, wops, now}
+	prev, ok := ioStat[cont]
+	ioStat[cont] = sample
+	if !ok || now <= prev[4] {
+		return load
+	}
+
+	for i, limit := range []int{load.Quota.ReadBps, load.Quota.WriteBps, load.Quota.ReadIops, load.Quota.WriteIops} {
+		if limit > 0 {
+			rate := float64(sample[i]-prev[i]) / float64(now-prev[4])
+			if usage := int(rate * 100 / float64(limit)); usage > load.Current {
+				load.Current = usage
+			}
+		}
+	}
+	return load
+}
+
+// pidsLoad returns processes limit of the container and current number of processes in percents of the limit
+func pidsLoad(cont string) *values {
+	current, limit, err := cgroup.Pids(cont)
+	if err != nil {
+		return nil
+	}
+	if limit <= 0 {
+		// "max" value means no limit
+		return &values{}
+	}
+	return &values{Current: current * 100 / limit, Quota: limit}
+}
+
+// detectEvents records OOM kills and start of CPU throttling of the container since previous call.
+// Counters seen for the first time only set the baseline, so events are not repeated after daemon restart.
+func detectEvents(name string) {
+	if kills, err := cgroup.OOMKills(name); err == nil {
+		if prev, ok := oom[name]; ok && kills > prev {
+			event.Add(name, event.OOM, strconv.Itoa(kills-prev)+" process(es) killed by OOM killer, memory limit "+strconv.Itoa(cont.QuotaRAM(name, ""))+" Mb")
+		}
+		oom[name] = kills
+	}
+
+	periods, throttled, usec, err := cgroup.CPUThrottling(name)
+	if err != nil {
+		return
+	}
+	// sample is number of periods, throttled periods, throttled time and flag of throttling during the previous interval
+	sample := []int{periods, throttled, usec, 0}
+	if prev, ok := thr[name]; ok && throttled > prev[1] {
+		sample[3] = 1
+		if prev[3] == 0 {
+			event.Add(name, event.Throttle, fmt.Sprintf("%d of %d periods throttled for %d ms, CPU quota %d%%",
+				throttled-prev[1], periods-prev[0], (usec-prev[2])/1000, cont.QuotaCPU(name, "")))
+		}
+	}
+	thr[name] = sample
+}
+
 //Processing works as a daemon, collecting information about containers stats and preparing list of active alerts.
 func Processing() {
 	for {
@@ -200,6 +236,17 @@ func Processing() {
 				delete(cpu, k)
 			}
 		}
+		for k := range ioStat {
+			if _, ok := stats[k]; !ok {
+				delete(ioStat, k)
+			}
+		}
+		for k := range oom {
+			if _, ok := stats[k]; !ok {
+				delete(oom, k)
+				delete(thr, k)
+			}
+		}
 		time.Sleep(time.Second * 30)
 	}
 }
@@ -209,31 +256,26 @@ func alertLoad() (load map[string]Load) {
 	diskMap := stat()
 	diskIDs := id()
 
-	files, err := ioutil.ReadDir("/sys/fs/cgroup/cpu/lxc/")
-	if err != nil {
-		return
-	}
-	for _, cont := range files {
-		if !cont.IsDir() {
-			continue
-		}
-
-		cpuValues := cpuLoad(cont.Name())
-		ramValues := ramQuota(cont.Name())
+	for _, name := range cgroup.Containers() {
+		detectEvents(name)
+		cpuValues := cpuLoad(name)
+		ramValues := ramQuota(name)
 
 		disk := []hdd{}
 		for _, v := range []string{"", "/rootfs", "/opt", "/var", "/home"} {
-			diskValues := diskQuota(diskIDs[cont.Name()+v], diskMap)
+			diskValues := diskQuota(diskIDs[name+v], diskMap)
 			if len(diskValues) > 1 {
 				disk = append(disk, hdd{Current: diskValues[0], Quota: diskValues[1], Partition: v})
 			}
 		}
 
 		if len(cpuValues) > 1 && len(ramValues) > 1 {
-			load[cont.Name()] = Load{
+			load[name] = Load{
 				CPU:  &values{Current: cpuValues[0], Quota: cpuValues[1]},
 				RAM:  &values{Current: ramValues[0], Quota: ramValues[1]},
 				Disk: disk,
+				IO:   ioLoad(name),
+				Pids: pidsLoad(name),
 			}
 		}
 	}
@@ -256,6 +298,16 @@ func Current(list []container.Container) []Load {
 			item.RAM = &values{Current: stats[v.Name].RAM.Current, Quota: stats[v.Name].RAM.Quota}
 		}
 
+		threshold, err = strconv.Atoi(cont.GetConfigItem(config.Agent.LxcPrefix+v.Name+"/config", "subutai.alert.io"))
+		if threshold > 0 && stats[v.Name].IO != nil && stats[v.Name].IO.Current > threshold && err == nil {
+			item.IO = &ioValues{Current: stats[v.Name].IO.Current, Quota: stats[v.Name].IO.Quota}
+		}
+
+		threshold, err = strconv.Atoi(cont.GetConfigItem(config.Agent.LxcPrefix+v.Name+"/config", "subutai.alert.pids"))
+		if threshold > 0 && stats[v.Name].Pids != nil && stats[v.Name].Pids.Current > threshold && err == nil {
+			item.Pids = &values{Current: stats[v.Name].Pids.Current, Quota: stats[v.Name].Pids.Quota}
+		}
+
 		for _, value := range stats[v.Name].Disk {
 			threshold, err = strconv.Atoi(cont.GetConfigItem(config.Agent.LxcPrefix+v.Name+"/config", "subutai.alert.disk."+value.Partition))
 			if threshold > 0 && value.Current > threshold && err == nil {
@@ -263,7 +315,7 @@ func Current(list []container.Container) []Load {
 			}
 		}
 
-		if item.CPU != nil || item.RAM != nil || len(item.Disk) > 0 {
+		if item.CPU != nil || item.RAM != nil || item.IO != nil || item.Pids != nil || len(item.Disk) > 0 {
 			item.Container = v.ID
 			loadList = append(loadList, item)
 		}
@@ -276,6 +328,13 @@ func Quota(list []container.Container) (output []container.Container) {
 		if c, ok := stats[v.Name]; ok {
 			v.Quota.CPU = c.CPU.Quota
 			v.Quota.RAM = c.RAM.Quota
+			if c.IO != nil && c.IO.Quota != (container.IOQuota{}) {
+				quota := c.IO.Quota
+				v.Quota.IO = &quota
+			}
+			if c.Pids != nil {
+				v.Quota.Pids = c.Pids.Quota
+			}
 			for _, value := range stats[v.Name].Disk {
 				switch value.Partition {
 				case "":
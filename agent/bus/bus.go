@@ -0,0 +1,98 @@
+// Package bus delivers container events recorded by CLI operations and daemon routines to subscribers inside the agent
+package bus
+
+import (
+	"sync"
+	"time"
+
+	cont "github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/lib/event"
+)
+
+var (
+	mutex       sync.Mutex
+	subscribers []chan event.Event
+)
+
+// Subscribe returns channel receiving new container events. Events are dropped for subscribers which do not keep up.
+func Subscribe() <-chan event.Event {
+	ch := make(chan event.Event, 100)
+	mutex.Lock()
+	subscribers = append(subscribers, ch)
+	mutex.Unlock()
+	return ch
+}
+
+func publish(e event.Event) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, ch := range subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Monitor works as a daemon, publishing events recorded in the database and watching LXC states of the containers.
+// State changes which are not recorded by CLI operations, e.g. container stopped from inside, are recorded as lifecycle events.
+// A change is recorded only if it is seen on two consecutive checks, so operations in progress have time to record their own events.
+func Monitor() {
+	last := event.Last()
+	lastType := make(map[string]string)
+	states := make(map[string]string)
+	pending := make(map[string]string)
+	for {
+		for _, e := range event.List("", last) {
+			last = e.ID
+			lastType[e.Container] = e.Type
+			publish(e)
+		}
+
+		seen := make(map[string]bool)
+		for _, name := range cont.Containers() {
+			seen[name] = true
+			state := cont.State(name)
+			prev, ok := states[name]
+			if !ok || state == prev {
+				states[name] = state
+				delete(pending, name)
+				continue
+			}
+			if pending[name] != state {
+				pending[name] = state
+				continue
+			}
+			if kind := transition(prev, state); kind != "" && lastType[name] != kind {
+				event.Add(name, kind, "detected by state monitor, "+prev+" -> "+state)
+			}
+			states[name] = state
+			delete(pending, name)
+		}
+		for name := range states {
+			if !seen[name] {
+				delete(states, name)
+				delete(pending, name)
+				delete(lastType, name)
+			}
+		}
+
+		time.Sleep(time.Second * 2)
+	}
+}
+
+// transition returns lifecycle event type of the container state change
+func transition(from, to string) string {
+	switch to {
+	case "RUNNING":
+		if from == "FROZEN" {
+			return event.Unfreeze
+		}
+		return event.Start
+	case "STOPPED":
+		return event.Stop
+	case "FROZEN":
+		return event.Freeze
+	}
+	return ""
+}
@@ -27,28 +27,43 @@ var (
 
 // Container describes Subutai container with all required options for the Management server.
 type Container struct {
-	ID         string        `json:"id"`
-	Name       string        `json:"name"`
-	Hostname   string        `json:"hostname"`
-	Status     string        `json:"status,omitempty"`
-	Arch       string        `json:"arch"`
-	Interfaces []utils.Iface `json:"interfaces"`
-	Parent     string        `json:"templateName,omitempty"`
-	Vlan       string        `json:"vlan,omitempty"`
-	EnvId      string        `json:"environmentId,omitempty"`
-	Pk         string        `json:"publicKey,omitempty"`
-	Quota      Quota         `json:"quota,omitempty"`
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Hostname   string            `json:"hostname"`
+	Status     string            `json:"status,omitempty"`
+	Arch       string            `json:"arch"`
+	Interfaces []utils.Iface     `json:"interfaces"`
+	Parent     string            `json:"templateName,omitempty"`
+	Vlan       string            `json:"vlan,omitempty"`
+	EnvId      string            `json:"environmentId,omitempty"`
+	Pk         string            `json:"publicKey,omitempty"`
+	Health     string            `json:"health,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Quota      Quota             `json:"quota,omitempty"`
+	ExpiresAt  string            `json:"expiresAt,omitempty"`
+	Ephemeral  bool              `json:"ephemeral,omitempty"`
+	Security   *cont.Profile     `json:"security,omitempty"`
 }
 
 //Quota describes container quota value.
 type Quota struct {
-	CPU  int `json:"cpu,omitempty"`
-	RAM  int `json:"ram,omitempty"`
-	Disk int `json:"disk,omitempty"`
-	Root int `json:"root,omitempty"`
-	Home int `json:"home,omitempty"`
-	Opt  int `json:"opt,omitempty"`
-	Var  int `json:"var,omitempty"`
+	CPU  int      `json:"cpu,omitempty"`
+	RAM  int      `json:"ram,omitempty"`
+	Disk int      `json:"disk,omitempty"`
+	Root int      `json:"root,omitempty"`
+	Home int      `json:"home,omitempty"`
+	Opt  int      `json:"opt,omitempty"`
+	Var  int      `json:"var,omitempty"`
+	IO   *IOQuota `json:"io,omitempty"`
+	Pids int      `json:"pids,omitempty"`
+}
+
+//IOQuota describes container block I/O limits in bytes and operations per second.
+type IOQuota struct {
+	ReadBps   int `json:"readBps,omitempty"`
+	WriteBps  int `json:"writeBps,omitempty"`
+	ReadIops  int `json:"readIops,omitempty"`
+	WriteIops int `json:"writeIops,omitempty"`
 }
 
 func init() {
@@ -122,6 +137,22 @@ func Active(details bool) []Container {
 
 		container.Interfaces = interfaces(c, ip)
 
+		if container.Status == "RUNNING" {
+			container.Health = meta["health"]
+		}
+
+		if labels := bolt.ContainerLabels(c); len(labels) > 0 {
+			container.Labels = labels
+		}
+
+		if expires, err := strconv.ParseInt(meta["expires"], 10, 64); err == nil && expires > 0 {
+			container.ExpiresAt = time.Unix(expires, 0).UTC().Format(time.RFC3339)
+		}
+		container.Ephemeral = meta["ephemeral"] == "true"
+
+		security := cont.Security(c)
+		container.Security = &security
+
 		//cacheable properties>>>
 
 		container.ID = getFromCacheOrCalculate(c+"_fingerprint", func() string {
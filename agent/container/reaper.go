@@ -0,0 +1,70 @@
+package container
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/subutai-io/agent/db"
+	"github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/lib/event"
+	"github.com/subutai-io/agent/log"
+)
+
+// Reaper works as a daemon, destroying containers whose TTL expired and ephemeral containers which stopped.
+// Ephemeral container is destroyed only if it stays stopped on two consecutive checks, so operations which restart containers, e.g. rename or snapshot rollback, can complete.
+// Containers are removed with the destroy function, which releases port mappings, proxy and network resources as well.
+// Expiration event is recorded once per container, failed destroy is retried on the next checks.
+func Reaper(destroy func(name string) error) {
+	stopped := make(map[string]bool)
+	failed := make(map[string]bool)
+	for {
+		bolt, err := db.New()
+		if log.Check(log.WarnLevel, "Opening database", err) {
+			time.Sleep(time.Second * 10)
+			continue
+		}
+		expired := make(map[string]string)
+		seen := make(map[string]bool)
+		exist := make(map[string]bool)
+		for _, name := range container.Containers() {
+			exist[name] = true
+			meta := bolt.ContainerByName(name)
+			if sec, err := strconv.ParseInt(meta["expires"], 10, 64); err == nil && sec > 0 && time.Now().Unix() >= sec {
+				expired[name] = "TTL expired at " + time.Unix(sec, 0).Format(time.RFC3339)
+				continue
+			}
+			if meta["ephemeral"] != "true" || container.State(name) != "STOPPED" {
+				continue
+			}
+			if stopped[name] {
+				expired[name] = "ephemeral container stopped"
+			}
+			seen[name] = true
+		}
+		log.Check(log.WarnLevel, "Closing database", bolt.Close())
+		stopped = seen
+		for name := range failed {
+			if !exist[name] {
+				delete(failed, name)
+			}
+		}
+
+		for name, reason := range expired {
+			if !failed[name] {
+				log.Info("Destroying " + name + ", " + reason)
+				event.Add(name, event.Expire, reason)
+			}
+			if err := destroy(name); err != nil {
+				if !failed[name] {
+					log.Warn("Destroying " + name + ": " + err.Error())
+				}
+				failed[name] = true
+			} else {
+				delete(failed, name)
+			}
+			delete(stopped, name)
+		}
+
+		time.Sleep(time.Second * 10)
+	}
+}
@@ -1,9 +1,12 @@
 package container
 
 import (
+	"errors"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/subutai-io/agent/agent/health"
 	"github.com/subutai-io/agent/config"
 	"github.com/subutai-io/agent/db"
 	"github.com/subutai-io/agent/lib/container"
@@ -21,20 +24,56 @@ func compat() {
 	}
 }
 
+// dependencyWait limits the time the restore cycle waits for health of a single dependency,
+// containers whose dependencies are still starting are postponed to the next cycle
+const dependencyWait = 10 * time.Second
+
 // StateRestore checks container state and starting or stopping containers if required.
+// Containers are started in order of their start dependencies: "subutai.start.order" priority and "subutai.start.after" list.
+// Before starting the container, the daemon waits for its dependencies to pass health checks, if they have any,
+// and for "subutai.start.delay" seconds after the dependencies start. Containers whose dependencies failed or are still starting
+// are not started and are retried on the next restore cycle; cyclic dependencies are reported and such containers are started last.
 func StateRestore(canRestore *bool) {
 	compat()
 
 	bolt, err := db.New()
 	log.Check(log.WarnLevel, "Opening database", err)
 	active := bolt.ContainerByKey("state", "RUNNING")
+	// ephemeral containers are destroyed by the reaper once stopped, so they are never restarted
+	ephemeral := bolt.ContainerByKey("ephemeral", "true")
 	log.Check(log.WarnLevel, "Closing database", bolt.Close())
-
-	for _, v := range active {
-		if !*canRestore {
-			return
+	for i := len(active) - 1; i >= 0; i-- {
+		if stringInList(active[i], ephemeral) {
+			active = append(active[:i], active[i+1:]...)
 		}
-		if container.State(v) != "RUNNING" {
+	}
+
+	levels, cycle := container.Order(active)
+	if len(cycle) > 0 {
+		log.Warn("Cyclic start dependencies between " + strings.Join(cycle, ", ") + ", starting them last")
+		levels = append(levels, cycle)
+	}
+
+	// failed containers are not started in this cycle, postponed ones are marked with health.ErrPending
+	failed := make(map[string]error)
+	for _, level := range levels {
+		delay := 0
+		for _, v := range level {
+			if !*canRestore {
+				return
+			}
+			if container.State(v) == "RUNNING" {
+				continue
+			}
+			if err := dependencies(v, active, cycle, failed); err == health.ErrPending {
+				log.Debug("Container " + v + " is postponed until its dependencies start")
+				failed[v] = err
+				continue
+			} else if err != nil {
+				log.Warn("Container " + v + " is not started: " + err.Error())
+				failed[v] = err
+				continue
+			}
 			log.Debug("Starting container " + v)
 			startErr := container.Start(v)
 			for i := 0; i < 5 && startErr != nil; i++ {
@@ -46,8 +85,47 @@ func StateRestore(canRestore *bool) {
 				startErr = container.Start(v)
 			}
 			if startErr != nil {
+				log.Warn("Container " + v + " start failed")
+				failed[v] = startErr
 				container.AddMetadata(v, map[string]string{"state": "STOPPED"})
+			} else if d := container.StartDelay(v); d > delay {
+				delay = d
 			}
 		}
+		time.Sleep(time.Second * time.Duration(delay))
+	}
+}
+
+// dependencies checks that containers which should be started before the specified one are running and healthy
+func dependencies(name string, active, cycle []string, failed map[string]error) error {
+	for _, dep := range container.StartAfter(name) {
+		if !stringInList(dep, active) {
+			continue
+		}
+		if err, ok := failed[dep]; ok && err == health.ErrPending {
+			return err
+		} else if ok {
+			return errors.New("dependency " + dep + " failed")
+		}
+		if stringInList(name, cycle) && stringInList(dep, cycle) {
+			continue
+		}
+		if err := health.Wait(dep, dependencyWait); err == health.ErrPending {
+			// other dependents of the starting container don't wait for it again in this cycle
+			failed[dep] = err
+			return err
+		} else if err != nil {
+			return errors.New("dependency " + err.Error())
+		}
+	}
+	return nil
+}
+
+func stringInList(s string, list []string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
 	}
+	return false
 }
@@ -4,6 +4,7 @@ package executer
 import (
 	"bufio"
 	"bytes"
+	"io"
 	"os"
 	"os/exec"
 	"os/user"
@@ -14,6 +15,7 @@ import (
 	"time"
 	"unsafe"
 
+	"golang.org/x/sys/unix"
 	"gopkg.in/lxc/go-lxc.v2"
 
 	"github.com/subutai-io/agent/agent/container"
@@ -256,31 +258,16 @@ func AttachContainer(name string, req RequestOptions, outCh chan<- ResponseOptio
 	}
 	defer rep.Close()
 
-	opts := lxc.DefaultAttachOptions
-	opts.UID, opts.GID = container.Credentials(req.RunAs, name)
+	opts := attachOptions(name, req)
 	opts.StdoutFd = wop.Fd()
 	opts.StderrFd = wep.Fd()
-	opts.Cwd = req.WorkingDir
-	opts.EnvToKeep = []string{"TERM", "USER", "LS_COLORS"}
-	opts.ClearEnv = true
 
 	var exitCode int
-	var cmd bytes.Buffer
+	cmd := attachCommand(req)
 
-	_, err = cmd.WriteString(req.Command)
-	if err != nil {
-		return err
-	}
-	for _, a := range req.Args {
-		_, err = cmd.WriteString(a + " ")
-		if err != nil {
-			return err
-		}
-	}
-
-	log.Debug("Executing command in container " + name + ":" + cmd.String())
+	log.Debug("Executing command in container " + name + ":" + cmd[len(cmd)-1])
 	go func() {
-		exitCode, err = c.RunCommandStatus([]string{"timeout", strconv.Itoa(req.Timeout), "/bin/bash", "-c", cmd.String()}, opts)
+		exitCode, err = c.RunCommandStatus(cmd, opts)
 		log.Check(log.DebugLevel, "Executing command inside container", err)
 		log.Check(log.DebugLevel, "Closing standard output", wop.Close())
 		log.Check(log.DebugLevel, "Closing error output", wep.Close())
@@ -297,13 +284,139 @@ func AttachContainer(name string, req RequestOptions, outCh chan<- ResponseOptio
 		response.Type = "EXECUTE_RESPONSE"
 		response.ExitCode = strconv.Itoa(exitCode)
 	} else {
-		if exitCode/256 == 124 {
+		if exitStatus(exitCode) == 124 {
 			response.Type = "EXECUTE_TIMEOUT"
 		}
-		response.ExitCode = strconv.Itoa(exitCode / 256)
+		response.ExitCode = strconv.Itoa(exitStatus(exitCode))
 	}
 
 	outCh <- response
 
 	return nil
 }
+
+// AttachStream executes request inside Container host connecting command directly to passed files
+// and returns exit code of the command. Exit code 124 means that command was terminated by timeout, 128+N that it was killed by signal N.
+func AttachStream(name string, req RequestOptions, stdin, stdout, stderr *os.File) (int, error) {
+	return attachFiles(name, req, attachCommand(req), stdin, stdout, stderr)
+}
+
+// AttachTerminal executes request inside Container host with pseudo-terminal allocated for the command, so interactive programs may be run.
+// The terminal becomes controlling terminal of the command session with setsid utility of the container, input of the calling terminal is switched to raw mode while the command runs
+// and its size is passed to the command. It returns exit code of the command as AttachStream does.
+func AttachTerminal(name string, req RequestOptions, stdin, stdout *os.File) (int, error) {
+	master, slave, err := openPty()
+	if err != nil {
+		return -1, err
+	}
+	defer master.Close()
+
+	if size, err := unix.IoctlGetWinsize(int(stdout.Fd()), unix.TIOCGWINSZ); err == nil {
+		log.Check(log.DebugLevel, "Setting terminal size", unix.IoctlSetWinsize(int(slave.Fd()), unix.TIOCSWINSZ, size))
+	}
+	if state, err := unix.IoctlGetTermios(int(stdin.Fd()), unix.TCGETS); err == nil {
+		raw := *state
+		raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+		raw.Oflag &^= unix.OPOST
+		raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		raw.Cflag &^= unix.CSIZE | unix.PARENB
+		raw.Cflag |= unix.CS8
+		raw.Cc[unix.VMIN], raw.Cc[unix.VTIME] = 1, 0
+		if !log.Check(log.DebugLevel, "Setting raw terminal mode", unix.IoctlSetTermios(int(stdin.Fd()), unix.TCSETS, &raw)) {
+			defer unix.IoctlSetTermios(int(stdin.Fd()), unix.TCSETS, state)
+		}
+	}
+
+	go io.Copy(master, stdin)
+	done := make(chan struct{})
+	go func() {
+		io.Copy(stdout, master)
+		close(done)
+	}()
+
+	cmd := attachCommand(req)
+	cmd = append([]string{cmd[0], "--foreground", cmd[1], "setsid", "-c"}, cmd[2:]...)
+	code, err := attachFiles(name, req, cmd, slave, slave, slave)
+	slave.Close()
+	// output is read until the last descriptor of the terminal is closed, background processes of the command may keep it open
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+	return code, err
+}
+
+// attachFiles runs the command inside the container connected to passed files and returns its exit code
+func attachFiles(name string, req RequestOptions, cmd []string, stdin, stdout, stderr *os.File) (int, error) {
+	c, err := lxc.NewContainer(name, config.Agent.LxcPrefix)
+	if err != nil {
+		return -1, err
+	}
+	defer lxc.Release(c)
+
+	opts := attachOptions(name, req)
+	opts.StdinFd = stdin.Fd()
+	opts.StdoutFd = stdout.Fd()
+	opts.StderrFd = stderr.Fd()
+
+	log.Debug("Executing command in container " + name + ":" + cmd[len(cmd)-1])
+	exitCode, err := c.RunCommandStatus(cmd, opts)
+	if err != nil {
+		return -1, err
+	}
+	return exitStatus(exitCode), nil
+}
+
+// openPty allocates new pseudo-terminal and returns its master and slave sides
+func openPty() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	n, err := unix.IoctlGetInt(int(master.Fd()), unix.TIOCGPTN)
+	if err == nil {
+		err = unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0)
+	}
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	slave, err := os.OpenFile("/dev/pts/"+strconv.Itoa(n), os.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// exitStatus converts wait status of the command to its exit code, commands killed by signal get 128+signal code as in shell
+func exitStatus(status int) int {
+	ws := syscall.WaitStatus(status)
+	if ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ws.ExitStatus()
+}
+
+// attachOptions prepares user, working directory and environment for command execution inside container
+func attachOptions(name string, req RequestOptions) lxc.AttachOptions {
+	opts := lxc.DefaultAttachOptions
+	opts.UID, opts.GID = container.Credentials(req.RunAs, name)
+	opts.Cwd = req.WorkingDir
+	opts.EnvToKeep = []string{"TERM", "USER", "LS_COLORS"}
+	opts.ClearEnv = true
+	for k, v := range req.Environment {
+		opts.Env = append(opts.Env, k+"="+v)
+	}
+	return opts
+}
+
+// attachCommand wraps requested command with bash and timeout utility
+func attachCommand(req RequestOptions) []string {
+	var cmd bytes.Buffer
+	cmd.WriteString(req.Command)
+	for _, a := range req.Args {
+		cmd.WriteString(a + " ")
+	}
+	return []string{"timeout", strconv.Itoa(req.Timeout), "/bin/bash", "-c", cmd.String()}
+}
@@ -0,0 +1,309 @@
+// Package health evaluates container health checks and feeds results into restart policies and port mapping backends
+package health
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/db"
+	cont "github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/log"
+
+	"gopkg.in/lxc/go-lxc.v2"
+)
+
+// Health check states reported to the Management server.
+const (
+	Starting  = "starting"
+	Healthy   = "healthy"
+	Unhealthy = "unhealthy"
+)
+
+// Check describes health check options of the container. Options are stored in the container config as subutai.health.* keys.
+type Check struct {
+	Type     string
+	Target   string
+	Interval int
+	Timeout  int
+	Retries  int
+	Restart  string
+}
+
+type state struct {
+	status   string
+	failures int
+	next     time.Time
+	running  bool
+}
+
+var (
+	mutex  sync.Mutex
+	checks = make(map[string]*state)
+)
+
+// ErrPending is returned by Wait if the container is still starting when the wait timeout expires
+var ErrPending = errors.New("health check is pending")
+
+// Get reads health check options from the container config. Empty Type means that container has no health check.
+func Get(name string) Check {
+	conf := config.Agent.LxcPrefix + name + "/config"
+	check := Check{
+		Type:     cont.GetConfigItem(conf, "subutai.health.type"),
+		Target:   cont.GetConfigItem(conf, "subutai.health.check"),
+		Interval: 30,
+		Timeout:  5,
+		Retries:  3,
+		Restart:  cont.GetConfigItem(conf, "subutai.restart"),
+	}
+	if v, err := strconv.Atoi(cont.GetConfigItem(conf, "subutai.health.interval")); err == nil && v > 0 {
+		check.Interval = v
+	}
+	if v, err := strconv.Atoi(cont.GetConfigItem(conf, "subutai.health.timeout")); err == nil && v > 0 {
+		check.Timeout = v
+	}
+	if v, err := strconv.Atoi(cont.GetConfigItem(conf, "subutai.health.retries")); err == nil && v > 0 {
+		check.Retries = v
+	}
+	return check
+}
+
+// Status returns last known health status of the container or empty string if container has no health check.
+func Status(name string) string {
+	bolt, err := db.New()
+	if log.Check(log.WarnLevel, "Opening database", err) {
+		return ""
+	}
+	defer bolt.Close()
+	return bolt.ContainerByName(name)["health"]
+}
+
+// Wait blocks until the container passes its health check, but no longer than the timeout. Containers without health check are considered ready immediately.
+// Error is returned if the container becomes unhealthy or does not become healthy in time enough for all check retries,
+// ErrPending is returned if the timeout expires earlier.
+func Wait(name string, timeout time.Duration) error {
+	check := Get(name)
+	if check.Type == "" {
+		return nil
+	}
+	deadline := time.Now().Add(time.Second * time.Duration(check.Interval*(check.Retries+1)+check.Timeout))
+	limit := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if time.Now().After(limit) {
+			return ErrPending
+		}
+		mutex.Lock()
+		status := ""
+		if s, ok := checks[name]; ok {
+			status = s.status
+		}
+		mutex.Unlock()
+
+		switch status {
+		case Healthy:
+			return nil
+		case Unhealthy:
+			return errors.New(name + " is unhealthy")
+		}
+		time.Sleep(time.Second)
+	}
+	return errors.New(name + " did not become healthy in time")
+}
+
+// Monitor works as a daemon, running health checks of the running containers according to their intervals.
+func Monitor() {
+	for {
+		seen := make(map[string]bool)
+		for _, name := range cont.Containers() {
+			check := Get(name)
+			if check.Type == "" || cont.State(name) != "RUNNING" {
+				continue
+			}
+			seen[name] = true
+
+			mutex.Lock()
+			s, ok := checks[name]
+			if !ok {
+				s = &state{status: Starting, next: time.Now()}
+				checks[name] = s
+				save(name, Starting)
+			}
+			if !s.running && time.Now().After(s.next) {
+				s.running = true
+				go evaluate(name, check, s)
+			}
+			mutex.Unlock()
+		}
+
+		mutex.Lock()
+		for name, s := range checks {
+			if !seen[name] && !s.running {
+				delete(checks, name)
+				save(name, "")
+			}
+		}
+		mutex.Unlock()
+
+		time.Sleep(time.Second * 5)
+	}
+}
+
+func evaluate(name string, check Check, s *state) {
+	err := run(name, check)
+
+	mutex.Lock()
+	s.running = false
+	s.next = time.Now().Add(time.Second * time.Duration(check.Interval))
+
+	status := s.status
+	if err == nil {
+		s.failures = 0
+		status = Healthy
+	} else {
+		s.failures++
+		log.Debug("Health check of " + name + " failed: " + err.Error())
+		if s.failures >= check.Retries {
+			status = Unhealthy
+		}
+	}
+
+	if status != s.status {
+		log.Info("Container " + name + " is " + status)
+		s.status = status
+		save(name, status)
+	}
+	restart := s.status == Unhealthy && check.Restart == "unhealthy"
+	if restart {
+		s.status = Starting
+		s.failures = 0
+		s.running = true
+	}
+	mutex.Unlock()
+
+	backends(name, status != Unhealthy)
+
+	if restart {
+		log.Info("Restarting unhealthy container " + name)
+		log.Check(log.WarnLevel, "Stopping container "+name, cont.Stop(name, false))
+		log.Check(log.WarnLevel, "Starting container "+name, cont.Start(name))
+		save(name, Starting)
+
+		mutex.Lock()
+		s.running = false
+		mutex.Unlock()
+	}
+}
+
+func run(name string, check Check) error {
+	timeout := time.Second * time.Duration(check.Timeout)
+
+	switch check.Type {
+	case "exec":
+		// timeout is enforced inside the container, so the attached process ends before the next check is started
+		out, err := cont.AttachExec(name, []string{"/bin/sh", "-c",
+			"timeout -s KILL " + strconv.Itoa(check.Timeout) + ` /bin/sh -c "$0" >/dev/null 2>&1 && echo OK`, check.Target})
+		if err == nil && (len(out) == 0 || out[len(out)-1] != "OK") {
+			err = errors.New("command failed or timed out")
+		}
+		return err
+	case "tcp":
+		conn, err := net.DialTimeout("tcp", address(name)+":"+check.Target, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case "http":
+		client := &http.Client{Timeout: timeout}
+		target := check.Target
+		if !strings.HasPrefix(target, "/") {
+			target = ":" + target
+		}
+		resp, err := client.Get("http://" + address(name) + target)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		ioutil.ReadAll(resp.Body)
+		if resp.StatusCode < 200 || resp.StatusCode > 399 {
+			return errors.New("HTTP status " + resp.Status)
+		}
+		return nil
+	}
+	return errors.New("Unsupported health check type " + check.Type)
+}
+
+func address(name string) string {
+	c, err := lxc.NewContainer(name, config.Agent.LxcPrefix)
+	if err != nil {
+		return ""
+	}
+	defer lxc.Release(c)
+
+	if ip, err := c.IPAddress("eth0"); err == nil && len(ip) > 0 {
+		return ip[0]
+	}
+	return ""
+}
+
+// save records health status of the container, containers destroyed or renamed meanwhile are skipped
+func save(name, status string) {
+	if !cont.IsContainer(name) {
+		return
+	}
+	bolt, err := db.New()
+	if log.Check(log.WarnLevel, "Opening database", err) {
+		return
+	}
+	log.Check(log.WarnLevel, "Saving health status", bolt.ContainerSet(name, "health", status))
+	log.Check(log.WarnLevel, "Closing database", bolt.Close())
+}
+
+// backends marks port mapping backends of the container as down in nginx upstreams while the container is unhealthy.
+func backends(name string, up bool) {
+	bolt, err := db.New()
+	if log.Check(log.WarnLevel, "Opening database", err) {
+		return
+	}
+	mapping := bolt.GetContainerMapping(name)
+	log.Check(log.WarnLevel, "Closing database", bolt.Close())
+
+	reload := false
+	for _, v := range mapping {
+		conf := config.Agent.DataPrefix + "nginx-includes/" + v["protocol"] + "/" + v["external"] + "-" + v["domain"] + ".conf"
+		f, err := ioutil.ReadFile(conf)
+		if err != nil {
+			continue
+		}
+		changed := false
+		lines := strings.Split(string(f), "\n")
+		for k, line := range lines {
+			switch strings.TrimSpace(line) {
+			case "server " + v["internal"] + ";":
+				if !up {
+					lines[k] = "	server " + v["internal"] + " down;"
+					changed = true
+				}
+			case "server " + v["internal"] + " down;":
+				if up {
+					lines[k] = "	server " + v["internal"] + ";"
+					changed = true
+				}
+			}
+		}
+		if changed {
+			log.Check(log.WarnLevel, "Writing nginx config "+conf, ioutil.WriteFile(conf, []byte(strings.Join(lines, "\n")), 0744))
+			reload = true
+		}
+	}
+	if reload {
+		out, err := exec.Command("nginx", "-s", "reload").CombinedOutput()
+		log.Check(log.WarnLevel, "Reloading nginx "+string(out), err)
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/influxdata/influxdb/client/v2"
 
 	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/lib/cgroup"
 	"github.com/subutai-io/agent/lib/container"
 	"github.com/subutai-io/agent/log"
 	"github.com/subutai-io/agent/agent/utils"
@@ -22,7 +23,6 @@ import (
 
 var (
 	traff     = []string{"in", "out"}
-	cgtype    = []string{"cpuacct", "memory"}
 	metrics   = []string{"total", "used", "available"}
 	cpu       = []string{"user", "nice", "system", "idle", "iowait"}
 	lxcmemory = map[string]bool{"cache": true, "rss": true, "Cached": true, "MemFree": true}
@@ -66,6 +66,8 @@ func doCollect() {
 
 				netStat(bp)
 				cgroupStat(bp)
+				ioStat(bp)
+				pidsStat(bp)
 				btrfsStat(bp)
 				diskFree(bp)
 				cpuStat(bp)
@@ -79,51 +81,47 @@ func doCollect() {
 	}
 }
 
-func parsefile(bp client.BatchPoints, hostname, lxc, cgtype, filename string) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return
+func addPoint(bp client.BatchPoints, series, hostname, kind string, value int) {
+	point, err := client.NewPoint(series,
+		map[string]string{"hostname": hostname, "type": kind},
+		map[string]interface{}{"value": value},
+		time.Now())
+	if err == nil {
+		bp.AddPoint(point)
 	}
-	defer file.Close()
-	scanner := bufio.NewScanner(bufio.NewReader(file))
-	for scanner.Scan() {
-		line := strings.Split(scanner.Text(), " ")
-		if value, err := strconv.Atoi(line[1]); err == nil {
-			if cgtype == "memory" && lxcmemory[line[0]] {
-				point, err := client.NewPoint("lxc_"+cgtype,
-					map[string]string{"hostname": lxc, "type": line[0]},
-					map[string]interface{}{"value": value},
-					time.Now())
-				if err == nil {
-					bp.AddPoint(point)
-				}
-			} else if cgtype == "cpuacct" {
-				point, err := client.NewPoint("lxc_cpu",
-					map[string]string{"hostname": lxc, "type": line[0]},
-					map[string]interface{}{"value": value / runtime.NumCPU()},
-					time.Now())
-				bp.AddPoint(point)
-				if err == nil {
-					bp.AddPoint(point)
-				}
+}
+
+// cgroupStat collects CPU time and memory usage of the containers
+func cgroupStat(bp client.BatchPoints) {
+	for _, name := range cgroup.Containers() {
+		if user, system, err := cgroup.CPUStat(name); err == nil {
+			addPoint(bp, "lxc_cpu", name, "user", user/runtime.NumCPU())
+			addPoint(bp, "lxc_cpu", name, "system", system/runtime.NumCPU())
+		}
+		for k, v := range cgroup.MemoryStat(name) {
+			if lxcmemory[k] {
+				addPoint(bp, "lxc_memory", name, k, v)
 			}
 		}
 	}
+}
 
+// ioStat collects read and write bytes and operations of the containers block I/O
+func ioStat(bp client.BatchPoints) {
+	for _, name := range cgroup.Containers() {
+		rbytes, wbytes, rops, wops := cgroup.IOStat(name)
+		addPoint(bp, "lxc_io", name, "read_bytes", rbytes)
+		addPoint(bp, "lxc_io", name, "write_bytes", wbytes)
+		addPoint(bp, "lxc_io", name, "read_ops", rops)
+		addPoint(bp, "lxc_io", name, "write_ops", wops)
+	}
 }
 
-func cgroupStat(bp client.BatchPoints) {
-	hostname, err := os.Hostname()
-	log.Check(log.DebugLevel, "Getting hostname of the system", err)
-	for _, item := range cgtype {
-		path := "/sys/fs/cgroup/" + item + "/lxc/"
-		files, err := ioutil.ReadDir(path)
-		if err == nil {
-			for _, f := range files {
-				if f.IsDir() {
-					parsefile(bp, hostname, f.Name(), item, path+f.Name()+"/"+item+".stat")
-				}
-			}
+// pidsStat collects number of processes in the containers
+func pidsStat(bp client.BatchPoints) {
+	for _, name := range cgroup.Containers() {
+		if current, _, err := cgroup.Pids(name); err == nil {
+			addPoint(bp, "lxc_pids", name, "current", current)
 		}
 	}
 }
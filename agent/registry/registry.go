@@ -0,0 +1,379 @@
+// Package registry serves template archives cached on the Resource Host to other agents in the form of Kurjun REST API,
+// so hosts of the same datacenter may import templates from a peer instead of the global CDN
+package registry
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/lib/template"
+	"github.com/subutai-io/agent/log"
+)
+
+// Path returns directory of the registry cache. Archives are stored by their SHA256 hash sum along with JSON metadata files.
+func Path() string {
+	return config.Agent.LxcPrefix + "registry/"
+}
+
+// Templates returns metadata of all cached templates sorted by name, owner and version, latest versions first
+func Templates() (list []template.Meta) {
+	files, _ := filepath.Glob(Path() + "*.json")
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if log.Check(log.DebugLevel, "Reading "+file, err) {
+			continue
+		}
+		var m template.Meta
+		if !log.Check(log.DebugLevel, "Parsing "+file, json.Unmarshal(data, &m)) && m.Hash.Sha256 != "" {
+			list = append(list, m)
+		}
+	}
+	template.Sort(list)
+	return list
+}
+
+// Find returns cached templates matching the query, see template.Match
+func Find(id, name, owner, ver string) []template.Meta {
+	return template.Match(Templates(), id, name, owner, ver)
+}
+
+// Archive returns path of the cached template archive
+func Archive(m template.Meta) string {
+	return Path() + m.Hash.Sha256
+}
+
+// Add puts the template archive into the registry cache. The archive is hard linked if possible, otherwise copied,
+// its hash sums are checked against the metadata and SHA256 hash sum is calculated if missing.
+func Add(m template.Meta, archive string) error {
+	if m.ID == "" || m.Hash.Md5 == "" && m.Hash.Sha256 == "" {
+		return errors.New("template metadata is incomplete")
+	}
+	if err := os.MkdirAll(Path(), 0755); err != nil {
+		return err
+	}
+	part := partName()
+	if err := os.Link(archive, part); err != nil {
+		if err = copyFile(archive, part); err != nil {
+			return err
+		}
+	}
+	defer os.Remove(part)
+	return finish(&m, part)
+}
+
+// Link makes the cached archive of the template available at the path, it returns false if the template is not cached
+func Link(id, path string) bool {
+	list := Find(id, "", "", "")
+	if id == "" || len(list) == 0 {
+		return false
+	}
+	os.Remove(path)
+	if os.Link(Archive(list[0]), path) == nil {
+		return true
+	}
+	return !log.Check(log.DebugLevel, "Copying cached archive", copyFile(Archive(list[0]), path))
+}
+
+// Remove deletes cached templates matching the query, it returns the number of removed archives
+func Remove(id, name, owner, ver string) (n int) {
+	for _, m := range Find(id, name, owner, ver) {
+		log.Check(log.WarnLevel, "Removing "+m.File, os.Remove(Archive(m)))
+		if !log.Check(log.WarnLevel, "Removing "+m.File+" metadata", os.Remove(Archive(m)+".json")) {
+			n++
+		}
+	}
+	return
+}
+
+// Keys returns cached public GPG keys of the template owner in the format of Kurjun /auth/keys response
+func Keys(owner string) ([]byte, error) {
+	if strings.ContainsAny(owner, "/\\") || owner == "" {
+		return nil, errors.New("invalid owner " + owner)
+	}
+	return ioutil.ReadFile(Path() + "keys/" + owner)
+}
+
+// CacheKeys fetches public GPG keys of the template owner from the CDN, keys are never taken from the template source the template is synced from
+func CacheKeys(owner string) error {
+	if strings.ContainsAny(owner, "/\\") || owner == "" {
+		return errors.New("invalid owner " + owner)
+	}
+	keys, err := template.CDNKeys(owner)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(Path()+"keys", 0755); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(Path()+"keys/"+owner+".part", body, 0644); err != nil {
+		return err
+	}
+	return os.Rename(Path()+"keys/"+owner+".part", Path()+"keys/"+owner)
+}
+
+// Sync mirrors the template matching the query from the first template source which has it, sources are tried in the configured order.
+// Empty owner selects verified templates, empty version selects the latest one. Templates already cached are not downloaded again.
+// It returns metadata of the synced template.
+func Sync(name, owner, ver string) (template.Meta, error) {
+	for _, src := range template.Sources() {
+		m, err := src.Info("", name, owner, ver, "")
+		if err == template.ErrNotFound {
+			continue
+		}
+		if log.Check(log.WarnLevel, "Getting "+name+" info from "+src.String(), err) {
+			continue
+		}
+		for o := range m.Signs {
+			log.Check(log.WarnLevel, "Caching keys of "+o, CacheKeys(o))
+		}
+		if len(Find(m.ID, "", "", "")) > 0 {
+			log.Debug(m.Name + "@" + template.Owner(m) + ":" + m.Version + " is already cached")
+			return m, nil
+		}
+		if err = download(src, m); err != nil {
+			return m, err
+		}
+		log.Info(m.Name + "@" + template.Owner(m) + ":" + m.Version + " synced from " + src.String())
+		return m, nil
+	}
+	return template.Meta{}, errors.New("template " + name + " not found")
+}
+
+// Refresh syncs the latest versions of all cached templates
+func Refresh() {
+	seen := make(map[string]bool)
+	for _, m := range Templates() {
+		if key := m.Name + "@" + template.Owner(m); !seen[key] {
+			seen[key] = true
+			_, err := Sync(m.Name, template.Owner(m), "")
+			log.Check(log.WarnLevel, "Syncing "+key, err)
+		}
+	}
+}
+
+// Serve starts HTTPS server of the registry if it is enabled in the agent config. The server uses the agent certificate
+// and listens on the configured address and port under /kurjun/rest path, so other agents may use this host as their CDN.
+// Requests are accepted only from peers listed in "allow" option: comma separated addresses and networks in CIDR notation,
+// all peers are allowed if it is empty. Only public templates are cached, templates imported with CDN token are not served.
+// If sync interval is set, cached templates are refreshed from the template sources periodically.
+func Serve() {
+	if !config.Registry.Enable {
+		return
+	}
+	if config.Registry.Sync > 0 {
+		go func() {
+			for {
+				time.Sleep(time.Duration(config.Registry.Sync) * time.Hour)
+				Refresh()
+			}
+		}()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/kurjun/rest/template/info", info)
+	mux.HandleFunc("/kurjun/rest/template/download", serveArchive)
+	mux.HandleFunc("/kurjun/rest/auth/keys", keys)
+
+	allow := allowList(config.Registry.Allow)
+	handler := http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		if !allowed(allow, request.RemoteAddr) {
+			http.Error(rw, "Forbidden", http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(rw, request)
+	})
+
+	addr := net.JoinHostPort(config.Registry.Bind, config.Registry.Port)
+	log.Info("Starting template registry on " + addr)
+	log.Check(log.WarnLevel, "Serving template registry", http.ListenAndServeTLS(addr,
+		config.Agent.DataPrefix+"ssl/cert.pem", config.Agent.DataPrefix+"ssl/key.pem", handler))
+}
+
+// allowList parses comma separated addresses and networks of allowed peers, single addresses are turned into host networks
+func allowList(value string) (list []*net.IPNet) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(item)
+		if !log.Check(log.WarnLevel, "Parsing allowed registry peer "+item, err) {
+			list = append(list, network)
+		}
+	}
+	return list
+}
+
+// allowed checks if the remote address belongs to one of the allowed networks, empty list allows all addresses
+func allowed(list []*net.IPNet, remote string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	for _, network := range list {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func info(rw http.ResponseWriter, request *http.Request) {
+	q := request.URL.Query()
+	list := Find(q.Get("id"), q.Get("name"), q.Get("owner"), q.Get("version"))
+	if q.Get("verified") == "true" && q.Get("owner") == "" {
+		list = template.Verified(list)
+	}
+	if len(list) == 0 {
+		http.NotFound(rw, request)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	log.Check(log.DebugLevel, "Writing template info", json.NewEncoder(rw).Encode(list))
+}
+
+func serveArchive(rw http.ResponseWriter, request *http.Request) {
+	id := request.URL.Query().Get("id")
+	list := Find(id, "", "", "")
+	if id == "" || len(list) == 0 {
+		http.NotFound(rw, request)
+		return
+	}
+	f, err := os.Open(Archive(list[0]))
+	if err != nil {
+		http.NotFound(rw, request)
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Disposition", "attachment; filename="+list[0].File)
+	http.ServeContent(rw, request, list[0].File, stat.ModTime(), f)
+}
+
+func keys(rw http.ResponseWriter, request *http.Request) {
+	body, err := Keys(request.URL.Query().Get("user"))
+	if err != nil {
+		http.NotFound(rw, request)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(body)
+}
+
+// download gets template archive from the template source into the registry cache
+func download(src template.Source, m template.Meta) error {
+	if m.Hash.Md5 == "" && m.Hash.Sha256 == "" {
+		return errors.New("template " + m.Name + " has no hash sums")
+	}
+	if err := os.MkdirAll(Path(), 0755); err != nil {
+		return err
+	}
+	part := partName()
+	out, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(part)
+
+	body, _, err := src.Open(m, "")
+	if err != nil {
+		out.Close()
+		return err
+	}
+	defer body.Close()
+	_, err = io.Copy(out, body)
+	if err2 := out.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+	return finish(&m, part)
+}
+
+// finish verifies hash sums of the downloaded or linked archive, moves it in place and writes its metadata
+func finish(m *template.Meta, part string) error {
+	f, err := os.Open(part)
+	if err != nil {
+		return err
+	}
+	md5hash, sha256hash := md5.New(), sha256.New()
+	size, err := io.Copy(io.MultiWriter(md5hash, sha256hash), f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if m.Hash.Md5 != "" && fmt.Sprintf("%x", md5hash.Sum(nil)) != m.Hash.Md5 {
+		return errors.New("MD5 hash sum mismatch of " + m.File)
+	}
+	sum := fmt.Sprintf("%x", sha256hash.Sum(nil))
+	if m.Hash.Sha256 != "" && m.Hash.Sha256 != sum {
+		return errors.New("SHA256 hash sum mismatch of " + m.File)
+	}
+	m.Hash.Sha256, m.Size = sum, size
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(part, Archive(*m)); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(Archive(*m)+".json.part", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(Archive(*m)+".json.part", Archive(*m)+".json")
+}
+
+// partName returns unique name of the temporary file in the registry cache
+func partName() string {
+	return Path() + "." + strconv.FormatInt(time.Now().UnixNano(), 10) + ".part"
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -1,7 +1,6 @@
 package cli
 
 import (
-	"bufio"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -18,9 +17,13 @@ import (
 	"github.com/subutai-io/agent/log"
 )
 
+// volumePrefix marks deltas of named volumes in backups
+const volumePrefix = "volume_"
+
 // BackupContainer takes a snapshots of each container's volume and stores it in the `/mnt/backups/container_name/datetime/` directory.
 // A full backup creates a delta-file of each BTRFS subvolume. An incremental backup (default) creates a delta-file with the difference of changes between the current and last snapshots.
 // All deltas are compressed to archives in `/mnt/backups/` directory (container_datetime.tar.gz or container_datetime_Full.tar.gz for full backup).
+// Named volumes attached to the container are backed up along with its own volumes, other bind mounts are skipped.
 // A changelog file can be found next to backups archive (container_datetime_changelog.txt or container_datetime_Full_changelog.txt) which contains a list of changes made between two backups.
 func BackupContainer(container string, full, stop bool) string {
 	backupDir := config.Agent.LxcPrefix + "/backups/"
@@ -84,12 +87,25 @@ func BackupContainer(container string, full, stop bool) string {
 	}
 
 	for _, subvol := range getContainerMountPoints(container) {
+		if !fs.IsSubvolumeReadWrite(subvol) && !fs.IsSubvolumeReadonly(subvol) {
+			log.Debug("Skipping bind mount " + subvol + ", it's not a subvolume")
+			continue
+		}
 		subvolBase := path.Base(subvol)
 
 		subvolBaseMountpointPath := "/" + subvolBase
 		if subvolBase == "rootfs" {
 			subvolBaseMountpointPath = ""
 		}
+		// named volumes are stored with prefix to avoid collisions with container volumes
+		if strings.HasPrefix(subvol, lxcContainer.VolumePath("")) {
+			subvolBase = volumePrefix + subvolBase
+			for target, src := range lxcContainer.Mounts(container) {
+				if src == path.Clean(subvol) {
+					subvolBaseMountpointPath = target
+				}
+			}
+		}
 
 		containerSnapshotName := containerSnapshotDir + "/" + subvolBase
 
@@ -114,6 +130,7 @@ func BackupContainer(container string, full, stop bool) string {
 
 	log.Check(log.FatalLevel, "Copy meta files",
 		exec.Command("rsync", "-av", `--exclude`, `/rootfs`, `--exclude`, `/home`, `--exclude`, `/opt`, `--exclude`, `/var`, `--exclude`, `.*`, config.Agent.LxcPrefix+container+"/", tmpBackupDir+"meta").Run())
+	log.Check(log.WarnLevel, "Saving mounts", lxcContainer.ExportMounts(container, tmpBackupDir+"meta"))
 
 	log.Check(log.FatalLevel, "Create Changelog file on tmpdir",
 		ioutil.WriteFile(changelogName, []byte(strings.Join(changelog, "\n")), 0644))
@@ -135,23 +152,13 @@ func getContainerMountPoints(container string) []string {
 	var mountPoints []string
 
 	configPath := config.Agent.LxcPrefix + container + "/config"
-
-	file, err := os.Open(configPath)
-	if err != nil {
+	if _, err := os.Stat(configPath); err != nil {
 		log.Error("Cannot open Container Config " + configPath)
 	}
-	log.Check(log.FatalLevel, "Opening container config file", err)
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		if scanner.Text() != "" && (string(scanner.Text()[0])) != "#" {
-			if s := strings.Split(scanner.Text(), " = "); s[0] == "lxc.rootfs" {
-				mountPoints = append(mountPoints, strings.Split(s[1], " ")[0])
-			}
-			if s := strings.Split(scanner.Text(), " = "); s[0] == "lxc.mount.entry" {
-				mountPoints = append(mountPoints, strings.Split(s[1], " ")[0])
-			}
+
+	for _, entry := range append([]string{lxcContainer.GetConfigItem(configPath, "lxc.rootfs")}, lxcContainer.ConfigItems(configPath, "lxc.mount.entry")...) {
+		if fields := strings.Fields(entry); len(fields) > 0 {
+			mountPoints = append(mountPoints, fields[0])
 		}
 	}
 
@@ -161,13 +168,21 @@ func getContainerMountPoints(container string) []string {
 // getModifiedList generates a list of changed files for backup changelog
 func getModifiedList(td, ytd, rdir string) []string {
 	var list []string
+	for _, c := range fileChanges(td, ytd, "-u") {
+		list = append(list, c[0]+" "+rdir+c[1])
+	}
+	return list
+}
 
-	data, err := exec.Command("rsync", "-avun", `--delete`, `--out-format="%i %n %L"`, td, ytd).Output()
+// fileChanges compares two directory trees with rsync dry run and returns pairs of change type and path relative to the trees.
+// Change type is "added" for files existing only in td, "deleted" for files existing only in ytd and "modified" for files with different size or time.
+func fileChanges(td, ytd string, args ...string) (list [][]string) {
+	args = append([]string{"-avn", "--delete", "--out-format=%i %n %L"}, args...)
+	data, err := exec.Command("rsync", append(args, td, ytd)...).Output()
 	log.Check(log.WarnLevel, "Generate list of changed files", err)
 
 	lines := strings.Split(string(data), "\n")
 	for _, l := range lines {
-		l = strings.Replace(l, `"`, "", -1)
 		if len(l) == 0 {
 			continue
 		}
@@ -181,17 +196,20 @@ func getModifiedList(td, ytd, rdir string) []string {
 			continue
 		}
 		line := strings.Fields(l)
+		if len(line) < 2 {
+			continue
+		}
 		if strings.Contains(line[0], `*deleting`) {
-			list = append(list, "deleted "+rdir+strings.Join(line[1:], " "))
+			list = append(list, []string{"deleted", strings.Join(line[1:], " ")})
 			continue
 		}
 		if strings.Contains(line[0], `+++++++++`) {
-			list = append(list, "added "+rdir+strings.Join(line[1:], " "))
+			list = append(list, []string{"added", strings.Join(line[1:], " ")})
 			continue
 		}
 
-		if string(line[0][3]) == `s` || string(line[0][4]) == `t` {
-			list = append(list, "modified "+rdir+strings.Join(line[1:], " "))
+		if len(line[0]) > 4 && (string(line[0][3]) == `s` || string(line[0][4]) == `t`) {
+			list = append(list, []string{"modified", strings.Join(line[1:], " ")})
 			continue
 		}
 	}
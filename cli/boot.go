@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/log"
+)
+
+// bootItem is the structured output schema of the boot command:
+//	name, container name
+//	order, start priority
+//	after, containers started before this one
+//	delay, seconds to wait after the start before starting dependent containers
+type bootItem struct {
+	Name  string   `json:"name"`
+	Order int      `json:"order"`
+	After []string `json:"after"`
+	Delay int      `json:"delay"`
+}
+
+// LxcBoot configures start dependencies of the Subutai container used by the daemon to restore containers at boot and by env start:
+//	order, start priority, containers with lower value are started first
+//	after, comma separated list of containers which should be started, and become healthy if they have health check, before this one
+//	delay, number of seconds to wait after the container start before starting containers depending on it
+// Zero order and delay values and "none" value of after remove corresponding settings.
+// Without options command prints current start dependencies of the container.
+func LxcBoot(name, order, after, delay string) {
+	if !container.IsContainer(name) {
+		log.ErrorCode(log.ExitNotFound, name+" is not a container")
+	}
+
+	if order == "" && after == "" && delay == "" {
+		item := bootItem{Name: name, Order: container.StartOrder(name), After: container.StartAfter(name), Delay: container.StartDelay(name)}
+		if item.After == nil {
+			item.After = []string{}
+		}
+		output(item, func() {
+			fmt.Printf("%s\torder %d\tafter %s\tdelay %ds\n", item.Name, item.Order, strings.Join(item.After, ","), item.Delay)
+		})
+		return
+	}
+
+	var conf [][]string
+	for k, v := range map[string]string{"order": order, "delay": delay} {
+		if v == "" {
+			continue
+		}
+		i, err := strconv.Atoi(v)
+		if err != nil || (k == "delay" && i < 0) {
+			log.ErrorCode(log.ExitUsage, "Invalid start "+k+" "+v)
+		}
+		if i == 0 {
+			v = ""
+		}
+		conf = append(conf, []string{"subutai.start." + k, v})
+	}
+	if after == "none" {
+		conf = append(conf, []string{"subutai.start.after", ""})
+	} else if after != "" {
+		var list []string
+		for _, dep := range strings.Split(after, ",") {
+			if dep = strings.TrimSpace(dep); dep == name {
+				log.ErrorCode(log.ExitUsage, "Container cannot depend on itself")
+			} else if dep != "" {
+				list = append(list, dep)
+			}
+		}
+		conf = append(conf, []string{"subutai.start.after", strings.Join(list, ",")})
+	}
+
+	log.Check(log.ErrorLevel, "Setting start dependencies", container.SetContainerConf(name, conf))
+
+	if _, cycle := container.Order(container.Containers()); stringInList(name, cycle) {
+		log.Warn("Start dependencies of " + name + " are cyclic: " + strings.Join(cycle, ", "))
+	}
+	log.Info("Start dependencies of " + name + " updated")
+}
@@ -2,12 +2,15 @@ package cli
 
 import (
 	"net"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/subutai-io/agent/config"
 	"github.com/subutai-io/agent/db"
 	"github.com/subutai-io/agent/lib/container"
 	"github.com/subutai-io/agent/lib/gpg"
+	"github.com/subutai-io/agent/lib/template"
 	"github.com/subutai-io/agent/log"
 	"github.com/subutai-io/agent/agent/utils"
 	"regexp"
@@ -25,15 +28,34 @@ var (
 //
 // If `-i` option is defined, separate bridge interface will be created in specified VLAN and new container will receive static IP address.
 // Option `-e` writes the environment ID string inside new container.
+// Option `-l` sets key=value labels of new container, it may be repeated or contain comma separated list of labels.
+// Option `-p` applies quotas and thresholds of the named profile to new container; the container is destroyed if the profile cannot be applied.
+// Option `--ttl` sets lifetime of new container, e.g. 30m, 2h or 1d; the daemon destroys the container when it expires. Lifetime can be prolonged with "ttl extend".
+// Option `--ephemeral` marks new container to be destroyed by the daemon as soon as it stops.
+// If signature policy is "enforce", signature of the parent template is verified even if the template is already installed.
 // Option `-t` is intended to check the origin of new container creation request during environment build.
 // This is one of the security checks which makes sure that each container creation request is authorized by registered user.
 //
 // The clone options are not intended for manual use: unless you're confident about what you're doing. Use default clone format without additional options to create Subutai containers.
-func LxcClone(parent, child, envID, addr, consoleSecret, cdnToken string) {
+func LxcClone(parent, child, envID, addr, consoleSecret, cdnToken, profile, ttl string, ephemeral bool, labels []string) {
 	child = utils.CleanTemplateName(child)
+	labelMap := parseLabels(labels)
+	var lifetime time.Duration
+	if len(ttl) != 0 {
+		lifetime = parseTTL(ttl)
+	}
+	var quotas map[string]string
+	if len(profile) != 0 {
+		if quotas, _ = getProfile(profile); quotas == nil {
+			log.ErrorCode(log.ExitNotFound, "Profile "+profile+" not found")
+		}
+	}
 
+	if container.IsReserved(child) {
+		log.ErrorCode(log.ExitUsage, child+" is a reserved name")
+	}
 	if container.ContainerOrTemplateExists(child) {
-		log.Error("Container " + child + " already exists")
+		log.ErrorCode(log.ExitExists, "Container "+child+" already exists")
 	}
 
 	t := getTemplateInfo(parent, cdnToken)
@@ -48,6 +70,13 @@ func LxcClone(parent, child, envID, addr, consoleSecret, cdnToken string) {
 
 	if !container.IsTemplate(t.Name) {
 		LxcImport("id:"+t.Id, cdnToken, false)
+	} else if template.Policy() == template.PolicyEnforce {
+		// installed template may have been imported under weaker policy, its signature is checked again
+		installed, found := getTemplateInfoFromCacheByName(t.Name)
+		if !found {
+			installed = templ{Name: t.Name}
+		}
+		verifySignature(installed)
 	}
 
 	log.Check(log.ErrorLevel, "Cloning the container", container.Clone(t.Name, child))
@@ -69,6 +98,13 @@ func LxcClone(parent, child, envID, addr, consoleSecret, cdnToken string) {
 
 	meta["uid"], _ = container.SetContainerUID(child)
 
+	if lifetime > 0 {
+		meta["expires"] = strconv.FormatInt(time.Now().Add(lifetime).Unix(), 10)
+	}
+	if ephemeral {
+		meta["ephemeral"] = "true"
+	}
+
 	//Need to change it in parent templates
 	container.SetApt(child)
 	container.SetDNS(child)
@@ -86,8 +122,18 @@ func LxcClone(parent, child, envID, addr, consoleSecret, cdnToken string) {
 	bolt, err := db.New()
 	log.Check(log.WarnLevel, "Opening database", err)
 	log.Check(log.WarnLevel, "Writing container data to database", bolt.ContainerAdd(child, meta))
+	for k, v := range labelMap {
+		log.Check(log.WarnLevel, "Writing container label to database", bolt.ContainerLabel(child, k, v))
+	}
 	log.Check(log.WarnLevel, "Closing database", bolt.Close())
 
+	if quotas != nil {
+		if err := applyProfile(child, profile, quotas); err != nil {
+			LxcDestroy(child, false)
+			log.Error("Applying profile " + profile + " to " + child + ", " + err.Error())
+		}
+	}
+
 	log.Info(child + " with ID " + gpg.GetFingerprint(child) + " successfully cloned")
 }
 
@@ -103,11 +149,11 @@ func addNetConf(name, addr string) {
 		gateway = net.IP(gw).String()
 	}
 
-	container.SetContainerConf(name, [][]string{
+	log.Check(log.ErrorLevel, "Setting network configuration", container.SetContainerConf(name, [][]string{
 		{"lxc.network.ipv4", ipvlan[0]},
 		{"lxc.network.ipv4.gateway", gateway},
 		{"#vlan_id", ipvlan[1]},
-	})
+	}))
 	container.SetStaticNet(name)
 }
 
@@ -1,92 +1,120 @@
 package cli
 
 import (
-	"io/ioutil"
+	"fmt"
 	"os"
-	"strings"
+	"strconv"
+	"text/tabwriter"
 
 	"github.com/subutai-io/agent/config"
 	"github.com/subutai-io/agent/lib/container"
 	"github.com/subutai-io/agent/log"
 )
 
+// configItem is the structured output schema of the config command:
+//	key, configuration key
+//	value, value of the key, repeated keys are listed in the order of the config
+type configItem struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
 // LxcConfig function allows read and write container's configuration file through command line.
+// Keys are validated against known LXC and Subutai keys. Adding a single-value key replaces its value,
+// values of multi-value keys like lxc.mount.entry are added after the existing ones.
+// Deleting a key with value removes only the entries with that value, without value all entries of the key are removed.
+// The config is written atomically, the previous version is kept in config.bak.
 func LxcConfig(contName, operation, key, value string) {
-	// log.Info(contName + " " + operation + " " + key + " " + value)
+	if !container.ContainerOrTemplateExists(contName) {
+		log.ErrorCode(log.ExitNotFound, "Container "+contName+" not found")
+	}
+	cfg, err := container.ReadConfig(config.Agent.LxcPrefix + contName + "/config")
+	log.Check(log.ErrorLevel, "Reading config", err)
+
 	switch operation {
 	case "add":
-		addValue(contName, key, value)
+		addValue(cfg, key, value)
 	case "del":
-		delValue(contName, key, value)
+		delValue(cfg, key, value)
 	case "":
-		displayConfig(contName)
+		displayConfig(cfg)
+	default:
+		log.ErrorCode(log.ExitUsage, "Unsupported operation "+operation+", expected add or del")
 	}
 }
 
-// displayConfig prints container configuration file
-func displayConfig(containerName string) {
-	fp, err := ioutil.ReadFile(config.Agent.LxcPrefix + containerName + "/config")
-	log.Check(log.FatalLevel, "Reading config", err)
-	// log.Info("Config:")
-	log.Info("\n" + string(fp) + "\n")
+// displayConfig prints container configuration entries
+func displayConfig(cfg *container.Config) {
+	items := []configItem{}
+	for _, kv := range cfg.Entries() {
+		items = append(items, configItem{Key: kv[0], Value: kv[1]})
+	}
+	output(items, func() {
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+		for _, i := range items {
+			fmt.Fprintln(w, i.Key+"\t= "+i.Value)
+		}
+		w.Flush()
+	})
 }
 
 // addValue adds passed key and value to container's configuration file
-func addValue(containerName, key, value string) {
+func addValue(cfg *container.Config, key, value string) {
 	if len(key) == 0 {
-		log.Error("no key provided")
+		log.ErrorCode(log.ExitUsage, "No key provided")
 	}
 	if len(value) == 0 {
-		log.Error("no value provided")
+		log.ErrorCode(log.ExitUsage, "No value provided")
 	}
-	f := config.Agent.LxcPrefix + containerName + "/config"
-	if container.GetConfigItem(f, key) == "" { // add it.
-
-		fp, err := os.OpenFile(f, os.O_WRONLY|os.O_APPEND, 0644)
-		log.Check(log.FatalLevel, "Opening config", err)
-
-		_, err = fp.WriteString(key + " = " + value)
-		log.Check(log.FatalLevel, "Writing string", err)
-
-		log.Info(key + " added")
-		fp.Close()
-
-	} else { // replace it.
-		fp, err := ioutil.ReadFile(f)
-		log.Check(log.FatalLevel, "Reading config", err)
-
-		fpLines := strings.Split(string(fp), "\n")
-		for i, v := range fpLines {
-			if strings.Contains(v, key) {
-				fpLines[i] = key + " = " + value
-			}
-		}
-		fpLinesSTR := strings.Join(fpLines, "\n")
-		log.Check(log.FatalLevel, "Writing string", ioutil.WriteFile(f, []byte(fpLinesSTR), 0644))
+	if err := container.ValidKey(key); err != nil {
+		log.ErrorCode(log.ExitUsage, err.Error())
+	}
+	replaced := !container.MultiValue(key) && cfg.Get(key) != ""
+	if err := cfg.Add(key, value); err != nil {
+		log.ErrorCode(log.ExitUsage, err.Error())
+	}
+	log.Check(log.ErrorLevel, "Writing config", cfg.Write())
+	if replaced {
 		log.Info(key + " replaced")
+	} else {
+		log.Info(key + " added")
 	}
 }
 
 // delValue removes passed key and value from container's configuration file
-func delValue(containerName, key, value string) {
+func delValue(cfg *container.Config, key, value string) {
 	if len(key) == 0 {
-		log.Error("No key provided")
+		log.ErrorCode(log.ExitUsage, "No key provided")
 	}
-	f := config.Agent.LxcPrefix + containerName + "/config"
-	if container.GetConfigItem(f, key) == "" {
-		log.Error("No such item found")
-	} else {
-		fp, err := ioutil.ReadFile(f)
-		log.Check(log.FatalLevel, "Reading config", err)
+	if !cfg.Delete(key, value) {
+		log.ErrorCode(log.ExitNotFound, "No such item found")
+	}
+	log.Check(log.ErrorLevel, "Writing config", cfg.Write())
+	log.Info(key + " deleted")
+}
 
-		fpLines := strings.Split(string(fp), "\n")
-		for i, v := range fpLines {
-			if strings.Contains(v, key) {
-				fpLines[i] = ""
-			}
+// ConfigMigrate converts configs of the containers and templates to the key format of the installed LXC,
+// e.g. lxc.network.* keys to lxc.net.0.* and lxc.utsname to lxc.uts.name for LXC 2.1 and later.
+// Without names every container and template is migrated. Running containers use the migrated config after restart.
+func ConfigMigrate(names []string) {
+	if len(names) == 0 {
+		names = container.All()
+	}
+	for _, name := range names {
+		if !container.ContainerOrTemplateExists(name) {
+			log.ErrorCode(log.ExitNotFound, "Container "+name+" not found")
+		}
+	}
+	for _, name := range names {
+		n, err := container.MigrateConfig(config.Agent.LxcPrefix + name + "/config")
+		if log.Check(log.WarnLevel, "Migrating config of "+name, err) {
+			continue
+		}
+		if n > 0 {
+			log.Info(name + ": " + strconv.Itoa(n) + " keys migrated")
+		} else {
+			log.Info(name + ": up to date")
 		}
-		fpLinesSTR := strings.Join(fpLines, "\n")
-		log.Check(log.FatalLevel, "Writing config", ioutil.WriteFile(f, []byte(fpLinesSTR), 0755))
-		log.Info(key + " deleted")
 	}
 }
@@ -0,0 +1,205 @@
+package cli
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/log"
+)
+
+// cpEndpoint is the source or destination of the copy: host path and container whose uid range owns the files
+type cpEndpoint struct {
+	container string
+	path      string
+	base      int
+}
+
+// LxcCp copies files between the host and Subutai containers, or between two containers.
+// Container paths are passed as container:path and resolved inside the container, including its bind mounted home, opt and var subvolumes and other mount entries;
+// symlinks are resolved relative to the container root. Other paths are host paths.
+// Ownership is shifted to the uid range of the destination container, i.e. root owned host file becomes owned by the container root and vice versa.
+// Directories are copied only with the recursive option. Destination "-" streams tar archive of the source to stdout.
+// Templates can be used as a source, but not as a destination.
+func LxcCp(src, dst string, recursive bool) {
+	from := cpParse(src)
+	info, err := os.Lstat(from.path)
+	if os.IsNotExist(err) {
+		log.ErrorCode(log.ExitNotFound, src+" not found")
+	}
+	log.Check(log.ErrorLevel, "Reading "+src, err)
+	if info.IsDir() && !recursive {
+		log.ErrorCode(log.ExitUsage, src+" is a directory, use recursive option to copy it")
+	}
+
+	if dst == "-" {
+		log.Check(log.ErrorLevel, "Streaming "+src, cpTar(from, os.Stdout))
+		return
+	}
+
+	to := cpParse(dst)
+	if to.container != "" && container.IsTemplate(to.container) {
+		log.ErrorCode(log.ExitUsage, to.container+" is a template, templates cannot be modified")
+	}
+	if d, err := os.Stat(to.path); err == nil && d.IsDir() {
+		to.path = filepath.Join(to.path, filepath.Base(from.path))
+	}
+	log.Check(log.ErrorLevel, "Copying "+src+" to "+dst, cpTree(from, to))
+}
+
+// cpParse resolves container:path or host path argument
+func cpParse(arg string) cpEndpoint {
+	kv := strings.SplitN(arg, ":", 2)
+	if len(kv) != 2 || kv[0] == "" || strings.Contains(kv[0], "/") {
+		path, err := filepath.Abs(arg)
+		log.Check(log.ErrorLevel, "Resolving path "+arg, err)
+		return cpEndpoint{path: path}
+	}
+	if !container.ContainerOrTemplateExists(kv[0]) {
+		log.ErrorCode(log.ExitNotFound, "Container "+kv[0]+" not found")
+	}
+	path, err := container.HostPath(kv[0], kv[1])
+	log.Check(log.ErrorLevel, "Resolving path "+arg, err)
+	return cpEndpoint{container: kv[0], path: path, base: container.UIDBase(kv[0])}
+}
+
+// shift maps file owner id of the source endpoint to the destination one, ids outside of the container range belong to the container root
+func shift(id int, from, to cpEndpoint) int {
+	if from.base > 0 && id >= from.base && id < from.base+65536 {
+		id -= from.base
+	}
+	if to.base == 0 {
+		return id
+	}
+	if id >= 65536 {
+		id = 0
+	}
+	return to.base + id
+}
+
+// cpTree recursively copies source to destination preserving modes and times and shifting ownership.
+// Existing symlinks in the destination are replaced rather than followed, so container can't redirect writes outside of it.
+func cpTree(from, to cpEndpoint) error {
+	return filepath.Walk(from.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from.path, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to.path, rel)
+		if existing, err := os.Lstat(target); err == nil && existing.Mode()&os.ModeSymlink != 0 {
+			if err = os.Remove(target); err != nil {
+				return err
+			}
+		}
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			if err = os.Mkdir(target, mode.Perm()); err != nil && !os.IsExist(err) {
+				return err
+			}
+		case mode.IsRegular():
+			if err = cpFile(path, target, mode.Perm()); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			os.Remove(target)
+			if err = os.Symlink(link, target); err != nil {
+				return err
+			}
+		default:
+			log.Warn("Skipping special file " + path)
+			return nil
+		}
+
+		st := info.Sys().(*syscall.Stat_t)
+		if err = os.Lchown(target, shift(int(st.Uid), from, to), shift(int(st.Gid), from, to)); err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			if err = os.Chmod(target, info.Mode()); err != nil {
+				return err
+			}
+			return os.Chtimes(target, info.ModTime(), info.ModTime())
+		}
+		return nil
+	})
+}
+
+func cpFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// cpTar writes tar archive of the source with ownership of the container user namespace
+func cpTar(from cpEndpoint, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	parent := filepath.Dir(from.path)
+	err := filepath.Walk(from.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		} else if !info.Mode().IsDir() && !info.Mode().IsRegular() {
+			log.Warn("Skipping special file " + path)
+			return nil
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		if hdr.Name, err = filepath.Rel(parent, path); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		st := info.Sys().(*syscall.Stat_t)
+		hdr.Uid, hdr.Gid = shift(int(st.Uid), from, cpEndpoint{}), shift(int(st.Gid), from, cpEndpoint{})
+		hdr.Uname, hdr.Gname = "", ""
+		if err = tw.WriteHeader(hdr); err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return errors.New("finishing archive: " + err.Error())
+	}
+	return nil
+}
@@ -18,7 +18,7 @@ import (
 // Demoted container will use NAT network interface and dynamic IP address if opposite options are not specified.
 func LxcDemote(name, ip, vlan string) {
 	if !container.IsTemplate(name) {
-		log.Error("Container " + name + " is not a template")
+		log.ErrorCode(log.ExitNotFound, "Container "+name+" is not a template")
 	}
 
 	netConf(name, ip, vlan)
@@ -29,12 +29,11 @@ func LxcDemote(name, ip, vlan string) {
 
 // netConf sets default values for container network
 func netConf(name, ip, vlan string) {
-	container.SetContainerConf(name, [][]string{
+	log.Check(log.ErrorLevel, "Setting network configuration", container.SetContainerConf(name, [][]string{
 		{"lxc.network.ipv4", ip},
 		{"lxc.network.link", ""},
 		{"lxc.network.veth.pair", strings.Replace(container.GetConfigItem(config.Agent.LxcPrefix+name+"/config", "lxc.network.hwaddr"), ":", "", -1)},
 		{"lxc.network.script.up", config.Agent.AppPrefix + "bin/create_ovs_interface"},
 		{"#vlan_id", vlan},
-	})
-	return
+	}))
 }
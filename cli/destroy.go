@@ -25,7 +25,7 @@ import (
 func LxcDestroy(id string, vlan bool) {
 	var msg string
 	if len(id) == 0 {
-		log.Error("Please specify container/template name or vlan id")
+		log.ErrorCode(log.ExitUsage, "Please specify container/template name or vlan id")
 	}
 
 	if strings.HasPrefix(id, "id:") {
@@ -47,41 +47,8 @@ func LxcDestroy(id string, vlan bool) {
 		}
 		cleanupNet(id)
 	} else if id != "everything" {
-		bolt, err := db.New()
-		log.Check(log.WarnLevel, "Opening database", err)
-		log.Debug("Obtaining container by name")
-		c := bolt.ContainerByName(id)
-		log.Check(log.WarnLevel, "Closing database", bolt.Close())
-
+		log.Check(log.ErrorLevel, "Destroying container", Destroy(id))
 		msg = id + " is destroyed"
-
-		if len(c) != 0 {
-
-			if ip, ok := c["ip"]; ok {
-				if vlan, ok := c["vlan"]; ok {
-					ProxyDel(vlan, ip, false)
-				}
-			}
-
-			removePortMap(id)
-
-			net.DelIface(c["interface"])
-
-			log.Check(log.ErrorLevel, "Destroying container", container.DestroyContainer(id))
-
-		} else if container.IsTemplate(id) {
-
-			container.DestroyTemplate(id)
-		} else {
-
-			err = container.DestroyContainer(id)
-
-			log.Check(log.ErrorLevel, "Destroying container", err)
-		}
-
-		if _, found := getTemplateInfoFromCacheByName(id); found {
-			container.DeleteTemplateInfoFromCache(id)
-		}
 	}
 
 	if id == "everything" {
@@ -115,6 +82,47 @@ func LxcDestroy(id string, vlan bool) {
 	log.Info(msg)
 }
 
+// Destroy removes the container or template by name along with its proxy entries, port mappings and network interface.
+// Unlike LxcDestroy, it returns the error instead of exiting, so it may be used for several containers in a row.
+func Destroy(name string) error {
+	bolt, err := db.New()
+	log.Check(log.WarnLevel, "Opening database", err)
+	log.Debug("Obtaining container by name")
+	c := bolt.ContainerByName(name)
+	log.Check(log.WarnLevel, "Closing database", bolt.Close())
+
+	if len(c) != 0 {
+
+		if ip, ok := c["ip"]; ok {
+			if vlan, ok := c["vlan"]; ok {
+				ProxyDel(vlan, ip, false)
+			}
+		}
+
+		removePortMap(name)
+
+		net.DelIface(c["interface"])
+
+		err = container.DestroyContainer(name)
+
+	} else if container.IsTemplate(name) {
+
+		container.DestroyTemplate(name)
+		err = nil
+	} else {
+
+		err = container.DestroyContainer(name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, found := getTemplateInfoFromCacheByName(name); found {
+		container.DeleteTemplateInfoFromCache(name)
+	}
+	return nil
+}
+
 func cleanupNet(id string) {
 	net.DelIface("gw-" + id)
 	p2p.RemoveByIface("p2p" + id)
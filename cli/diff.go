@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/log"
+)
+
+// diffItem is the structured output schema of the diff command:
+//	volume, subvolume of the container: rootfs, home, opt or var
+//	change, added, modified or deleted
+//	path, absolute path of the file inside the container
+type diffItem struct {
+	Volume string `json:"volume"`
+	Change string `json:"change"`
+	Path   string `json:"path"`
+}
+
+// LxcDiff shows files of the Subutai container which were added, modified or deleted since it was cloned from its parent template.
+// Subvolumes rootfs, home, opt and var are compared separately, file ownership and permissions are ignored.
+// Paths limit the output to the files under the passed container paths, shell patterns like /etc/*.conf are supported as well.
+// With "json" option the changes are printed in json format.
+func LxcDiff(name string, paths []string, json bool) {
+	if !container.IsContainer(name) {
+		log.ErrorCode(log.ExitNotFound, name+" is not a container")
+	}
+	parent := container.GetParent(name)
+	if parent == "" || !container.IsTemplate(parent) {
+		log.ErrorCode(log.ExitNotFound, "Parent template of "+name+" not found")
+	}
+	if json {
+		SetFormat("json")
+	}
+
+	items := []diffItem{}
+	for _, vol := range []string{"rootfs", "home", "opt", "var"} {
+		root := "/"
+		if vol != "rootfs" {
+			root = "/" + vol + "/"
+		}
+		src := config.Agent.LxcPrefix + name + "/" + vol + "/"
+		dst := config.Agent.LxcPrefix + parent + "/" + vol + "/"
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+		for _, c := range fileChanges(src, dst) {
+			// rsync prints symlink targets after the name
+			path := strings.TrimSuffix(root+strings.SplitN(c[1], " -> ", 2)[0], "/")
+			// directory times change with their content, so only added and deleted directories are reported
+			if c[0] == "modified" && strings.HasSuffix(c[1], "/") {
+				continue
+			}
+			if vol == "rootfs" && diffMountpoint(path) {
+				continue
+			}
+			if diffMatch(path, paths) {
+				items = append(items, diffItem{Volume: vol, Change: c[0], Path: path})
+			}
+		}
+	}
+
+	output(items, func() {
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+		fmt.Fprintln(w, "VOLUME\tCHANGE\tPATH")
+		fmt.Fprintln(w, "------\t------\t----")
+		for _, i := range items {
+			fmt.Fprintln(w, i.Volume+"\t"+i.Change+"\t"+i.Path)
+		}
+		w.Flush()
+	})
+}
+
+// diffMountpoint returns true for the content of home, opt and var directories of the rootfs, which is hidden by the bind mounted subvolumes
+func diffMountpoint(path string) bool {
+	for _, vol := range []string{"/home/", "/opt/", "/var/"} {
+		if strings.HasPrefix(path, vol) {
+			return true
+		}
+	}
+	return false
+}
+
+// diffMatch checks if the path is under one of the filter paths or matches one of the filter patterns, empty filter matches every path
+func diffMatch(path string, filters []string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, f := range filters {
+		f = filepath.Clean("/" + f)
+		if f == "/" || path == f || strings.HasPrefix(path, f+"/") {
+			return true
+		}
+		if ok, _ := filepath.Match(f, path); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,294 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/subutai-io/agent/agent/health"
+	"github.com/subutai-io/agent/db"
+	"github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/log"
+)
+
+// envItem is the structured output schema of the env list and status:
+//	name, container name
+//	vlan, VLAN tag of the container network
+//	environment, environment id
+//	ip, container IP address
+//	state, container state
+//	health, health check status if configured
+type envItem struct {
+	Name        string `json:"name"`
+	Vlan        string `json:"vlan"`
+	Environment string `json:"environment"`
+	IP          string `json:"ip"`
+	State       string `json:"state"`
+	Health      string `json:"health,omitempty"`
+}
+
+// envResult is the structured output schema of the env start, stop, restart and destroy and of the --selector operations:
+//	name, container name
+//	operation, executed operation
+//	result, ok, failed or skipped if container dependency failed
+//	exitcode, exit code of the operation
+//	output, error message of the failed operation
+type envResult struct {
+	Name      string `json:"name"`
+	Operation string `json:"operation"`
+	Result    string `json:"result"`
+	ExitCode  int    `json:"exitcode"`
+	Output    string `json:"output,omitempty"`
+}
+
+// EnvList shows containers of the environment with their network settings and state.
+// Environment may be specified either by environment id or by VLAN tag of the environment network.
+func EnvList(id string) {
+	items := envItems(id)
+	output(items, func() {
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+		fmt.Fprintln(w, "NAME\tVLAN\tENVIRONMENT\tIP\tSTATE")
+		fmt.Fprintln(w, "----\t----\t-----------\t--\t-----")
+		for _, item := range items {
+			fmt.Fprintln(w, item.Name+"\t"+item.Vlan+"\t"+item.Environment+"\t"+item.IP+"\t"+item.State)
+		}
+		w.Flush()
+	})
+}
+
+// EnvStatus shows state and health of the environment containers.
+func EnvStatus(id string) {
+	items := envItems(id)
+	output(items, func() {
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+		fmt.Fprintln(w, "NAME\tSTATE\tHEALTH")
+		fmt.Fprintln(w, "----\t-----\t------")
+		for _, item := range items {
+			status := item.Health
+			if status == "" {
+				status = "n/a"
+			}
+			fmt.Fprintln(w, item.Name+"\t"+item.State+"\t"+status)
+		}
+		w.Flush()
+	})
+}
+
+// EnvStart starts all containers of the environment.
+// Containers are started in order of their start dependencies, up to parallel containers at a time;
+// containers which dependencies failed to start are skipped. Command exits with non-zero code if any container failed.
+func EnvStart(id string, parallel int) {
+	envSummary(envStart(envMembers(id), parallel))
+}
+
+// EnvStop stops all containers of the environment in reverse order of their start dependencies.
+func EnvStop(id string, parallel int) {
+	envSummary(envStop(envMembers(id), parallel))
+}
+
+// EnvRestart stops and then starts all containers of the environment respecting start dependencies.
+func EnvRestart(id string, parallel int) {
+	members := envMembers(id)
+	results := envStop(members, parallel)
+	failed := false
+	for _, r := range results {
+		if r.Result != "ok" {
+			failed = true
+		}
+	}
+	if !failed {
+		results = append(results, envStart(members, parallel)...)
+	}
+	envSummary(results)
+}
+
+// EnvDestroy destroys all containers of the environment.
+// Network resources of environment VLANs are cleaned up when no containers are left in them.
+func EnvDestroy(id string, parallel int) {
+	members := envMembers(id)
+
+	bolt, err := db.New()
+	log.Check(log.WarnLevel, "Opening database", err)
+	vlans := make(map[string]bool)
+	for _, name := range members {
+		if vlan := bolt.ContainerByName(name)["vlan"]; vlan != "" {
+			vlans[vlan] = true
+		}
+	}
+	log.Check(log.WarnLevel, "Closing database", bolt.Close())
+
+	results := envRun("destroy", members, parallel)
+
+	bolt, err = db.New()
+	log.Check(log.WarnLevel, "Opening database", err)
+	for vlan := range vlans {
+		if len(bolt.ContainerByKey("vlan", vlan)) == 0 {
+			cleanupNet(vlan)
+		}
+	}
+	log.Check(log.WarnLevel, "Closing database", bolt.Close())
+
+	envSummary(results)
+}
+
+// envMembers returns sorted list of existing containers belonging to the environment with specified id or VLAN
+func envMembers(id string) []string {
+	bolt, err := db.New()
+	log.Check(log.ErrorLevel, "Opening database", err)
+	list := append(bolt.ContainerByKey("environment", id), bolt.ContainerByKey("vlan", id)...)
+	log.Check(log.WarnLevel, "Closing database", bolt.Close())
+
+	var members []string
+	for _, name := range list {
+		if !stringInList(name, members) && container.IsContainer(name) {
+			members = append(members, name)
+		}
+	}
+	if len(members) == 0 {
+		log.ErrorCode(log.ExitNotFound, "Environment "+id+" not found")
+	}
+	sort.Strings(members)
+	return members
+}
+
+// envItems collects information about environment containers
+func envItems(id string) []envItem {
+	members := envMembers(id)
+
+	bolt, err := db.New()
+	log.Check(log.WarnLevel, "Opening database", err)
+	defer bolt.Close()
+
+	items := []envItem{}
+	for _, name := range members {
+		meta := bolt.ContainerByName(name)
+		item := envItem{Name: name, Vlan: meta["vlan"], Environment: meta["environment"], IP: meta["ip"], State: container.State(name)}
+		if item.State == "RUNNING" {
+			item.Health = health.Status(name)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// envStart starts containers level by level, skipping containers with failed dependencies
+func envStart(members []string, parallel int) (results []envResult) {
+	levels, cycle := container.Order(members)
+	if len(cycle) > 0 {
+		log.Warn("Cyclic start dependencies between " + strings.Join(cycle, ", ") + ", starting them last")
+		levels = append(levels, cycle)
+	}
+
+	failed := make(map[string]bool)
+	for _, level := range levels {
+		var list []string
+		for _, name := range level {
+			skip := false
+			for _, dep := range container.StartAfter(name) {
+				if failed[dep] {
+					skip = true
+				}
+			}
+			if skip {
+				failed[name] = true
+				results = append(results, envResult{Name: name, Operation: "start", Result: "skipped", Output: "dependency failed"})
+				continue
+			}
+			list = append(list, name)
+		}
+		delay := 0
+		for _, r := range envRun("start", list, parallel) {
+			if r.Result != "ok" {
+				failed[r.Name] = true
+			} else if d := container.StartDelay(r.Name); d > delay {
+				delay = d
+			}
+			results = append(results, r)
+		}
+		time.Sleep(time.Second * time.Duration(delay))
+	}
+	return
+}
+
+// envStop stops containers level by level in reverse start order
+func envStop(members []string, parallel int) (results []envResult) {
+	levels, cycle := container.Order(members)
+	if len(cycle) > 0 {
+		levels = append(levels, cycle)
+	}
+	for i := len(levels) - 1; i >= 0; i-- {
+		results = append(results, envRun("stop", levels[i], parallel)...)
+	}
+	return
+}
+
+// envOperations are the container operations of the environment commands, executed in the agent process
+var envOperations = map[string]func(name string) error{
+	"start": func(name string) error {
+		if container.State(name) != "STOPPED" {
+			return nil
+		}
+		return startContainer(name)
+	},
+	"stop": func(name string) error {
+		if container.State(name) != "RUNNING" {
+			return nil
+		}
+		return stopContainer(name)
+	},
+	"destroy": Destroy,
+}
+
+// envRun executes the operation for each container, up to parallel operations at a time
+func envRun(operation string, list []string, parallel int) []envResult {
+	if parallel < 1 {
+		parallel = 1
+	}
+	results := make([]envResult, len(list))
+	sem := make(chan bool, parallel)
+	var wg sync.WaitGroup
+	for i, name := range list {
+		wg.Add(1)
+		sem <- true
+		go func(i int, name string) {
+			defer func() { <-sem; wg.Done() }()
+			results[i] = envResult{Name: name, Operation: operation, Result: "ok"}
+			if err := envOperations[operation](name); err != nil {
+				results[i].Result, results[i].ExitCode, results[i].Output = "failed", log.ExitFailure, err.Error()
+			}
+		}(i, name)
+	}
+	wg.Wait()
+	return results
+}
+
+// envSummary prints results of the environment operation and exits with error if any container failed
+func envSummary(results []envResult) {
+	failed := 0
+	for _, r := range results {
+		if r.Result != "ok" {
+			failed++
+		}
+	}
+
+	output(results, func() {
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+		fmt.Fprintln(w, "NAME\tOPERATION\tRESULT\tOUTPUT")
+		fmt.Fprintln(w, "----\t---------\t------\t------")
+		for _, r := range results {
+			fmt.Fprintln(w, r.Name+"\t"+r.Operation+"\t"+r.Result+"\t"+strings.Replace(r.Output, "\n", " ", -1))
+		}
+		w.Flush()
+	})
+
+	if failed > 0 {
+		os.Exit(log.ExitFailure)
+	}
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/subutai-io/agent/lib/event"
+)
+
+// Events prints events recorded for the container, or for all containers if name is empty.
+// Events are kept in the agent database, so they are available after the container is destroyed; only the latest event.History events are kept. Event types:
+//	oom, processes of the container were killed by OOM killer after reaching memory quota
+//	throttle, container started hitting its CPU quota
+//	start, stop, freeze, unfreeze, lifecycle changes made by CLI operations or detected by the daemon
+//	clone, destroy, restore, container was created, removed or restored from checkpoint, backup or snapshot
+//	expire, TTL of the container expired or ephemeral container stopped, the container is destroyed next
+// Structured output contains id, container, time, type and details of each event.
+// In follow mode the command keeps printing new events as they are recorded; structured formats print each event as a separate document.
+func Events(name string, follow bool) {
+	last := event.Last()
+	list := event.List(name, 0)
+	if list == nil {
+		list = []event.Event{}
+	}
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	if !follow {
+		output(list, func() {
+			printEvents(w, list, true)
+		})
+		return
+	}
+
+	for header := true; ; header = false {
+		for _, e := range list {
+			if e.ID > last {
+				last = e.ID
+			}
+			if Format != "table" {
+				output(e, nil)
+			}
+		}
+		if Format == "table" {
+			printEvents(w, list, header)
+		}
+		time.Sleep(time.Second)
+		list = event.List(name, last)
+	}
+}
+
+// printEvents prints events table rows, optionally preceded by the header
+func printEvents(w *tabwriter.Writer, list []event.Event, header bool) {
+	if header {
+		fmt.Fprintln(w, "TIME\tCONTAINER\tTYPE\tDETAILS")
+		fmt.Fprintln(w, "----\t---------\t----\t-------")
+	}
+	for _, e := range list {
+		fmt.Fprintln(w, e.Time.Format(time.RFC3339)+"\t"+e.Container+"\t"+e.Type+"\t"+e.Details)
+	}
+	w.Flush()
+}
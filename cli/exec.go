@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"os"
+	"strings"
+
+	"github.com/subutai-io/agent/agent/container"
+	"github.com/subutai-io/agent/agent/executer"
+	lxcContainer "github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/log"
+)
+
+// LxcExec executes a command inside the running Subutai container non-interactively and exits with the command's exit code.
+//
+// Unlike attach, the command can be executed as any container user (`--user`), in a specified working directory (`--cwd`)
+// and with additional environment variables (`--env KEY=VALUE`). Standard output and error of the command are streamed separately.
+// With `--timeout` the command is terminated after specified number of seconds and exit code 124 is returned.
+// Standard input is connected to the command only if `--stdin` option is set, otherwise the command reads nothing from input.
+// With `--tty` a pseudo-terminal is allocated for the command and connected to standard input and output, so interactive programs
+// may be run; standard output and error are not separated in this mode.
+//
+// A single command argument is interpreted by bash, so it may contain pipes and redirections; multiple arguments are quoted and executed as is.
+func LxcExec(name string, cmd []string, user, cwd string, env []string, timeout int, interactive, tty bool) {
+	if !lxcContainer.IsContainer(name) {
+		log.ErrorCode(log.ExitNotFound, name+" is not a container")
+	}
+	if lxcContainer.State(name) != "RUNNING" {
+		log.Error("Container " + name + " is not running")
+	}
+	if len(cmd) == 0 {
+		log.ErrorCode(log.ExitUsage, "Please specify command")
+	}
+
+	if user == "" {
+		user = "root"
+	}
+	home := "/root"
+	if user != "root" {
+		if uid, _ := container.Credentials(user, name); uid == 0 {
+			log.ErrorCode(log.ExitNotFound, "User "+user+" not found in container "+name)
+		}
+		home = "/home/" + user
+	}
+	if cwd == "" {
+		cwd = "/"
+	}
+
+	environment := map[string]string{"USER": user, "HOME": home}
+	for _, v := range env {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			log.ErrorCode(log.ExitUsage, "Invalid environment variable \""+v+"\", expected KEY=VALUE")
+		}
+		environment[kv[0]] = kv[1]
+	}
+
+	command := cmd[0]
+	if len(cmd) > 1 {
+		var quoted []string
+		for _, arg := range cmd {
+			quoted = append(quoted, "'"+strings.Replace(arg, "'", `'\''`, -1)+"'")
+		}
+		command = strings.Join(quoted, " ")
+	}
+
+	req := executer.RequestOptions{
+		Command:     command,
+		RunAs:       user,
+		WorkingDir:  cwd,
+		Environment: environment,
+		Timeout:     timeout,
+	}
+	var code int
+	var err error
+	if tty {
+		code, err = executer.AttachTerminal(name, req, os.Stdin, os.Stdout)
+	} else {
+		stdin := os.Stdin
+		if !interactive {
+			null, err := os.Open(os.DevNull)
+			log.Check(log.ErrorLevel, "Opening "+os.DevNull, err)
+			defer null.Close()
+			stdin = null
+		}
+		code, err = executer.AttachStream(name, req, stdin, os.Stdout, os.Stderr)
+	}
+	log.Check(log.ErrorLevel, "Executing command in container "+name, err)
+
+	os.Exit(code)
+}
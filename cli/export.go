@@ -39,7 +39,7 @@ var (
 //TODO update doco on site for export, import,clone
 func LxcExport(name, version, prefsize, token, description string, private bool, local bool) {
 	if token == "" {
-		log.Error("Missing CDN token")
+		log.ErrorCode(log.ExitUsage, "Missing CDN token")
 	}
 
 	owner := getOwner(token)
@@ -60,7 +60,7 @@ func LxcExport(name, version, prefsize, token, description string, private bool,
 	// check: parent is template
 	parent := container.GetParent(name)
 	if !container.IsTemplate(parent) {
-		log.Error("Parent " + parent + " is not a template")
+		log.ErrorCode(log.ExitNotFound, "Parent "+parent+" is not a template")
 	}
 
 	if !container.IsTemplate(name) {
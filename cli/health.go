@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/subutai-io/agent/agent/health"
+	"github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/log"
+)
+
+// healthItem is the structured output schema of the health command:
+//	name, container name
+//	type, health check type, empty if the container has no health check
+//	check, check target: command, port or port and path
+//	interval, timeout, check interval and timeout in seconds
+//	retries, number of consecutive failures making the container unhealthy
+//	restart, restart policy
+//	status, health status: starting, healthy, unhealthy or n/a if the container is not running
+type healthItem struct {
+	Name     string `json:"name"`
+	Type     string `json:"type,omitempty"`
+	Check    string `json:"check,omitempty"`
+	Interval int    `json:"interval,omitempty"`
+	Timeout  int    `json:"timeout,omitempty"`
+	Retries  int    `json:"retries,omitempty"`
+	Restart  string `json:"restart,omitempty"`
+	Status   string `json:"status,omitempty"`
+}
+
+// LxcHealth configures health check of the Subutai container or prints its current health status.
+// Supported check types:
+//	exec, command executed inside the container, zero exit code means healthy
+//	tcp, container port which should accept connections
+//	http, container port and path which should respond with 2xx or 3xx status, e.g. 8080/status
+// Interval, timeout and retries are set in seconds and attempts respectively; the container becomes unhealthy after retries consecutive failures.
+// If restart policy "unhealthy" is set, the daemon restarts unhealthy containers. Port mapping backends of unhealthy containers are disabled until they recover.
+// Check type "none" removes the health check from the container.
+func LxcHealth(name, kind, check, restart string, interval, timeout, retries int) {
+	if !container.IsContainer(name) {
+		log.ErrorCode(log.ExitNotFound, name+" is not a container")
+	}
+
+	if kind == "" && restart == "" {
+		item := healthItem{Name: name}
+		if c := health.Get(name); c.Type != "" {
+			item = healthItem{Name: name, Type: c.Type, Check: c.Target, Interval: c.Interval, Timeout: c.Timeout, Retries: c.Retries,
+				Restart: c.Restart, Status: health.Status(name)}
+			if container.State(name) != "RUNNING" || item.Status == "" {
+				item.Status = "n/a"
+			}
+		}
+		output(item, func() {
+			if item.Type == "" {
+				fmt.Println(name + " has no health check")
+				return
+			}
+			fmt.Printf("%s\t%s %s\tinterval %ds, timeout %ds, retries %d\t%s\n", name, item.Type, item.Check, item.Interval, item.Timeout, item.Retries, item.Status)
+		})
+		return
+	}
+
+	var conf [][]string
+	switch kind {
+	case "":
+	case "none":
+		conf = [][]string{{"subutai.health.type", ""}, {"subutai.health.check", ""},
+			{"subutai.health.interval", ""}, {"subutai.health.timeout", ""}, {"subutai.health.retries", ""}}
+	case "exec", "tcp", "http":
+		if check == "" {
+			log.ErrorCode(log.ExitUsage, "Health check target is not specified")
+		}
+		conf = [][]string{{"subutai.health.type", kind}, {"subutai.health.check", check}}
+		for k, v := range map[string]int{"interval": interval, "timeout": timeout, "retries": retries} {
+			if v > 0 {
+				conf = append(conf, []string{"subutai.health." + k, strconv.Itoa(v)})
+			}
+		}
+	default:
+		log.ErrorCode(log.ExitUsage, "Unsupported health check type "+kind)
+	}
+
+	switch restart {
+	case "":
+	case "no", "none":
+		conf = append(conf, []string{"subutai.restart", ""})
+	case "unhealthy":
+		conf = append(conf, []string{"subutai.restart", restart})
+	default:
+		log.ErrorCode(log.ExitUsage, "Unsupported restart policy "+restart)
+	}
+
+	log.Check(log.ErrorLevel, "Setting health check", container.SetContainerConf(name, conf))
+	log.Info("Health check of " + name + " updated")
+}
@@ -15,7 +15,7 @@ import (
 // LxcHostname command changes container configs to apply a new name for the container. Used for internal SS purposes.
 func LxcHostname(c, name string) {
 	if !container.ContainerOrTemplateExists(c) || container.IsTemplate(c) {
-		log.Error(c + " is not an container")
+		log.ErrorCode(log.ExitNotFound, c+" is not an container")
 		return
 	}
 
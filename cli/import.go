@@ -2,8 +2,10 @@ package cli
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"os"
@@ -21,15 +23,12 @@ import (
 	"github.com/subutai-io/agent/lib/template"
 	"github.com/subutai-io/agent/log"
 	"github.com/subutai-io/agent/agent/utils"
+	"github.com/subutai-io/agent/agent/registry"
 	"github.com/mcuadros/go-version"
 	"github.com/subutai-io/agent/lib/fs"
 	"runtime"
 )
 
-var (
-	owners = []string{"subutai", "jenkins", "docker", ""}
-)
-
 type templ struct {
 	Name      string            `json:"name"`
 	File      string            `json:"file"`
@@ -37,112 +36,57 @@ type templ struct {
 	Branch    string            `json:"branch"`
 	Id        string            `json:"id"`
 	Md5       string            `json:"md5"`
+	Sha256    string            `json:"sha256,omitempty"`
 	Owner     []string          `json:"owner"`
 	Signature map[string]string `json:"signature"`
+	Source    string            `json:"source,omitempty"`
 }
 
-type metainfo struct {
-	ID      string            `json:"id"`
-	Name    string            `json:"name"`
-	Owner   []string          `json:"owner"`
-	Version string            `json:"version"`
-	File    string            `json:"filename"`
-	Signs   map[string]string `json:"signature"`
-	Hash struct {
-		Md5    string
-		Sha256 string
-	} `json:"hash"`
-}
-
-// getTemplateInfoById retrieves template name from global repository by passed id string
-func getTemplateInfoById(t *templ, id string, token string) {
-	//Since only kurjun knows template's ID, we cannot define if we have template already installed in system by ID as we do it by name, so unreachable kurjun in this case is a deadend for us
-	//To omit this issue we should add ID into template config and use this ID as a "primary key" to any request
-	url := config.CDN.Kurjun + "/template/info?id=" + id + "&token=" + token
-
-	kurjun := utils.GetClient(config.CDN.Allowinsecure, 15)
-	response, err := kurjun.Get(url)
-	log.Check(log.ErrorLevel, "Retrieving template info, get: "+url, err)
-	defer utils.Close(response)
+// getTemplateInfoFromSources looks the template up by id or by name, owner and version in the template sources in the configured order
+func getTemplateInfoFromSources(t *templ, id, name, owner, version, token string) {
+	failed := false
+	for _, src := range template.Sources() {
+		m, err := src.Info(id, name, owner, version, token)
+		if err == template.ErrNotFound {
+			log.Debug("Template not found in " + src.String())
+			continue
+		}
+		if log.Check(log.WarnLevel, "Retrieving template info from "+src.String(), err) {
+			failed = true
+			continue
+		}
+		if len(m.Owner) == 0 {
+			log.Warn("Template " + m.Name + " in " + src.String() + " has no owner")
+			continue
+		}
 
-	if response.StatusCode == 404 {
-		log.Error("Template " + t.Name + " not found")
-	}
-	if response.StatusCode != 200 {
-		log.Error("Failed to get template info:  " + response.Status)
+		t.Name = m.Name
+		t.Owner = m.Owner
+		t.Version = m.Version
+		t.Id = m.ID
+		t.File = m.File
+		t.Md5 = m.Hash.Md5
+		t.Sha256 = m.Hash.Sha256
+		t.Signature = m.Signs
+		t.Source = src.String()
+
+		log.Debug("Template identified as " + t.Name + "@" + t.Owner[0] + ":" + t.Version + " in " + t.Source)
+		return
 	}
 
-	body, err := ioutil.ReadAll(response.Body)
-	log.Check(log.ErrorLevel, "Reading template info, get: "+url, err)
-
-	var meta []metainfo
-	if log.Check(log.WarnLevel, "Parsing response body", json.Unmarshal(body, &meta)) || len(meta) == 0 {
-		log.Error("Failed to parse template info")
+	if failed {
+		log.Error("Failed to get template info")
 	}
-
-	t.Name = meta[0].Name
-	t.Owner = meta[0].Owner
-	t.Version = meta[0].Version
-	t.Id = meta[0].ID
-	t.File = meta[0].File
-	t.Md5 = meta[0].Hash.Md5
-	t.Signature = meta[0].Signs
-
-	log.Debug("Template identified as " + t.Name + "@" + t.Owner[0] + ":" + t.Version)
+	log.ErrorCode(log.ExitNotFound, "Template "+name+id+" not found")
 }
 
-//TODO urlEncode the kurjun URL
-func getTemplateInfoByName(t *templ, name string, owner string, version string, token string) {
-	//Since only kurjun knows template's ID, we cannot define if we have template already installed in system by ID as we do it by name, so unreachable kurjun in this case is a deadend for us
-	//To omit this issue we should add ID into template config and use this ID as a "primary key" to any request
-
-	url := config.CDN.Kurjun + "/template/info?name=" + name
-
-	if owner != "" {
-		url += "&owner=" + owner
-	} else if token == "" {
-		url += "&verified=true"
-	}
-
-	if version == "" {
-		url += "&version=latest"
-	} else {
-		url += "&version=" + version
-	}
-
-	if token != "" {
-		url += "&token=" + token
-	}
-
-	kurjun := utils.GetClient(config.CDN.Allowinsecure, 15)
-	response, err := kurjun.Get(url)
-	log.Check(log.ErrorLevel, "Retrieving template info, get: "+url, err)
-	defer utils.Close(response)
-
-	if response.StatusCode == 404 {
-		log.Error("Template " + t.Name + " not found")
-	}
-	if response.StatusCode != 200 {
-		log.Error("Failed to get template info:  " + response.Status)
-	}
-
-	body, err := ioutil.ReadAll(response.Body)
-	log.Check(log.ErrorLevel, "Reading template info, get: "+url, err)
-
-	var meta []metainfo
-	if log.Check(log.WarnLevel, "Parsing response body", json.Unmarshal(body, &meta)) || len(meta) == 0 {
-		log.Error("Failed to parse template info")
+// sourceOf returns template source the template info was retrieved from, info cached by older agents came from CDN
+func sourceOf(t templ) template.Source {
+	if src, err := template.ParseSource(t.Source); err == nil {
+		return src
 	}
-
-	t.Name = meta[0].Name
-	t.Owner = meta[0].Owner
-	t.Version = meta[0].Version
-	t.Id = meta[0].ID
-	t.File = meta[0].File
-	t.Md5 = meta[0].Hash.Md5
-	t.Signature = meta[0].Signs
-
-	log.Debug("Template identified as " + t.Name + "@" + t.Owner[0] + ":" + t.Version)
+	src, _ := template.ParseSource("cdn")
+	return src
 }
 
 func getTemplateInfoFromCacheById(templateId string) (templ, bool) {
@@ -190,12 +134,10 @@ func getTemplateInfo(template string, kurjToken string) templ {
 		templateId := id[1]
 
 		if t, found := getTemplateInfoFromCacheById(templateId); found {
-			return t
+			return verifyCached(t)
 		}
 
-		utils.CheckCDN()
-
-		getTemplateInfoById(&t, templateId, kurjToken)
+		getTemplateInfoFromSources(&t, templateId, "", "", "", kurjToken)
 
 	} else {
 
@@ -207,39 +149,33 @@ func getTemplateInfo(template string, kurjToken string) templ {
 
 			if t, found := getTemplateInfoFromCacheByName(groups["name"]); found {
 				if t.Name == groups["name"] && t.Owner[0] == groups["owner"] && t.Version == groups["version"] {
-					return t
+					return verifyCached(t)
 				}
 			}
 
-			utils.CheckCDN()
-
-			getTemplateInfoByName(&t, groups["name"], groups["owner"], groups["version"], kurjToken)
+			getTemplateInfoFromSources(&t, "", groups["name"], groups["owner"], groups["version"], kurjToken)
 		} else if templateNameNOwnerRx.MatchString(template) {
 			groups := utils.MatchRegexGroups(templateNameNOwnerRx, template)
 
 			if t, found := getTemplateInfoFromCacheByName(groups["name"]); found {
 				if t.Name == groups["name"] && t.Owner[0] == groups["owner"] {
-					return t
+					return verifyCached(t)
 				}
 			}
 
-			utils.CheckCDN()
-
-			getTemplateInfoByName(&t, groups["name"], groups["owner"], "", kurjToken)
+			getTemplateInfoFromSources(&t, "", groups["name"], groups["owner"], "", kurjToken)
 		} else if templateNameRx.MatchString(template) {
 			groups := utils.MatchRegexGroups(templateNameRx, template)
 
 			if t, found := getTemplateInfoFromCacheByName(groups["name"]); found {
 				if t.Name == groups["name"] {
-					return t
+					return verifyCached(t)
 				}
 			}
 
-			utils.CheckCDN()
-
-			getTemplateInfoByName(&t, groups["name"], "", "", kurjToken)
+			getTemplateInfoFromSources(&t, "", groups["name"], "", "", kurjToken)
 		} else {
-			log.Error("Invalid template name " + template)
+			log.ErrorCode(log.ExitUsage, "Invalid template name "+template)
 		}
 
 	}
@@ -251,19 +187,41 @@ func getTemplateInfo(template string, kurjToken string) templ {
 	return t
 }
 
+// verifyCached checks signature of the template info found in the local cache if signature policy is "enforce",
+// so templates imported under weaker policy are refused as well
+func verifyCached(t templ) templ {
+	if template.Policy() == template.PolicyEnforce {
+		verifySignature(t)
+	}
+	return t
+}
+
+// verifyHash checks the archive against SHA256 hash sum of the template, MD5 hash sum is checked if the source doesn't provide SHA256 one
+func verifyHash(t templ, filePath string) bool {
+	if t.Sha256 != "" {
+		return t.Sha256 == hashsum(filePath, sha256.New())
+	}
+	log.Debug("SHA256 hash sum of " + t.Name + " is unknown, checking MD5")
+	return t.Md5 != "" && t.Md5 == md5sum(filePath)
+}
+
 // md5sum returns MD5 hash sum of specified file
 func md5sum(filePath string) string {
+	return hashsum(filePath, md5.New())
+}
+
+// hashsum returns hash sum of specified file
+func hashsum(filePath string, h hash.Hash) string {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return ""
 	}
 	defer file.Close()
 
-	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
+	if _, err := io.Copy(h, file); err != nil {
 		return ""
 	}
-	return fmt.Sprintf("%x", hash.Sum(nil))
+	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
 func downloadWithRetry(t templ, token string, retry int) bool {
@@ -284,9 +242,11 @@ func downloadWithRetry(t templ, token string, retry int) bool {
 	return false
 }
 
-// download gets template archive from global repository
+// download gets template archive from the template source its info was retrieved from
 func download(t templ, token string) (bool, error) {
 
+	// archive may be a hard link to the registry cache, it must not be overwritten in place
+	os.Remove(config.Agent.LxcPrefix + "tmpdir/" + t.File)
 	out, err := os.Create(config.Agent.LxcPrefix + "tmpdir/" + t.File)
 	if err != nil {
 		log.Debug("Failed to create archive ", err)
@@ -294,25 +254,22 @@ func download(t templ, token string) (bool, error) {
 	}
 	defer out.Close()
 
-	client := utils.GetClientForUploadDownload()
-
-	url := config.CDN.Kurjun + "/template/download?id=" + t.Id + "&token=" + token
+	src := sourceOf(t)
+	log.Debug("Downloading template from " + src.String())
 
-	log.Debug("Template url " + url)
-
-	response, err := client.Get(url)
+	body, size, err := src.Open(templateMeta(t), token)
 	if err != nil {
-		log.Debug("Failed to connect to Kurjun ", err)
+		log.Debug("Failed to connect to "+src.String()+" ", err)
 		return false, err
 	}
-	defer utils.Close(response)
+	defer body.Close()
 
-	bar := pb.New(int(response.ContentLength)).SetUnits(pb.U_BYTES)
-	if response.ContentLength <= 0 {
+	bar := pb.New(int(size)).SetUnits(pb.U_BYTES)
+	if size <= 0 {
 		bar.NotPrint = true
 	}
 	bar.Start()
-	rd := bar.NewProxyReader(response.Body)
+	rd := bar.NewProxyReader(body)
 	defer bar.Finish()
 	_, err = io.Copy(out, rd)
 	if err != nil {
@@ -320,8 +277,7 @@ func download(t templ, token string) (bool, error) {
 		return false, err
 	}
 
-	hash := md5sum(config.Agent.LxcPrefix + "tmpdir/" + t.File)
-	if t.Md5 == hash {
+	if verifyHash(t, config.Agent.LxcPrefix+"tmpdir/"+t.File) {
 		return true, nil
 	}
 
@@ -358,9 +314,17 @@ func lockSubutai(file string) (lockfile.Lockfile, error) {
 // If Internet access is lost, or it is not possible to upload custom templates to the repository, the filesystem path `/var/snap/subutai/common/lxc/tmpdir/` could be used as local repository;
 // the import sub command checks this directory if a requested published template or the global repository is not available.
 //
+// Templates are looked up in the sources listed in "sources" option of [template] section of the agent config, in the listed order:
+// the global repository ("cdn"), other Kurjun compatible repositories such as template registry of a peer, plain HTTP mirrors and local or NFS directories
+// with index.json file, so hosts without Internet access may import templates from a mirror. Template name without owner selects templates of the owners
+// listed in "verified" option. Template signatures are not verified for sources listed in "trusted" option unless signature policy is "enforce".
+//
 // The import binding handles security checks to confirm the authenticity and integrity of templates. Besides using strict SSL connections for downloads,
-// it verifies the fingerprint and its checksum for each template: an MD5 hash sum signed with author's GPG key. Import executes different integrity and authenticity checks of the template
-// transparent to the user to protect system integrity from all possible risks related to template data transfers over the network.
+// it verifies the fingerprint and its checksum for each template: a SHA256 hash sum (MD5 for repositories not providing it) and the template id signed with author's GPG key.
+// Import executes different integrity and authenticity checks of the template transparent to the user to protect system integrity from all possible risks related to template data transfers over the network.
+// Owner keys are managed with "subutai trust" command, "policy" option of [template] section of the agent config controls how signatures are enforced:
+// "off", "warn", "verify" or "enforce". By default ("verify") unsigned templates and invalid signatures are refused, owner keys missing in the trust store
+// are taken from the CDN; "enforce" accepts only templates signed by a key from the trust store, "warn" reports failed checks without refusing the template.
 //
 // The repository supports public, group private (shared), and private files. Import without specifying a security token can only access public templates.
 //
@@ -383,6 +347,10 @@ func LxcImport(name, token string, local bool, auxDepList ...string) {
 		t = getTemplateInfo(t.Name, token)
 	}
 
+	if container.IsReserved(t.Name) {
+		log.ErrorCode(log.ExitUsage, t.Name+" is a reserved name")
+	}
+
 	log.Info("Importing " + t.Name)
 
 	var lock lockfile.Lockfile
@@ -452,6 +420,10 @@ func LxcImport(name, token string, local bool, auxDepList ...string) {
 	} else {
 
 		archiveExists = fs.FileExists(config.Agent.LxcPrefix + "tmpdir/" + t.File)
+		if !archiveExists && registry.Link(t.Id, config.Agent.LxcPrefix+"tmpdir/"+t.File) {
+			log.Debug("Template archive is taken from registry cache")
+			archiveExists = true
+		}
 	}
 
 	if archiveExists {
@@ -459,8 +431,7 @@ func LxcImport(name, token string, local bool, auxDepList ...string) {
 		log.Debug("Template archive is present in local cache")
 
 		if !local {
-			hash := md5sum(config.Agent.LxcPrefix + "tmpdir/" + t.File)
-			if t.Md5 == hash {
+			if verifyHash(t, config.Agent.LxcPrefix+"tmpdir/"+t.File) {
 
 				log.Debug("File integrity is verified")
 			} else {
@@ -470,6 +441,8 @@ func LxcImport(name, token string, local bool, auxDepList ...string) {
 				//make agent re-download verified template from CDN
 				archiveExists = false
 			}
+		} else if template.Policy() == template.PolicyEnforce {
+			log.ErrorCode(log.ExitPermission, "Local archive of "+t.Name+" is not signed, import is refused by signature policy")
 		} else {
 			log.Warn("Skipping file integrity verification since -local flag was passed")
 		}
@@ -487,21 +460,7 @@ func LxcImport(name, token string, local bool, auxDepList ...string) {
 	if !archiveExists {
 		log.Info("Downloading " + t.Name)
 
-		downloaded := false
-
-		if len(t.Owner) == 0 {
-			for _, owner := range owners {
-				if t.Owner = []string{owner}; len(owner) == 0 {
-					t.Owner = []string{}
-				}
-				if downloadWithRetry(t, token, 5) {
-					downloaded = true
-					break
-				}
-			}
-		}
-
-		if !downloaded && !downloadWithRetry(t, token, 5) {
+		if !downloadWithRetry(t, token, 5) {
 
 			log.Error("Failed to download or verify template " + t.Name)
 		} else {
@@ -533,14 +492,19 @@ func LxcImport(name, token string, local bool, auxDepList ...string) {
 
 	log.Info("Installing template " + t.Name)
 	template.Install(parent, t.Name)
+	_, err = container.MigrateConfig(config.Agent.LxcPrefix + t.Name + "/config")
+	log.Check(log.WarnLevel, "Migrating config of "+t.Name, err)
 	// TODO following lines kept for back compatibility with old templates, should be deleted when all templates will be replaced.
 	os.Rename(config.Agent.LxcPrefix+t.Name+"/"+t.Name+"-home", config.Agent.LxcPrefix+t.Name+"/home")
 	os.Rename(config.Agent.LxcPrefix+t.Name+"/"+t.Name+"-var", config.Agent.LxcPrefix+t.Name+"/var")
 	os.Rename(config.Agent.LxcPrefix+t.Name+"/"+t.Name+"-opt", config.Agent.LxcPrefix+t.Name+"/opt")
 	log.Check(log.FatalLevel, "Removing temp dir "+templdir, os.RemoveAll(templdir))
 
-	//delete template archive
+	//keep public template archive for other hosts if registry is enabled, then delete it
 	templateArchive := config.Agent.LxcPrefix + "tmpdir/" + t.File
+	if config.Registry.Enable && t.Id != "" && public(t, token) {
+		log.Check(log.WarnLevel, "Adding "+t.Name+" to registry", registry.Add(templateMeta(t), templateArchive))
+	}
 	log.Check(log.WarnLevel, "Removing file: "+templateArchive, os.Remove(templateArchive))
 
 	if t.Name == "management" {
@@ -580,28 +544,80 @@ func cacheTemplateInfo(t templ) {
 	}
 }
 
+// public checks if the template is available without CDN token, registry serves only such templates to other hosts
+func public(t templ, token string) bool {
+	if token == "" {
+		return true
+	}
+	m, err := sourceOf(t).Info(t.Id, "", "", "", "")
+	return err == nil && m.ID == t.Id
+}
+
+// templateMeta converts template info to template source metadata
+func templateMeta(t templ) template.Meta {
+	m := template.Meta{ID: t.Id, Name: t.Name, Owner: t.Owner, Version: t.Version, File: t.File, Signs: t.Signature}
+	m.Hash.Md5 = t.Md5
+	m.Hash.Sha256 = t.Sha256
+	return m
+}
+
 func getVersion(fileName string) string {
 
 	return strings.Replace(strings.SplitAfter(fileName, "subutai-template_")[1], "_"+strings.ToLower(runtime.GOARCH)+".tar.gz", "", 1)
 }
 
+// verifySignature checks owner signature of the template id according to the signature policy.
+// Owner keys are taken from the trust store; unless policy is "enforce", keys published on the CDN are used for owners missing in the trust store,
+// and templates from trusted sources are not checked. Keys are never taken from the source serving the template. With "enforce" policy unsigned templates and templates not signed by a trusted key are refused.
 func verifySignature(t templ) {
+	policy := template.Policy()
+	if policy == template.PolicyOff {
+		return
+	}
+	src := sourceOf(t)
+	if policy != template.PolicyEnforce && template.Trusted(src) {
+		log.Debug("Skipping signature verification of template from trusted source " + src.String())
+		return
+	}
 
-	if len(t.Id) != 0 && len(t.Signature) == 0 {
-		log.Error("Template is not signed")
+	if len(t.Signature) == 0 {
+		refuseTemplate(policy, "Template "+t.Name+" is not signed")
+		return
 	}
 
 	for owner, signature := range t.Signature {
-		for _, key := range gpg.KurjunUserPK(owner) {
+		var keys []string
+		for _, key := range template.TrustedKeys(owner) {
+			keys = append(keys, key.Key)
+		}
+		trusted := len(keys) > 0
+		if !trusted && policy != template.PolicyEnforce {
+			var err error
+			keys, err = template.CDNKeys(owner)
+			log.Check(log.WarnLevel, "Getting owner public key from CDN", err)
+		}
+		for _, key := range keys {
 			if t.Id == gpg.VerifySignature(key, signature) {
-				log.Info("Template's owner signature verified")
+				if !trusted && policy == template.PolicyWarn {
+					log.Warn("Template is signed by " + owner + ", whose key is not in the trust store")
+				} else {
+					log.Info("Template's owner signature verified")
+				}
 				log.Debug("Signature belongs to " + owner)
 				return
 			}
 			log.Debug("Signature does not match with template id")
 		}
 	}
-	log.Error("Failed to verify signature")
+	refuseTemplate(policy, "Failed to verify signature of template "+t.Name+" with trusted keys")
+}
+
+// refuseTemplate stops import unless signature policy is "warn", which only reports the failed check
+func refuseTemplate(policy, msg string) {
+	if policy != template.PolicyWarn {
+		log.ErrorCode(log.ExitPermission, msg+", refused by signature policy")
+	}
+	log.Warn(msg)
 }
 
 // Verify if package is already on dependency list
@@ -11,12 +11,14 @@ import (
 	"os/exec"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/influxdata/influxdb/client/v2"
 	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/lib/cgroup"
 	"github.com/subutai-io/agent/lib/container"
 	"github.com/subutai-io/agent/lib/fs"
 	"github.com/subutai-io/agent/lib/gpg"
@@ -175,24 +177,14 @@ func cpuQuotaUsage(h string) int {
 	return cpuUsage
 }
 
-func read(path string) (i int) {
-	f, err := os.Open(path)
-	log.Check(log.FatalLevel, "Reading "+path, err)
-	defer f.Close()
-	scanner := bufio.NewScanner(bufio.NewReader(f))
-	for scanner.Scan() {
-		i, err = strconv.Atoi(scanner.Text())
-		log.Check(log.FatalLevel, "Converting string", err)
-	}
-	return
-}
-
 func ramQuotaUsage(h string) int {
-	u := read("/sys/fs/cgroup/memory/lxc/" + h + "/memory.usage_in_bytes")
-	l := read("/sys/fs/cgroup/memory/lxc/" + h + "/memory.limit_in_bytes")
+	u, err := cgroup.MemoryUsage(h)
+	log.Check(log.FatalLevel, "Reading memory usage of "+h, err)
+	l, err := cgroup.MemoryLimit(h)
+	log.Check(log.FatalLevel, "Reading memory limit of "+h, err)
 
 	ramUsage := 0
-	if l != 0 {
+	if l > 0 {
 		ramUsage = u * 100 / l
 	}
 
@@ -218,8 +210,8 @@ func diskQuotaUsage(path string) int {
 	return diskUsage
 }
 
-// quota returns Json string with container's resource quota information
-func quota(h string) string {
+// quota returns container's resource quota information
+func quota(h string) *quotaUsage {
 	usage := new(quotaUsage)
 	usage.Container = h
 	usage.CPU = cpuQuotaUsage(h)
@@ -229,17 +221,11 @@ func quota(h string) string {
 	usage.Disk.Opt = diskQuotaUsage(h + "/opt")
 	usage.Disk.Var = diskQuotaUsage(h + "/var")
 
-	a, err := json.Marshal(usage)
-	if err != nil {
-		log.Warn("Cannot marshal sysload result json")
-		return ""
-	}
-
-	return string(a)
+	return usage
 }
 
-// sysload gathers cpu model information with cpu, ram and disk load and returns it as Json string
-func sysLoad(h string) string {
+// sysload gathers cpu model information with cpu, ram and disk load
+func sysLoad(h string) *hostStat {
 	result := new(hostStat)
 	result.Host = h
 	result.CPU.Idle = cpuLoad(h)
@@ -249,13 +235,7 @@ func sysLoad(h string) string {
 	result.RAM.Free, result.RAM.Total, result.RAM.Cached = ramLoad()
 	result.Disk.Used, result.Disk.Total = diskLoad()
 
-	a, err := json.Marshal(result)
-	if err != nil {
-		log.Warn("Cannot marshal sysload result json")
-		return ""
-	}
-
-	return string(a)
+	return result
 }
 
 // grep searches for "src" regexp key in "filename" and returns value if found
@@ -288,35 +268,69 @@ func grep(str, filename string) string {
 
 // Info command's purposed is to display common system information, such as
 // external IP address to access the container host quotas, its CPU model, RAM size, etc. It's mainly used for internal SS needs.
+//
+// Structured output schemas of the info command:
+//	ipaddr, {"ipaddr": address}
+//	ports, list of used "protocol:port" strings
+//	os, {"os": name}
+//	id, {"id": fingerprint}
+//	du, {"du": bytes}
+//	quota, {"container", "cpu", "ram", "Disk": {"rootfs", "home", "opt", "var"}} usage in percents
+//	system, {"host", "CPU": {"model", "coreCount", "idle", "frequency"}, "Disk": {"total", "used"}, "RAM": {"free", "total", "cached"}}
 func Info(command, host string) {
 	if command == "ipaddr" {
-		fmt.Println(net.GetIp())
+		ip := net.GetIp()
+		output(map[string]string{"ipaddr": ip}, func() { fmt.Println(ip) })
 		return
 	} else if command == "ports" {
+		ports := []string{}
 		for k := range usedPorts() {
-			fmt.Println(k)
+			ports = append(ports, k)
 		}
+		sort.Strings(ports)
+		output(ports, func() {
+			for _, k := range ports {
+				fmt.Println(k)
+			}
+		})
 	} else if command == "os" {
-
-		fmt.Printf("%s\n", getOsName())
+		name := getOsName()
+		output(map[string]string{"os": name}, func() { fmt.Printf("%s\n", name) })
 	} else if command == "id" {
 		os.Setenv("GNUPGHOME", config.Agent.GpgHome)
 		defer os.Unsetenv("GNUPGHOME")
-		fmt.Printf("%s\n", gpg.GetFingerprint("rh@subutai.io"))
+		id := gpg.GetFingerprint("rh@subutai.io")
+		output(map[string]string{"id": id}, func() { fmt.Printf("%s\n", id) })
 	} else if command == "du" {
-		fmt.Println(fs.DiskUsage(host))
+		du := fs.DiskUsage(host)
+		output(map[string]string{"du": du}, func() { fmt.Println(du) })
 	} else if command == "quota" {
 		if len(host) == 0 {
-			log.Error("Usage: subutai info <quota|system> <hostname>")
+			log.ErrorCode(log.ExitUsage, "Usage: subutai info <quota|system> <hostname>")
+		}
+		if !container.IsContainer(host) {
+			log.ErrorCode(log.ExitNotFound, "Container "+host+" not found")
 		}
-		fmt.Println(quota(host))
+		printJSON(quota(host))
 	} else if command == "system" {
 		host, err := os.Hostname()
 		log.Check(log.DebugLevel, "Getting hostname of the system", err)
-		fmt.Println(sysLoad(host))
+		printJSON(sysLoad(host))
 	}
 }
 
+// printJSON prints data as compact JSON in table mode and in requested format otherwise
+func printJSON(data interface{}) {
+	output(data, func() {
+		a, err := json.Marshal(data)
+		if err != nil {
+			log.Warn("Cannot marshal result json")
+			return
+		}
+		fmt.Println(string(a))
+	})
+}
+
 func getOsName() string {
 
 	out, err := exec.Command("/bin/bash", "-c", "cat /var/lib/snapd/hostfs/etc/*release").Output()
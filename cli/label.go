@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/subutai-io/agent/db"
+	"github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/log"
+)
+
+var labelKeyRx = regexp.MustCompile(`^[a-zA-Z0-9._/-]+$`)
+
+// labelItem is the structured output schema of the label command:
+//	key, label key
+//	value, label value
+type labelItem struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// LxcLabel sets, removes or shows key=value labels of the Subutai container.
+// Labels are stored in the agent database and sent to the Management server with the heartbeat.
+// They can be used with the --selector option of list, start, stop, destroy, quota and backup commands to act on a group of containers.
+// Without labels arguments command prints current container labels; with the remove flag, passed keys are removed.
+func LxcLabel(name string, labels []string, remove bool) {
+	if !container.IsContainer(name) {
+		log.ErrorCode(log.ExitNotFound, name+" is not a container")
+	}
+
+	bolt, err := db.New()
+	log.Check(log.ErrorLevel, "Opening database", err)
+	defer bolt.Close()
+
+	if len(labels) == 0 {
+		current := bolt.ContainerLabels(name)
+		var keys []string
+		for k := range current {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		items := []labelItem{}
+		for _, k := range keys {
+			items = append(items, labelItem{Key: k, Value: current[k]})
+		}
+		output(items, func() {
+			w := new(tabwriter.Writer)
+			w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+			fmt.Fprintln(w, "KEY\tVALUE")
+			fmt.Fprintln(w, "---\t-----")
+			for _, item := range items {
+				fmt.Fprintln(w, item.Key+"\t"+item.Value)
+			}
+			w.Flush()
+		})
+		return
+	}
+
+	if remove {
+		for _, k := range labels {
+			log.Check(log.WarnLevel, "Removing label "+k, bolt.ContainerLabel(name, strings.Split(k, "=")[0], ""))
+		}
+		return
+	}
+
+	for k, v := range parseLabels(labels) {
+		log.Check(log.ErrorLevel, "Setting label "+k, bolt.ContainerLabel(name, k, v))
+	}
+}
+
+// parseLabels converts list of key=value strings to map, exiting on malformed labels
+func parseLabels(list []string) map[string]string {
+	labels := make(map[string]string)
+	for _, item := range list {
+		for _, label := range strings.Split(item, ",") {
+			kv := strings.SplitN(label, "=", 2)
+			if len(kv) != 2 || !labelKeyRx.MatchString(kv[0]) || len(kv[1]) == 0 {
+				log.ErrorCode(log.ExitUsage, "Invalid label \""+label+"\", expected key=value")
+			}
+			labels[kv[0]] = kv[1]
+		}
+	}
+	return labels
+}
+
+// Selected returns containers matching all key=value pairs of the comma separated selector.
+func Selected(selector string) (list []string) {
+	bolt, err := db.New()
+	log.Check(log.ErrorLevel, "Opening database", err)
+	defer bolt.Close()
+
+	first := true
+	for k, v := range parseLabels([]string{selector}) {
+		matched := bolt.ContainerByLabel(k, v)
+		if first {
+			list, first = matched, false
+			continue
+		}
+		var filtered []string
+		for _, name := range list {
+			if stringInList(name, matched) {
+				filtered = append(filtered, name)
+			}
+		}
+		list = filtered
+	}
+
+	var existing []string
+	for _, name := range list {
+		if container.IsContainer(name) {
+			existing = append(existing, name)
+		}
+	}
+	sort.Strings(existing)
+	return existing
+}
+
+// ForSelected runs the operation for each container matching the selector.
+// Failure of one container doesn't stop the rest of the group: results are printed at the end
+// and the command exits with error if nothing matched or any container failed.
+func ForSelected(selector, operation string, fn func(name string)) {
+	list := Selected(selector)
+	if len(list) == 0 {
+		log.ErrorCode(log.ExitNotFound, "No containers match selector "+selector)
+	}
+
+	var results []envResult
+	for _, name := range list {
+		r := envResult{Name: name, Operation: operation, Result: "ok"}
+		if code, err := log.Recover(func() { fn(name) }); err != nil {
+			r.Result, r.ExitCode, r.Output = "failed", code, err.Error()
+		}
+		results = append(results, r)
+	}
+	envSummary(results)
+}
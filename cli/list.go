@@ -8,17 +8,18 @@ import (
 	"text/tabwriter"
 
 	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/db"
 	"github.com/subutai-io/agent/lib/container"
 	"github.com/subutai-io/agent/log"
 	lxc "gopkg.in/lxc/go-lxc.v2"
 )
 
 // printHeader prints list headerline
-func printHeader(w io.Writer, c, t, i, a, p bool) {
+func printHeader(w io.Writer, c, t, i, a, p, ttl bool) {
 	var header, line string
 	if i {
-		header = "NAME\tSTATE\tIP\tInterface"
-		line = "----\t-----\t--\t---------"
+		header = "NAME\tSTATE\tIP\tInterface\tSECURITY"
+		line = "----\t-----\t--\t---------\t--------"
 	} else if c == t {
 		header = "CONT/TEMP"
 		line = "---------"
@@ -37,31 +38,76 @@ func printHeader(w io.Writer, c, t, i, a, p bool) {
 		header = header + "\tANCESTORS"
 		line = line + "\t---------"
 	}
+	if ttl {
+		header = header + "\tTTL"
+		line = line + "\t---"
+	}
 	fmt.Fprintln(w, header)
 	fmt.Fprintln(w, line)
 }
 
+// listItem is the structured output schema of the list command:
+//	name, container or template name
+//	type, "container" or "template"
+//	state, LXC state of the instance
+//	ip, interface, network details, only with "info" option
+//	security, effective security profile: default, strict, nesting or custom, only with "info" option
+//	parent, parent template, only with "parent" option
+//	ancestors, chain of parent templates, only with "ancestor" option
+//	ttl, lifetime left until the container is destroyed, only for containers cloned with TTL
+//	ephemeral, true if the container is destroyed when it stops
+type listItem struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	State     string   `json:"state"`
+	IP        string   `json:"ip,omitempty"`
+	Interface string   `json:"interface,omitempty"`
+	Security  string   `json:"security,omitempty"`
+	Parent    string   `json:"parent,omitempty"`
+	Ancestors []string `json:"ancestors,omitempty"`
+	TTL       string   `json:"ttl,omitempty"`
+	Ephemeral bool     `json:"ephemeral,omitempty"`
+}
+
 // printList prints list
-func printList(list []string, c, t, i, a, p bool) {
+func printList(list []listItem, c, t, i, a, p bool) {
 	w := new(tabwriter.Writer)
 	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
-	printHeader(w, c, t, i, a, p)
+	ttl := false
 	for _, item := range list {
-		fmt.Fprintln(w, item)
+		ttl = ttl || item.TTL != "" || item.Ephemeral
+	}
+	printHeader(w, c, t, i, a, p, ttl)
+	for _, item := range list {
+		line := item.Name
+		if i {
+			line = line + "\t" + item.State + "\t" + item.IP + "\t" + item.Interface + "\t" + item.Security
+		}
+		if p {
+			line = line + "\t" + item.Parent
+		}
+		if a {
+			line = line + "\t" + strings.Join(item.Ancestors, ",")
+		}
+		if ttl {
+			line = line + "\t" + lifetime(item)
+		}
+		fmt.Fprintln(w, line)
 	}
 	w.Flush()
 }
 
 // LxcList function shows a listing of Subutai instances with information such as IP address, parent template, etc.
-func LxcList(name string, c, t, i, a, p bool) {
+// If selector is specified, only containers with matching labels are listed.
+func LxcList(name string, c, t, i, a, p bool, selector string) {
 	list := []string{}
 	if i {
 		if name == "" {
-			for _, item := range container.Containers() {
-				list = append(list, info(item)...)
-			}
+			list = append(list, container.Containers()...)
+		} else if container.ContainerOrTemplateExists(name) {
+			list = append(list, name)
 		} else {
-			list = append(list, info(name)...)
+			log.ErrorCode(log.ExitNotFound, name+" not found")
 		}
 	} else if c == t {
 		list = append(list, container.All()...)
@@ -78,52 +124,85 @@ func LxcList(name string, c, t, i, a, p bool) {
 			list = []string{}
 		}
 	}
-	if p {
-		list = addParent(list)
+	if selector != "" {
+		list = filterSelected(list, Selected(selector))
 	}
-	if a {
-		list = addAncestors(list)
+
+	bolt, err := db.New()
+	log.Check(log.WarnLevel, "Opening database", err)
+	items := []listItem{}
+	for _, item := range list {
+		entry := listItem{Name: item, Type: "container", State: container.State(item)}
+		if container.IsTemplate(item) {
+			entry.Type = "template"
+		}
+		if i {
+			entry.IP, entry.Interface = info(item)
+			entry.Security = container.Security(item).Name
+		}
+		if p {
+			entry.Parent = container.GetParent(item)
+		}
+		if a {
+			entry.Ancestors = ancestors(item)
+		}
+		if bolt != nil && entry.Type == "container" {
+			meta := bolt.ContainerByName(item)
+			if expires, ok := expiry(meta); ok {
+				entry.TTL = remaining(expires)
+			}
+			entry.Ephemeral = meta["ephemeral"] == "true"
+		}
+		items = append(items, entry)
+	}
+	if bolt != nil {
+		log.Check(log.WarnLevel, "Closing database", bolt.Close())
 	}
-	printList(list, c, t, i, a, p)
 
+	output(items, func() { printList(items, c, t, i, a, p) })
 }
 
-// addParent adds parent to each template in list
-func addParent(list []string) []string {
-	for i := range list {
-		list[i] = list[i] + "\t" + container.GetParent(strings.Fields(list[i])[0])
+// lifetime formats TTL column of the list
+func lifetime(item listItem) string {
+	switch {
+	case item.TTL != "" && item.Ephemeral:
+		return item.TTL + ", ephemeral"
+	case item.Ephemeral:
+		return "ephemeral"
+	case item.TTL != "":
+		return item.TTL
 	}
-	return list
+	return "-"
 }
 
-// addAncestors adds ancestors to each template in list
-func addAncestors(list []string) []string {
-	for i := range list {
-		child := strings.Fields(list[i])[0]
-		parent := container.GetParent(child)
-		result := ""
-		for child != parent {
-			if result != "" {
-				result = result + "," + parent
-			} else {
-				result = parent
-			}
-			child = parent
+// filterSelected leaves only list items which belong to selected containers
+func filterSelected(list, selected []string) (result []string) {
+	for _, item := range list {
+		if stringInList(item, selected) {
+			result = append(result, item)
 		}
-		list[i] = list[i] + "\t" + result
 	}
-	return list
+	return result
+}
+
+// ancestors returns chain of parent templates of the instance
+func ancestors(child string) (result []string) {
+	parent := container.GetParent(child)
+	for parent != "" && child != parent {
+		result = append(result, parent)
+		child = parent
+		parent = container.GetParent(child)
+	}
+	return result
 }
 
-// info adds container's IP and NIC to list
-func info(name string) (result []string) {
+// info returns container's IP and NIC
+func info(name string) (ip, nic string) {
 	c, err := lxc.NewContainer(name, config.Agent.LxcPrefix)
 	log.Check(log.FatalLevel, "Looking for container "+name, err)
 	defer lxc.Release(c)
 
-	nic := "eth0"
+	nic = "eth0"
 	listip, _ := c.IPAddress(nic)
-	ip := strings.Join(listip, " ")
-
-	return append(result, name+"\t"+container.State(name)+"\t"+ip+"\t"+nic)
+	return strings.Join(listip, " "), nic
 }
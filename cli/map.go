@@ -20,17 +20,42 @@ import (
 	"github.com/nightlyone/lockfile"
 )
 
+// mapItem is the structured output schema of the port mapping list:
+//	protocol, tcp, udp, http or https
+//	external, RH socket
+//	internal, container socket
+//	domain, domain name for http and https mappings
+type mapItem struct {
+	Protocol string `json:"protocol"`
+	External string `json:"external"`
+	Internal string `json:"internal"`
+	Domain   string `json:"domain,omitempty"`
+}
+
 // MapPort exposes internal container ports to sockExt RH interface. It supports udp, tcp, http(s) protocols and other reverse proxy features
 func MapPort(protocol, sockInt, sockExt, policy, domain, cert string, list, remove, sslbcknd bool) {
 	if list {
-		for _, v := range mapList(protocol) {
-			fmt.Println(v)
+		lines := mapList(protocol)
+		items := []mapItem{}
+		for _, v := range lines {
+			if row := strings.Split(v, "\t"); len(row) > 2 {
+				item := mapItem{Protocol: row[0], External: row[1], Internal: row[2]}
+				if len(row) > 3 {
+					item.Domain = row[3]
+				}
+				items = append(items, item)
+			}
 		}
+		output(items, func() {
+			for _, v := range lines {
+				fmt.Println(v)
+			}
+		})
 		return
 	}
 
 	if protocol != "tcp" && protocol != "udp" && protocol != "http" && protocol != "https" {
-		log.Error("Unsupported protocol \"" + protocol + "\"")
+		log.ErrorCode(log.ExitUsage, "Unsupported protocol \""+protocol+"\"")
 	} else if protocol == "tcp" || protocol == "udp" {
 		domain = protocol
 	}
@@ -41,13 +66,13 @@ func MapPort(protocol, sockInt, sockExt, policy, domain, cert string, list, remo
 
 	switch {
 	case (protocol == "http" || protocol == "https") && len(domain) == 0:
-		log.Error("\"-d domain\" is mandatory for http protocol")
+		log.ErrorCode(log.ExitUsage, "\"-d domain\" is mandatory for http protocol")
 	case remove:
 		mapRemove(protocol, sockExt, domain, sockInt)
 	case protocol == "https" && (len(cert) == 0 || !gpg.ValidatePem(cert)):
 		log.Error("\"-c certificate\" is missing or invalid pem file")
 	case len(sockInt) != 0 && !ovs.ValidSocket(sockInt):
-		log.Error("Invalid internal socket \"" + sockInt + "\"")
+		log.ErrorCode(log.ExitUsage, "Invalid internal socket \""+sockInt+"\"")
 	case (strings.HasSuffix(sockExt, ":8443") || strings.HasSuffix(sockExt, ":8444") || strings.HasSuffix(sockExt, ":8086")) &&
 		sockInt != "10.10.10.1:"+strings.Split(sockExt, ":")[1]:
 		log.Error("Reserved system ports")
@@ -112,13 +137,15 @@ func mapRemove(protocol, sockExt, domain, sockInt string) {
 	log.Debug("Removing mapping: " + protocol + " " + sockExt + " " + domain + " " + sockInt)
 
 	if sockInt != "" && bolt.PortMapDelete(protocol, sockExt, domain, sockInt) > 0 {
+		conf := config.Agent.DataPrefix + "nginx-includes/" + protocol + "/" + sockExt + "-" + domain + ".conf"
 		if strings.Contains(sockInt, ":") {
+			// backends of unhealthy containers are marked down by the health monitor
+			addLine(conf, "server "+sockInt+" down;", " ", true)
 			sockInt = sockInt + ";"
 		} else {
 			sockInt = sockInt + ":"
 		}
-		addLine(config.Agent.DataPrefix+"nginx-includes/"+protocol+"/"+sockExt+"-"+domain+".conf",
-			"server "+sockInt, " ", true)
+		addLine(conf, "server "+sockInt, " ", true)
 	} else {
 		if bolt.PortMapDelete(protocol, sockExt, domain, "") == 0 {
 			bolt.PortMapDelete(protocol, sockExt, "", "")
@@ -172,7 +199,7 @@ func portIsNew(protocol, sockInt, domain string, sockExt *string) bool {
 		if !bolt.PortInMap(protocol, (*sockExt), "", "") && socket[1] != "80" {
 			log.Error("Port is busy")
 		} else if bolt.PortInMap(protocol, (*sockExt), domain, sockInt) {
-			log.Error("Mapping already exists")
+			log.ErrorCode(log.ExitExists, "Mapping already exists")
 		}
 		return !bolt.PortInMap(protocol, (*sockExt), domain, "")
 	}
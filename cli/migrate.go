@@ -97,7 +97,7 @@ func checkDestination(destination *string) {
 		*destination += ":22"
 	}
 	if !net.ValidSocket(*destination) {
-		log.Error("Please specify valid destination socket")
+		log.ErrorCode(log.ExitUsage, "Please specify valid destination socket")
 	}
 
 	client, err := sshClient(*destination)
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/log"
+)
+
+// mountItem is the structured output schema of the mount list command:
+//	source, host path
+//	target, path inside the container
+//	readonly, true for read-only mounts
+//	shift, true if ownership of the source was shifted into the container user namespace
+type mountItem container.BindMount
+
+// MountAdd bind mounts host directory or file into the Subutai container. Both paths must be absolute, directories of other
+// containers can't be mounted, named volumes serve this purpose. Shift option passes ownership of the host files into the container
+// user namespace, so they belong to the same users inside the container; the ownership is shifted back when the mount is removed.
+// Shift is refused for system directories and for trees having owners out of 0-65535 range.
+// Mount is applied to the running container right away if the kernel supports it (Linux 5.2, 5.12 for read-only mounts), otherwise on restart.
+// Mounts are saved in the database, so restore and migrate reproduce them.
+func MountAdd(name, src, dst string, readonly, shift bool) {
+	if !container.IsContainer(name) {
+		log.ErrorCode(log.ExitNotFound, name+" is not a container")
+	}
+	m, err := container.ValidMount(name, container.BindMount{Source: src, Target: dst, ReadOnly: readonly, Shift: shift})
+	if err != nil {
+		log.ErrorCode(log.ExitUsage, err.Error())
+	}
+	live, err := container.AddMount(name, m)
+	log.Check(log.ErrorLevel, "Mounting "+m.Source+" to "+name+":"+m.Target, err)
+	log.Info(m.Source + " mounted to " + name + ":" + m.Target)
+	if !live && container.State(name) == "RUNNING" {
+		log.Info("Restart " + name + " to apply the mount")
+	}
+}
+
+// MountDel removes bind mount of the container path, unmounting it from the running container
+func MountDel(name, dst string) {
+	if !container.IsContainer(name) {
+		log.ErrorCode(log.ExitNotFound, name+" is not a container")
+	}
+	if err := container.DelMount(name, dst); err != nil {
+		log.ErrorCode(log.ExitNotFound, err.Error())
+	}
+	log.Info(dst + " unmounted from " + name)
+}
+
+// MountList prints host directories bind mounted into the container
+func MountList(name string) {
+	if !container.IsContainer(name) {
+		log.ErrorCode(log.ExitNotFound, name+" is not a container")
+	}
+	items := []mountItem{}
+	saved := make(map[string]bool)
+	for _, m := range container.SavedMounts(name) {
+		items = append(items, mountItem(m))
+		saved[m.Target] = true
+	}
+	// mounts added to the config by hand are listed as well
+	for _, m := range container.HostMounts(name) {
+		if !saved[m.Target] {
+			items = append(items, mountItem(m))
+		}
+	}
+
+	output(items, func() {
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+		fmt.Fprintln(w, "TARGET\tSOURCE\tMODE")
+		fmt.Fprintln(w, "------\t------\t----")
+		for _, i := range items {
+			mode := "rw"
+			if i.ReadOnly {
+				mode = "ro"
+			}
+			if i.Shift {
+				mode += ",shift"
+			}
+			fmt.Fprintln(w, i.Target+"\t"+i.Source+"\t"+mode)
+		}
+		w.Flush()
+	})
+}
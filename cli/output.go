@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/subutai-io/agent/log"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Format defines output format of the CLI commands: table (default), json or yaml.
+// Structured formats use the same field names, described by the json tags of the output types.
+var Format = "table"
+
+// SetFormat validates and applies output format passed with the global --format option.
+// In json and yaml modes errors are printed as {code, message} objects.
+func SetFormat(format string) {
+	switch format {
+	case "", "table":
+		Format = "table"
+		log.Structured("")
+	case "json", "yaml":
+		Format = format
+		log.Structured(format)
+	default:
+		log.ErrorCode(log.ExitUsage, "Unsupported output format "+format)
+	}
+}
+
+// output prints data in the requested structured format or calls table function for human readable output
+func output(data interface{}, table func()) {
+	switch Format {
+	case "json":
+		out, err := json.MarshalIndent(data, "", "  ")
+		log.Check(log.ErrorLevel, "Marshaling output", err)
+		fmt.Println(string(out))
+	case "yaml":
+		// marshal through json to keep field names of both formats identical
+		var generic interface{}
+		out, err := json.Marshal(data)
+		log.Check(log.ErrorLevel, "Marshaling output", err)
+		log.Check(log.ErrorLevel, "Converting output", json.Unmarshal(out, &generic))
+		out, err = yaml.Marshal(generic)
+		log.Check(log.ErrorLevel, "Marshaling output", err)
+		fmt.Print(string(out))
+	default:
+		table()
+	}
+}
@@ -16,36 +16,48 @@ import (
 // It doesn't matter where the containers are physically located.
 func P2P(create, remove, update, list, peers bool, args []string) {
 	if create {
-		if len(args) > 8 {
-			p2p.Create(args[3], args[7], args[4], args[5], args[6], args[8]) //p2p -c interfaceName hash key ttl localPeepIPAddr portRange
+		if len(args) > 5 {
+			p2p.Create(args[0], args[4], args[1], args[2], args[3], args[5]) //p2p -c interfaceName hash key ttl localPeepIPAddr portRange
 
-		} else if len(args) > 7 {
-			if strings.Contains(args[7], "-") {
-				p2p.Create(args[3], "dhcp", args[4], args[5], args[6], args[7]) //p2p -c interfaceName hash key ttl portRange
+		} else if len(args) > 4 {
+			if strings.Contains(args[4], "-") {
+				p2p.Create(args[0], "dhcp", args[1], args[2], args[3], args[4]) //p2p -c interfaceName hash key ttl portRange
 			} else {
-				p2p.Create(args[3], args[7], args[4], args[5], args[6], "") //p2p -c interfaceName hash key ttl localPeepIPAddr
+				p2p.Create(args[0], args[4], args[1], args[2], args[3], "") //p2p -c interfaceName hash key ttl localPeepIPAddr
 			}
-		} else if len(args) > 6 {
-			p2p.Create(args[3], "dhcp", args[4], args[5], args[6], "") //p2p -c interfaceName hash key ttl
+		} else if len(args) > 3 {
+			p2p.Create(args[0], "dhcp", args[1], args[2], args[3], "") //p2p -c interfaceName hash key ttl
 		} else {
-			log.Error("Wrong usage")
+			log.ErrorCode(log.ExitUsage, "Wrong usage")
 		}
 
 	} else if update {
-		if len(args) < 6 {
-			log.Error("Wrong usage")
+		if len(args) < 3 {
+			log.ErrorCode(log.ExitUsage, "Wrong usage")
 		}
-		p2p.UpdateKey(args[3], args[4], args[5])
+		p2p.UpdateKey(args[0], args[1], args[2])
 
 	} else if remove {
-		if len(args) < 4 {
-			log.Error("Wrong usage")
+		if len(args) < 1 {
+			log.ErrorCode(log.ExitUsage, "Wrong usage")
 		}
-		p2p.Remove(args[3])
+		p2p.Remove(args[0])
+
+	} else if list {
+		instances, err := p2p.List()
+		log.Check(log.ErrorLevel, "Getting list of p2p instances", err)
+		if instances == nil {
+			instances = []p2p.Instance{}
+		}
+		output(instances, func() {
+			for _, v := range instances {
+				fmt.Printf("%s\t%s\t%s\n", v.Mac, v.IP, v.Hash)
+			}
+		})
 
 	} else if peers {
-		if len(args) < 3 {
-			p2p.Peers(args[3])
+		if len(args) > 0 {
+			p2p.Peers(args[0])
 		} else {
 			p2p.Peers("")
 		}
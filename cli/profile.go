@@ -0,0 +1,333 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/db"
+	"github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/lib/fs"
+	"github.com/subutai-io/agent/log"
+)
+
+var (
+	// profile resources in the order they are applied: disk quotas are most likely to fail, so they go first
+	profileQuotas = []string{"disk", "rootfs", "home", "var", "opt", "ram", "cpu", "cpuset", "network", "io", "pids"}
+	// resources supporting alert thresholds
+	profileAlerts = []string{"cpu", "ram", "io", "pids", "rootfs", "home", "var", "opt"}
+
+	// builtin profiles correspond to template size hints, they can be redefined by saving profile with the same name
+	builtinProfiles = map[string]map[string]string{
+		"tiny":   {"cpu": "10", "ram": "256", "disk": "4"},
+		"small":  {"cpu": "25", "ram": "512", "disk": "10"},
+		"medium": {"cpu": "50", "ram": "1024", "disk": "20"},
+		"large":  {"cpu": "75", "ram": "2048", "disk": "40"},
+		"huge":   {"cpu": "100", "ram": "4096", "disk": "100"},
+	}
+)
+
+// profileItem is the structured output schema of the profile list:
+//	name, profile name
+//	builtin, true if profile is one of the default tiny, small, medium, large and huge profiles
+//	quota, resource quotas in units of the quota command
+//	threshold, alert thresholds of resources in percents
+type profileItem struct {
+	Name      string            `json:"name"`
+	Builtin   bool              `json:"builtin"`
+	Quota     map[string]string `json:"quota"`
+	Threshold map[string]string `json:"threshold,omitempty"`
+}
+
+// ProfileList shows available quota profiles: builtin tiny, small, medium, large and huge profiles and the profiles saved with profile set.
+func ProfileList() {
+	bolt, err := db.New()
+	log.Check(log.ErrorLevel, "Opening database", err)
+	names := bolt.ProfileList()
+	log.Check(log.WarnLevel, "Closing database", bolt.Close())
+
+	for name := range builtinProfiles {
+		if !stringInList(name, names) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	items := []profileItem{}
+	for _, name := range names {
+		item := profileItem{Name: name, Quota: make(map[string]string), Threshold: make(map[string]string)}
+		options, saved := getProfile(name)
+		_, item.Builtin = builtinProfiles[name]
+		item.Builtin = item.Builtin && !saved
+		for k, v := range options {
+			if strings.HasPrefix(k, "alert.") {
+				item.Threshold[strings.TrimPrefix(k, "alert.")] = v
+			} else {
+				item.Quota[k] = v
+			}
+		}
+		items = append(items, item)
+	}
+
+	output(items, func() {
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+		fmt.Fprintln(w, "NAME\tQUOTA\tTHRESHOLD")
+		fmt.Fprintln(w, "----\t-----\t---------")
+		for _, item := range items {
+			fmt.Fprintln(w, item.Name+"\t"+joinMap(item.Quota, profileQuotas)+"\t"+joinMap(item.Threshold, profileAlerts))
+		}
+		w.Flush()
+	})
+}
+
+// ProfileSet saves quota profile. Quotas are passed as resource=value pairs in units of the quota command, one pair per option:
+//	cpu, %
+//	cpuset, available cores
+//	ram, Mb
+//	network, Kbps
+//	disk, rootfs/home/var/opt, Gb
+//	io, rbps/wbps/riops/wiops limits separated by commas
+//	pids, processes
+// Thresholds are passed as resource=percent pairs for cpu, ram, io, pids, rootfs, home, var and opt resources.
+func ProfileSet(name string, quotas, thresholds []string) {
+	if !labelKeyRx.MatchString(name) {
+		log.ErrorCode(log.ExitUsage, "Invalid profile name "+name)
+	}
+	options := make(map[string]string)
+	for res, value := range parsePairs(quotas) {
+		if !stringInList(res, profileQuotas) {
+			log.ErrorCode(log.ExitUsage, "Unsupported resource "+res)
+		}
+		options[res] = value
+	}
+	for res, value := range parsePairs(thresholds) {
+		if !stringInList(res, profileAlerts) {
+			log.ErrorCode(log.ExitUsage, "Threshold is not supported for "+res)
+		}
+		if _, err := strconv.Atoi(value); err != nil {
+			log.ErrorCode(log.ExitUsage, "Invalid threshold "+res+"="+value)
+		}
+		options["alert."+res] = value
+	}
+	if len(options) == 0 {
+		log.ErrorCode(log.ExitUsage, "Please specify profile quotas or thresholds")
+	}
+
+	bolt, err := db.New()
+	log.Check(log.ErrorLevel, "Opening database", err)
+	defer bolt.Close()
+	log.Check(log.ErrorLevel, "Saving profile "+name, bolt.ProfileAdd(name, options))
+	log.Info("Profile " + name + " saved")
+}
+
+// ProfileDel removes saved quota profile. Removing redefined builtin profile restores its default values.
+func ProfileDel(name string) {
+	bolt, err := db.New()
+	log.Check(log.ErrorLevel, "Opening database", err)
+	defer bolt.Close()
+	if bolt.Profile(name) == nil {
+		log.ErrorCode(log.ExitNotFound, "Profile "+name+" not found")
+	}
+	log.Check(log.ErrorLevel, "Removing profile "+name, bolt.ProfileDel(name))
+	log.Info("Profile " + name + " removed")
+}
+
+// LxcResize applies all quotas and thresholds of the profile to the container as a single operation.
+// Each quota is read back after it is set; if any resource fails, the container config and already changed quotas are reverted.
+func LxcResize(name, profile string) {
+	if !container.IsContainer(name) {
+		log.ErrorCode(log.ExitNotFound, name+" is not a container")
+	}
+	options, _ := getProfile(profile)
+	if options == nil {
+		log.ErrorCode(log.ExitNotFound, "Profile "+profile+" not found")
+	}
+	log.Check(log.ErrorLevel, "Resizing "+name, applyProfile(name, profile, options))
+	log.Info(name + " resized to " + profile)
+}
+
+// getProfile returns options of saved or builtin profile, saved flag is true if profile exists in the database
+func getProfile(name string) (options map[string]string, saved bool) {
+	bolt, err := db.New()
+	if !log.Check(log.WarnLevel, "Opening database", err) {
+		options = bolt.Profile(name)
+		log.Check(log.WarnLevel, "Closing database", bolt.Close())
+	}
+	if options != nil {
+		return options, true
+	}
+	return builtinProfiles[name], false
+}
+
+// applyProfile sets container quotas and thresholds, reverting changes on failure
+func applyProfile(name, profile string, options map[string]string) error {
+	confPath := config.Agent.LxcPrefix + name + "/config"
+	conf, err := ioutil.ReadFile(confPath)
+	if err != nil {
+		return err
+	}
+	running := container.State(name) == "RUNNING"
+
+	bolt, err := db.New()
+	if err != nil {
+		return err
+	}
+	saved := bolt.ContainerQuotas(name)
+	log.Check(log.WarnLevel, "Closing database", bolt.Close())
+
+	var done []string
+	previous := make(map[string]string)
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			res := done[i]
+			if size := previous[res]; size != "" {
+				log.Check(log.WarnLevel, "Restoring "+res+" quota", setQuota(name, res, size, false))
+			}
+		}
+		// quota setters update config, so it is restored last
+		log.Check(log.WarnLevel, "Restoring container config", ioutil.WriteFile(confPath, conf, 0644))
+	}
+
+	for _, res := range profileQuotas {
+		size, ok := options[res]
+		if !ok {
+			continue
+		}
+		previous[res] = currentQuota(name, res, saved, running)
+		done = append(done, res)
+		if err = setQuota(name, res, size, running); err != nil {
+			rollback()
+			return errors.New("setting " + res + " quota: " + err.Error())
+		}
+	}
+
+	var alerts [][]string
+	for _, res := range profileAlerts {
+		if value, ok := options["alert."+res]; ok {
+			key := "subutai.alert.disk." + res
+			if res == "cpu" || res == "ram" || res == "io" || res == "pids" {
+				key = "subutai.alert." + res
+			}
+			alerts = append(alerts, []string{key, value})
+		}
+	}
+	if len(alerts) > 0 {
+		if err = container.SetContainerConf(name, alerts); err != nil {
+			rollback()
+			return errors.New("setting thresholds: " + err.Error())
+		}
+	}
+
+	bolt, err = db.New()
+	if !log.Check(log.WarnLevel, "Opening database", err) {
+		for _, res := range done {
+			log.Check(log.WarnLevel, "Writing container data to database", bolt.ContainerQuota(name, res, options[res]))
+		}
+		log.Check(log.WarnLevel, "Writing container data to database", bolt.ContainerAdd(name, map[string]string{"profile": profile}))
+		log.Check(log.WarnLevel, "Closing database", bolt.Close())
+	}
+	return nil
+}
+
+// currentQuota returns value which restores resource quota on rollback, empty string means that quota should be left as is
+func currentQuota(name, res string, saved map[string]string, running bool) string {
+	switch res {
+	case "disk", "rootfs", "home", "var", "opt":
+		if size, ok := saved[res]; ok {
+			return size
+		}
+		return "none"
+	case "ram":
+		if ram := container.QuotaRAM(name, ""); running && ram > 0 {
+			return strconv.Itoa(ram)
+		}
+	case "cpu":
+		if running {
+			return strconv.Itoa(container.QuotaCPU(name, ""))
+		}
+	case "cpuset":
+		if running {
+			return container.QuotaCPUset(name, "")
+		}
+	case "network":
+		return container.QuotaNet(name, "")
+	case "io":
+		return container.QuotaIO(name, "")
+	case "pids":
+		return strconv.Itoa(container.QuotaPids(name, ""))
+	}
+	return ""
+}
+
+// setQuota sets resource quota and verifies the applied value if verify flag is set
+func setQuota(name, res, size string, verify bool) error {
+	var current string
+	switch res {
+	case "disk":
+		fs.DiskQuota(name)
+		return fs.LimitDisk(name, size)
+	case "rootfs", "home", "var", "opt":
+		return fs.LimitVolume(name+"/"+res, size)
+	case "ram":
+		current = strconv.Itoa(container.QuotaRAM(name, size))
+	case "cpu":
+		current = strconv.Itoa(container.QuotaCPU(name, size))
+		if want, err := strconv.Atoi(size); err == nil {
+			if got, err := strconv.Atoi(current); err == nil && got-want <= 1 && want-got <= 1 {
+				current = size
+			}
+		}
+	case "cpuset":
+		current = container.QuotaCPUset(name, size)
+	case "network":
+		current = container.QuotaNet(name, size)
+	case "io":
+		// only passed limits are changed, the rest are left as is
+		current = container.QuotaIO(name, size)
+		for _, limit := range strings.Split(size, ",") {
+			if !stringInList(limit, strings.Split(current, ",")) {
+				current = ""
+			}
+		}
+		if current != "" {
+			current = size
+		}
+	case "pids":
+		current = strconv.Itoa(container.QuotaPids(name, size))
+	}
+	if verify && current != size {
+		return errors.New("expected " + size + ", got " + current)
+	}
+	return nil
+}
+
+// parsePairs converts list of resource=value strings to map, values may contain commas unlike labels
+func parsePairs(list []string) map[string]string {
+	pairs := make(map[string]string)
+	for _, item := range list {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 || len(kv[1]) == 0 {
+			log.ErrorCode(log.ExitUsage, "Invalid value \""+item+"\", expected resource=value")
+		}
+		pairs[kv[0]] = kv[1]
+	}
+	return pairs
+}
+
+// joinMap formats map as comma separated key=value pairs in the order of keys list
+func joinMap(m map[string]string, keys []string) string {
+	var list []string
+	for _, k := range keys {
+		if v, ok := m[k]; ok {
+			list = append(list, k+"="+v)
+		}
+	}
+	return strings.Join(list, ",")
+}
@@ -67,7 +67,7 @@ func LxcPromote(name, source string) {
 
 	makeDiff(name)
 
-	container.ResetNet(name)
+	log.Check(log.ErrorLevel, "Resetting network configuration", container.ResetNet(name))
 	fs.ReadOnly(name, true)
 	log.Info(name + " promoted")
 }
@@ -115,17 +115,17 @@ func checkSanity(name string, source string) {
 	// check: if name exists
 	if source != "" {
 		if !container.IsContainer(source) {
-			log.Error("Container " + source + " does not exist")
+			log.ErrorCode(log.ExitNotFound, "Container "+source+" does not exist")
 		}
 	} else {
 		if !container.IsContainer(name) {
-			log.Error("Container " + name + " does not exist")
+			log.ErrorCode(log.ExitNotFound, "Container "+name+" does not exist")
 		}
 	}
 
 	// check: if name is template
 	if container.IsTemplate(name) {
-		log.Error("Template " + name + " already exists")
+		log.ErrorCode(log.ExitExists, "Template "+name+" already exists")
 	}
 
 	parent := container.GetParent(name)
@@ -133,6 +133,6 @@ func checkSanity(name string, source string) {
 		return
 	}
 	if !container.IsTemplate(parent) {
-		log.Error("Parent template " + parent + " not found")
+		log.ErrorCode(log.ExitNotFound, "Parent template "+parent+" not found")
 	}
 }
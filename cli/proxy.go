@@ -30,10 +30,10 @@ var (
 // ProxyAdd checks input args and perform required operations to configure reverse proxy
 func ProxyAdd(vlan, domain, node, policy, cert string) {
 	if vlan == "" {
-		log.Error("Please specify VLAN")
+		log.ErrorCode(log.ExitUsage, "Please specify VLAN")
 	} else if domain != "" {
 		if isVlanExist(vlan) {
-			log.Error("Domain already exists")
+			log.ErrorCode(log.ExitExists, "Domain already exists")
 		}
 		if crt := strings.Split(cert, ":"); len(crt) > 1 && container.ContainerOrTemplateExists(crt[0]) {
 			if !strings.HasPrefix(crt[1], "/opt/") && !strings.HasPrefix(crt[1], "/var/") && !strings.HasPrefix(crt[1], "/home/") {
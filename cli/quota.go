@@ -11,14 +11,26 @@ import (
 	"github.com/subutai-io/agent/log"
 )
 
+// quotaItem is the structured output schema of the quota command:
+//	quota, current quota of the resource, 0 if not limited
+//	threshold, alert threshold of the resource in percents, 0 if not set
+type quotaItem struct {
+	Quota     string `json:"quota"`
+	Threshold int    `json:"threshold"`
+}
+
 // LxcQuota function controls container's quotas and thresholds. Available resources:
 //	cpu, %
 //	cpuset, available cores
 //	ram, Mb
 //	network, Kbps
 //	rootfs/home/var/opt, Gb
+//	io, comma separated rbps, wbps (bytes per second) and riops, wiops (operations per second) limits, e.g. rbps=10485760,wiops=500
+//	pids, maximum number of processes
 // The threshold value represents a percentage for each resource. Once resource consumption exceeds this threshold it triggers an alert.
-// The clone operation, sets no quotas and thresholds for new containers; quotas need to be configured with quota command after a clone operation.
+// The clone operation, sets no quotas and thresholds for new containers unless quota profile is passed; quotas need to be configured with quota command after a clone operation.
+// To change several quotas at once, use resize command with a quota profile.
+// Current quota and threshold of the resource are printed as a table, scripts parsing the result should use --format json.
 func LxcQuota(name, res, size, threshold string) {
 	if len(threshold) > 0 {
 		setQuotaThreshold(name, res, threshold)
@@ -38,6 +50,10 @@ func LxcQuota(name, res, size, threshold string) {
 		quota = strconv.Itoa(container.QuotaRAM(name, size))
 	case "cpu":
 		quota = strconv.Itoa(container.QuotaCPU(name, size))
+	case "io":
+		quota = container.QuotaIO(name, size)
+	case "pids":
+		quota = strconv.Itoa(container.QuotaPids(name, size))
 	}
 	if len(res) > 0 && len(size) > 0 {
 		bolt, err := db.New()
@@ -50,7 +66,12 @@ func LxcQuota(name, res, size, threshold string) {
 		quota = "0"
 	}
 
-	fmt.Println(`{"quota":"` + quota + `", "threshold":` + alert + `}`)
+	item := quotaItem{Quota: quota}
+	item.Threshold, _ = strconv.Atoi(alert)
+	output(item, func() {
+		fmt.Println("QUOTA\tTHRESHOLD")
+		fmt.Println(item.Quota + "\t" + strconv.Itoa(item.Threshold))
+	})
 }
 
 // setQuotaThreshold sets threshold for quota alerts
@@ -58,7 +79,7 @@ func setQuotaThreshold(name, resource, size string) {
 	if resource == "rootfs" || resource == "var" || resource == "opt" || resource == "home" {
 		container.SetContainerConf(name, [][]string{{"subutai.alert.disk." + resource, size}})
 		return
-	} else if resource == "cpu" || resource == "ram" {
+	} else if resource == "cpu" || resource == "ram" || resource == "io" || resource == "pids" {
 		container.SetContainerConf(name, [][]string{{"subutai.alert." + resource, size}})
 		return
 	}
@@ -68,7 +89,7 @@ func setQuotaThreshold(name, resource, size string) {
 // getQuotaThreshold gets threshold of quota alerts
 func getQuotaThreshold(name, resource string) string {
 	res := "subutai.alert.disk." + resource
-	if resource == "cpu" || resource == "ram" {
+	if resource == "cpu" || resource == "ram" || resource == "io" || resource == "pids" {
 		res = "subutai.alert." + resource
 	}
 	if size := container.GetConfigItem(config.Agent.LxcPrefix+name+"/config", res); len(size) > 0 {
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/subutai-io/agent/agent/registry"
+	"github.com/subutai-io/agent/agent/utils"
+	"github.com/subutai-io/agent/lib/template"
+	"github.com/subutai-io/agent/log"
+)
+
+// registryItem is the structured output schema of the registry list command:
+//	id, name, owner, version, filename, template identity as in the global repository
+//	size, archive size in bytes
+//	hash, md5 and sha256 hash sums of the archive
+type registryItem template.Meta
+
+// RegistryList prints templates cached in the local template registry
+func RegistryList() {
+	items := []registryItem{}
+	for _, m := range registry.Templates() {
+		items = append(items, registryItem(m))
+	}
+
+	output(items, func() {
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+		fmt.Fprintln(w, "NAME\tOWNER\tVERSION\tSIZE\tID")
+		fmt.Fprintln(w, "----\t-----\t-------\t----\t--")
+		for _, i := range items {
+			fmt.Fprintln(w, i.Name+"\t"+strings.Join(i.Owner, ",")+"\t"+i.Version+"\t"+topBytes(int(i.Size), 0)+"\t"+i.ID)
+		}
+		w.Flush()
+	})
+}
+
+// RegistrySync mirrors templates into the local template registry from the template sources configured in [template] section of the agent config.
+// Templates are referenced the same way as in the import command: name, name@owner or name@owner:version.
+// Without arguments, the latest versions of all templates already present in the registry are synced.
+// The registry serves cached templates to other agents when it is enabled in [registry] section of the agent config;
+// other agents use it by setting [cdn] url and sslport to the address of this host and the registry port,
+// or by adding kurjun:https://<host>:<port>/kurjun/rest to their template sources.
+// Options "bind" and "allow" restrict the listening address and the peers allowed to use the registry; only public templates are cached.
+func RegistrySync(refs []string) {
+	if len(refs) == 0 {
+		registry.Refresh()
+		return
+	}
+	for _, ref := range refs {
+		name, owner, ver := templateRef(ref)
+		_, err := registry.Sync(name, owner, ver)
+		log.Check(log.ErrorLevel, "Syncing "+ref, err)
+	}
+}
+
+// RegistryRemove deletes cached templates from the local template registry.
+// Template is referenced by name, name@owner, name@owner:version or id:<template id>, all versions are removed if version is omitted.
+func RegistryRemove(ref string) {
+	var n int
+	if id := strings.TrimPrefix(ref, "id:"); id != ref {
+		n = registry.Remove(id, "", "", "")
+	} else if name, owner, ver := templateRef(ref); ver != "" {
+		n = registry.Remove("", name, owner, ver)
+	} else {
+		// without version only the latest archive of each owner matches, so older ones are removed in turn
+		for removed := registry.Remove("", name, owner, ""); removed > 0; removed = registry.Remove("", name, owner, "") {
+			n += removed
+		}
+	}
+	if n == 0 {
+		log.ErrorCode(log.ExitNotFound, "Template "+ref+" not found in registry")
+	}
+	log.Info(fmt.Sprintf("%d template archive(s) removed from registry", n))
+}
+
+// templateRef splits template reference name[@owner[:version]] into parts
+func templateRef(ref string) (name, owner, ver string) {
+	switch {
+	case templateNameNOwnerNVersionRx.MatchString(ref):
+		groups := utils.MatchRegexGroups(templateNameNOwnerNVersionRx, ref)
+		return groups["name"], groups["owner"], groups["version"]
+	case templateNameNOwnerRx.MatchString(ref):
+		groups := utils.MatchRegexGroups(templateNameNOwnerRx, ref)
+		return groups["name"], groups["owner"], ""
+	case templateNameRx.MatchString(ref):
+		return ref, "", ""
+	}
+	log.ErrorCode(log.ExitUsage, "Invalid template name "+ref)
+	return
+}
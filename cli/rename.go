@@ -1,41 +1,207 @@
 package cli
 
 import (
+	"errors"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/db"
 	"github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/lib/gpg"
 	"github.com/subutai-io/agent/log"
 )
 
+// renameStep is a single rename operation with the function reverting it
+type renameStep struct {
+	name string
+	do   func() error
+	undo func() error
+}
+
 // LxcRename renames a Subutai container impacting filesystem paths, configuration values, etc.
+// Besides the container directory and config, rename updates container data in the agent database: metadata, quotas, labels,
+// port mappings and UID map entry, updates identity of the container GPG key to the new name and fixes paths in nginx includes.
+// The key itself is kept, so the container keeps its fingerprint, which identifies it on the Management server.
+// Rename is transactional: if any step fails, all completed steps are reverted and the container is left with the old name.
 func LxcRename(src, dst string) {
-	run := false
-	if len(dst) == 0 || container.ContainerOrTemplateExists(dst) || container.IsTemplate(dst) {
-		log.Error("Incorrect new name or instance already exists")
+	if !container.IsContainer(src) {
+		log.ErrorCode(log.ExitNotFound, src+" is not a container")
 	}
-	if container.State(src) == "RUNNING" {
-		run = true
-		log.Check(log.ErrorLevel, "Stopping container", container.Stop(src, true))
+	if container.IsReserved(dst) {
+		log.ErrorCode(log.ExitUsage, dst+" is a reserved name")
+	}
+	if len(dst) == 0 || container.ContainerOrTemplateExists(dst) || container.IsTemplate(dst) {
+		log.ErrorCode(log.ExitExists, "Incorrect new name or instance already exists")
 	}
 
-	err := os.Rename(config.Agent.LxcPrefix+src, config.Agent.LxcPrefix+dst)
-	log.Check(log.FatalLevel, "Renaming container "+src, err)
+	srcPath := config.Agent.LxcPrefix + src
+	dstPath := config.Agent.LxcPrefix + dst
+	run := container.State(src) == "RUNNING"
+	includes := make(map[string][]byte)
+	var conf []byte
+	fingerprint := gpg.GetFingerprint(src)
 
-	container.SetContainerConf(dst, [][]string{
-		{"lxc.utsname", dst},
-		{"subutai.git.branch", dst},
-		{"lxc.mount", config.Agent.LxcPrefix + dst + "/fstab"},
-		{"lxc.rootfs", config.Agent.LxcPrefix + dst + "/rootfs"},
-		{"lxc.rootfs.mount", config.Agent.LxcPrefix + dst + "/rootfs"},
-		{"lxc.mount.entry", config.Agent.LxcPrefix + dst + "/opt  opt none bind,rw 0 0"},
-		{"lxc.mount.entry", config.Agent.LxcPrefix + dst + "/home  opt none bind,rw 0 0"},
-		{"lxc.mount.entry", config.Agent.LxcPrefix + dst + "/var  opt none bind,rw 0 0"},
-	})
+	steps := []renameStep{
+		{"stopping container", func() error {
+			if run {
+				return container.Stop(src, true)
+			}
+			return nil
+		}, func() error {
+			if run {
+				return container.Start(src)
+			}
+			return nil
+		}},
+		{"renaming directory", func() error {
+			return os.Rename(srcPath, dstPath)
+		}, func() error {
+			return os.Rename(dstPath, srcPath)
+		}},
+		{"updating config", func() error {
+			var err error
+			if conf, err = ioutil.ReadFile(dstPath + "/config"); err != nil {
+				return err
+			}
+			newconf := strings.Replace(string(conf), srcPath+"/", dstPath+"/", -1)
+			// previous versions of rename bound all volumes to opt
+			for _, vol := range []string{"home", "var"} {
+				newconf = strings.Replace(newconf, dstPath+"/"+vol+"  opt ", dstPath+"/"+vol+" "+vol+" ", -1)
+			}
+			if err = ioutil.WriteFile(dstPath+"/config", []byte(newconf), 0644); err != nil {
+				return err
+			}
+			return container.SetContainerConf(dst, [][]string{
+				{"lxc.utsname", dst},
+				{"subutai.git.branch", dst},
+			})
+		}, func() error {
+			return ioutil.WriteFile(dstPath+"/config", conf, 0644)
+		}},
+		{"updating database", func() error {
+			return renameDB(src, dst)
+		}, func() error {
+			return renameDB(dst, src)
+		}},
+		{"updating GPG key", func() error {
+			return renameKey(src, dst, fingerprint)
+		}, func() error {
+			return restoreKey(dst)
+		}},
+		{"updating nginx includes", func() error {
+			return renameIncludes(srcPath+"/", dstPath+"/", includes)
+		}, func() error {
+			for file, data := range includes {
+				log.Check(log.WarnLevel, "Restoring "+file, ioutil.WriteFile(file, data, 0744))
+			}
+			return nil
+		}},
+		{"starting container", func() error {
+			if run {
+				return container.Start(dst)
+			}
+			return nil
+		}, func() error {
+			if run {
+				return container.Stop(dst, false)
+			}
+			return nil
+		}},
+	}
 
-	if run {
-		log.Check(log.ErrorLevel, "Starting container", container.Start(dst))
+	for i, step := range steps {
+		log.Debug("Rename " + src + ": " + step.name)
+		if err := step.do(); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				log.Check(log.WarnLevel, "Reverting "+steps[j].name, steps[j].undo())
+			}
+			if len(includes) > 0 {
+				reloadNginx()
+			}
+			log.Error("Renaming " + src + " failed while " + step.name + ", " + err.Error())
+		}
+	}
+
+	for _, f := range []string{"public.pub", "secret.sec"} {
+		os.Remove(dstPath + "/" + f + ".old")
+	}
+	if len(includes) > 0 {
+		reloadNginx()
 	}
 
 	log.Info("Container " + src + " successfully renamed to " + dst)
 }
+
+// renameDB moves container data in the database to the new name
+func renameDB(src, dst string) error {
+	bolt, err := db.New()
+	if err != nil {
+		return err
+	}
+	defer bolt.Close()
+	return bolt.ContainerRename(src, dst)
+}
+
+// renameKey replaces user id of the container GPG key with the one of the new name, keeping copies of the key files aside.
+// The key must keep its fingerprint, since it identifies the container on the Management server.
+func renameKey(src, dst, fingerprint string) error {
+	path := config.Agent.LxcPrefix + dst + "/"
+	if _, err := os.Stat(path + "public.pub"); os.IsNotExist(err) {
+		return nil
+	}
+	for _, f := range []string{"public.pub", "secret.sec"} {
+		data, err := ioutil.ReadFile(path + f)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(path+f+".old", data, 0600); err != nil {
+			return err
+		}
+	}
+	if err := gpg.RenameKey(config.Agent.LxcPrefix+dst, src, dst); err != nil {
+		return err
+	}
+	if fp := gpg.GetFingerprint(dst); fp == "" || fp != fingerprint {
+		return errors.New("key of " + dst + " is not found")
+	}
+	return nil
+}
+
+// restoreKey brings back GPG key files saved by renameKey
+func restoreKey(name string) error {
+	path := config.Agent.LxcPrefix + name + "/"
+	for _, f := range []string{"public.pub", "secret.sec"} {
+		if _, err := os.Stat(path + f + ".old"); err == nil {
+			if err = os.Rename(path+f+".old", path+f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renameIncludes replaces container paths in nginx includes, saving original content of the changed files
+func renameIncludes(src, dst string, backup map[string][]byte) error {
+	return filepath.Walk(config.Agent.DataPrefix+"nginx-includes", func(path string, f os.FileInfo, err error) error {
+		if err != nil || f.IsDir() {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil || !strings.Contains(string(data), src) {
+			return err
+		}
+		backup[path] = data
+		return ioutil.WriteFile(path, []byte(strings.Replace(string(data), src, dst, -1)), 0744)
+	})
+}
+
+func reloadNginx() {
+	out, err := exec.Command("nginx", "-s", "reload").CombinedOutput()
+	log.Check(log.WarnLevel, "Reloading nginx "+string(out), err)
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/subutai-io/agent/config"
 	lxcContainer "github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/lib/event"
 	"github.com/subutai-io/agent/lib/fs"
 	"github.com/subutai-io/agent/lib/template"
 	"github.com/subutai-io/agent/log"
@@ -91,6 +92,16 @@ func RestoreContainer(container, date, newContainer string, force bool) {
 		fs.SetVolReadOnly(volume, false)
 		volumeName := strings.Replace(path.Base(volume), "@parent", "", -1)
 
+		// named volumes are restored only if they don't exist anymore, otherwise the backup copy is kept in the container directory
+		if name := strings.TrimPrefix(volumeName, volumePrefix); name != volumeName {
+			if !lxcContainer.IsVolume(name) {
+				log.Check(log.WarnLevel, "Creating volumes directory", os.MkdirAll(config.Agent.LxcPrefix+"volumes", 0755))
+				log.Check(log.WarnLevel, "Restoring volume "+name, os.Rename(volume, lxcContainer.VolumePath(name)))
+				continue
+			}
+			log.Warn("Volume " + name + " exists, its backup copy is kept in " + config.Agent.LxcPrefix + newContainer + "/" + volumeName)
+		}
+
 		if _, err := os.Stat(config.Agent.LxcPrefix + newContainer + "/" + volumeName); err == nil {
 			log.Check(log.FatalLevel, "Copying "+volume+" content to "+config.Agent.LxcPrefix+newContainer+"/"+volumeName,
 				exec.Command("rsync", "-av", volume+"/", config.Agent.LxcPrefix+newContainer+"/"+volumeName+"/").Run())
@@ -122,6 +133,8 @@ func RestoreContainer(container, date, newContainer string, force bool) {
 		{"lxc.utsname", newContainer},
 		{"lxc.mount", config.Agent.LxcPrefix + newContainer + "/fstab"},
 	})
+	lxcContainer.RestoreMounts(container, newContainer)
+	event.Add(newContainer, event.Restore, "restored from backup of "+container+" "+date)
 
 }
 
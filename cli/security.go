@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/log"
+)
+
+// SecuritySet changes confinement of the Subutai container or template: AppArmor profile, seccomp policy and dropped capabilities.
+// Profile option applies one of the built-in profiles: "default", "strict" or "nesting", other options override its parts.
+// AppArmor and seccomp options accept built-in profile names as well as AppArmor profile name and seccomp policy file path.
+// Capabilities are passed as comma separated list, e.g. sys_ptrace,net_raw; "none" keeps only capabilities dropped by LXC defaults.
+// Containers cloned from a template inherit its settings. Running containers use new settings after restart.
+func SecuritySet(name, profile, apparmor, seccomp, caps string) {
+	if !container.ContainerOrTemplateExists(name) {
+		log.ErrorCode(log.ExitNotFound, "Container "+name+" not found")
+	}
+	if profile == "" && apparmor == "" && seccomp == "" && caps == "" {
+		log.ErrorCode(log.ExitUsage, "No security settings provided")
+	}
+
+	var p container.Profile
+	if profile != "" {
+		var ok bool
+		if p, ok = container.Profiles[profile]; !ok {
+			log.ErrorCode(log.ExitUsage, "Unknown profile "+profile+", expected one of "+strings.Join(profileNames(), ", "))
+		}
+	}
+	if apparmor != "" {
+		p.AppArmor = apparmor
+		if b, ok := container.Profiles[apparmor]; ok {
+			p.AppArmor = b.AppArmor
+		}
+	}
+	if seccomp != "" {
+		p.Seccomp = seccomp
+		if b, ok := container.Profiles[seccomp]; ok {
+			p.Seccomp = b.Seccomp
+		}
+	}
+	if caps != "" {
+		p.CapsDrop = nil
+		for _, c := range strings.FieldsFunc(strings.ToLower(caps), func(r rune) bool { return r == ',' || r == ' ' }) {
+			p.CapsDrop = append(p.CapsDrop, strings.TrimPrefix(c, "cap_"))
+		}
+	}
+
+	if err := container.SetSecurity(name, p); err != nil {
+		log.ErrorCode(log.ExitUsage, "Setting security of "+name+": "+err.Error())
+	}
+	log.Info(name + " security profile is " + container.Security(name).Name)
+	if container.State(name) == "RUNNING" {
+		log.Info("Restart " + name + " to apply the changes")
+	}
+}
+
+func profileNames() (list []string) {
+	for name := range container.Profiles {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
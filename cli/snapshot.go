@@ -0,0 +1,267 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/db"
+	"github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/lib/event"
+	"github.com/subutai-io/agent/lib/fs"
+	"github.com/subutai-io/agent/log"
+)
+
+var (
+	snapshotNameRx = regexp.MustCompile(`^[a-zA-Z0-9_-][a-zA-Z0-9._-]*$`)
+	snapshotVols   = []string{"rootfs", "home", "opt", "var"}
+)
+
+// snapshotItem is the structured output schema of the snapshot list:
+//	name, snapshot name
+//	created, snapshot creation time in unix format
+//	usage, disk space in bytes exclusively used by snapshot according to BTRFS quota groups
+type snapshotItem struct {
+	Name    string `json:"name"`
+	Created int64  `json:"created"`
+	Usage   int    `json:"usage"`
+}
+
+// SnapshotCreate takes a named read-only snapshot of each container's volume: rootfs, home, opt and var.
+// Snapshots are stored next to the container in the ".snapshots" directory and can be used as cheap local save points before risky changes.
+// Volumes are snapshotted into a temporary directory which is renamed to the snapshot name only when all of them succeeded,
+// so a failed command leaves no partial snapshot behind.
+// Unlike backups, snapshots are not archived and are destroyed together with the container.
+func SnapshotCreate(name, snapshot string) {
+	dir := snapshotDir(name, snapshot)
+	if _, err := os.Stat(dir); err == nil {
+		log.ErrorCode(log.ExitExists, "Snapshot "+snapshot+" of "+name+" already exists")
+	}
+
+	tmp := config.Agent.LxcPrefix + name + "/.snapshots/." + snapshot + ".tmp/"
+	removeSnapshot(tmp)
+	log.Check(log.ErrorLevel, "Creating snapshot directory", os.MkdirAll(tmp, 0755))
+
+	for _, vol := range snapshotVols {
+		if _, err := os.Stat(config.Agent.LxcPrefix + name + "/" + vol); os.IsNotExist(err) {
+			continue
+		}
+		if err := fs.Snapshot(config.Agent.LxcPrefix+name+"/"+vol, tmp+vol, true); err != nil {
+			removeSnapshot(tmp)
+			log.Error("Snapshotting " + vol + " of " + name + ", " + err.Error())
+		}
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		removeSnapshot(tmp)
+		log.Error("Saving snapshot " + snapshot + " of " + name + ", " + err.Error())
+	}
+	log.Info("Snapshot " + snapshot + " of " + name + " created")
+}
+
+// SnapshotList shows snapshots of the container with their creation time and exclusive disk usage.
+func SnapshotList(name string) {
+	snapshotDir(name, "")
+	list, _ := ioutil.ReadDir(config.Agent.LxcPrefix + name + "/.snapshots/")
+
+	items := []snapshotItem{}
+	for _, f := range list {
+		if !f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		item := snapshotItem{Name: f.Name(), Created: f.ModTime().Unix()}
+		for _, vol := range snapshotVols {
+			if usage, err := strconv.Atoi(fs.Stat(name+"/.snapshots/"+f.Name()+"/"+vol, "usage", true)); err == nil {
+				item.Usage += usage
+			}
+		}
+		items = append(items, item)
+	}
+
+	output(items, func() {
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+		fmt.Fprintln(w, "NAME\tCREATED\tUSAGE")
+		fmt.Fprintln(w, "----\t-------\t-----")
+		for _, item := range items {
+			fmt.Fprintf(w, "%s\t%s\t%.2fMiB\n", item.Name, time.Unix(item.Created, 0).Format("2006-01-02 15:04:05"), float64(item.Usage)/1024/1024)
+		}
+		w.Flush()
+	})
+}
+
+// SnapshotRollback restores container volumes from the snapshot.
+// The container is stopped during rollback, current volumes are swapped with writable copies of the snapshot and then destroyed.
+// The swap is recorded in the ".rollback" journal of the container: if rollback is interrupted, the next rollback command
+// first completes the swap or restores original volumes according to the journal.
+// Container config, network settings and quotas are preserved; the container is started again if it was running before rollback.
+func SnapshotRollback(name, snapshot string) {
+	dir := snapshotDir(name, snapshot)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		log.ErrorCode(log.ExitNotFound, "Snapshot "+snapshot+" of "+name+" not found")
+	}
+	if recoverRollback(name) {
+		log.Warn("Interrupted rollback of " + name + " recovered")
+	}
+
+	running := container.State(name) == "RUNNING"
+	if running {
+		log.Check(log.ErrorLevel, "Stopping container "+name, container.Stop(name, false))
+	}
+
+	// fail restores original volumes, removes prepared copies of the snapshot and starts the container again
+	fail := func(msg string, err error) {
+		recoverRollback(name)
+		if running {
+			log.Check(log.WarnLevel, "Starting container "+name, container.Start(name))
+		}
+		log.Error(msg + ", " + err.Error())
+	}
+
+	journal := rollbackJournal{Snapshot: snapshot}
+	for _, vol := range snapshotVols {
+		if _, err := os.Stat(dir + vol); err == nil {
+			journal.Volumes = append(journal.Volumes, vol)
+		}
+	}
+	if err := writeJournal(name, journal); err != nil {
+		fail("Writing rollback journal of "+name, err)
+	}
+
+	for _, vol := range journal.Volumes {
+		if err := fs.Snapshot(dir+vol, config.Agent.LxcPrefix+name+"/"+vol+".rollback", false); err != nil {
+			fail("Preparing "+vol+" of "+name, err)
+		}
+	}
+
+	for _, vol := range journal.Volumes {
+		path := config.Agent.LxcPrefix + name + "/" + vol
+		err := os.Rename(path, path+".old")
+		if err == nil {
+			err = os.Rename(path+".rollback", path)
+		}
+		if err != nil {
+			fail("Rolling back "+vol+" of "+name, err)
+		}
+	}
+
+	// all volumes are swapped, from now on the interrupted rollback is completed instead of reverted
+	journal.Swapped = true
+	if err := writeJournal(name, journal); err != nil {
+		fail("Writing rollback journal of "+name, err)
+	}
+	recoverRollback(name)
+
+	// new subvolumes have own quota groups, restoring limits
+	fs.DiskQuota(name)
+	bolt, err := db.New()
+	if !log.Check(log.WarnLevel, "Opening database", err) {
+		quota := bolt.ContainerQuotas(name)
+		log.Check(log.WarnLevel, "Closing database", bolt.Close())
+		if size, ok := quota["disk"]; ok {
+			fs.DiskQuota(name, size)
+		}
+		for _, vol := range journal.Volumes {
+			if size, ok := quota[vol]; ok {
+				fs.Quota(name+"/"+vol, size)
+			}
+		}
+	}
+
+	event.Add(name, event.Restore, "rolled back to snapshot "+snapshot)
+	if running {
+		log.Check(log.ErrorLevel, "Starting container "+name, container.Start(name))
+	}
+	log.Info(name + " rolled back to snapshot " + snapshot)
+}
+
+// SnapshotDelete destroys the container snapshot and its quota groups.
+func SnapshotDelete(name, snapshot string) {
+	dir := snapshotDir(name, snapshot)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		log.ErrorCode(log.ExitNotFound, "Snapshot "+snapshot+" of "+name+" not found")
+	}
+	removeSnapshot(dir)
+	log.Info("Snapshot " + snapshot + " of " + name + " deleted")
+}
+
+// removeSnapshot destroys snapshot volumes and the snapshot directory, if it exists
+func removeSnapshot(dir string) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return
+	}
+	for _, vol := range snapshotVols {
+		if _, err := os.Stat(dir + vol); err == nil {
+			fs.SubvolumeDestroy(dir + vol)
+		}
+	}
+	log.Check(log.ErrorLevel, "Removing snapshot directory", os.RemoveAll(dir))
+}
+
+// rollbackJournal records the volume swap of the rollback in progress
+type rollbackJournal struct {
+	Snapshot string   `json:"snapshot"`
+	Volumes  []string `json:"volumes"`
+	Swapped  bool     `json:"swapped"`
+}
+
+// writeJournal atomically replaces the rollback journal of the container
+func writeJournal(name string, journal rollbackJournal) error {
+	data, err := json.Marshal(journal)
+	if err != nil {
+		return err
+	}
+	path := config.Agent.LxcPrefix + name + "/.rollback"
+	if err = ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// recoverRollback brings the container out of the interrupted rollback recorded in its journal.
+// If all volumes were swapped, the old ones are destroyed, otherwise original volumes are restored.
+// Prepared copies of the snapshot are destroyed in both cases. It returns false if there was no journal.
+func recoverRollback(name string) bool {
+	path := config.Agent.LxcPrefix + name + "/.rollback"
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false
+	}
+	log.Check(log.ErrorLevel, "Reading rollback journal of "+name, err)
+	var journal rollbackJournal
+	log.Check(log.ErrorLevel, "Parsing rollback journal of "+name, json.Unmarshal(data, &journal))
+
+	for _, vol := range journal.Volumes {
+		vol = config.Agent.LxcPrefix + name + "/" + vol
+		if _, err := os.Stat(vol + ".old"); err == nil && !journal.Swapped {
+			if _, err := os.Stat(vol); err == nil {
+				fs.SubvolumeDestroy(vol)
+			}
+			log.Check(log.ErrorLevel, "Restoring "+vol+", rollback journal is kept for recovery", os.Rename(vol+".old", vol))
+		}
+		for _, leftover := range []string{vol + ".old", vol + ".rollback"} {
+			if _, err := os.Stat(leftover); err == nil {
+				fs.SubvolumeDestroy(leftover)
+			}
+		}
+	}
+	log.Check(log.ErrorLevel, "Removing rollback journal of "+name, os.Remove(path))
+	return true
+}
+
+// snapshotDir validates container and snapshot names and returns snapshot directory
+func snapshotDir(name, snapshot string) string {
+	if !container.IsContainer(name) {
+		log.ErrorCode(log.ExitNotFound, name+" is not a container")
+	}
+	if snapshot != "" && !snapshotNameRx.MatchString(snapshot) {
+		log.ErrorCode(log.ExitUsage, "Invalid snapshot name "+snapshot)
+	}
+	return config.Agent.LxcPrefix + name + "/.snapshots/" + snapshot + "/"
+}
@@ -11,15 +11,20 @@ import (
 // If state is not changing for 60 seconds, then the "start" operation is considered to have failed.
 func LxcStart(name string) {
 	if container.ContainerOrTemplateExists(name) && container.State(name) == "STOPPED" {
-		startErr := container.Start(name)
-		for i := 0; i < 60 && startErr != nil; i++ {
-			log.Info("Waiting for container start (60 sec)")
-			startErr = container.Start(name)
-			time.Sleep(time.Second)
-		}
-		if startErr != nil {
+		if startContainer(name) != nil {
 			log.Error(name + " start failed")
 		}
 		log.Info(name + " started")
 	}
 }
+
+// startContainer starts the container retrying for 60 seconds, it returns the last start error
+func startContainer(name string) error {
+	err := container.Start(name)
+	for i := 0; i < 60 && err != nil; i++ {
+		log.Info("Waiting for container start (60 sec)")
+		err = container.Start(name)
+		time.Sleep(time.Second)
+	}
+	return err
+}
@@ -8,14 +8,19 @@ import (
 // LxcStop stops a Subutai container with an additional state check.
 func LxcStop(name string) {
 	if container.ContainerOrTemplateExists(name) && container.State(name) == "RUNNING" {
-		stopErr := container.Stop(name, true)
-		for i := 0; i < 60 && stopErr != nil; i++ {
-			log.Info("Waiting for container stop (60 sec)")
-			stopErr = container.Stop(name, true)
-		}
-		if stopErr != nil {
+		if stopContainer(name) != nil {
 			log.Error(name + " stop failed")
 		}
 		log.Info(name + " stopped")
 	}
 }
+
+// stopContainer stops the container retrying up to 60 times, it returns the last stop error
+func stopContainer(name string) error {
+	err := container.Stop(name, true)
+	for i := 0; i < 60 && err != nil; i++ {
+		log.Info("Waiting for container stop (60 sec)")
+		err = container.Stop(name, true)
+	}
+	return err
+}
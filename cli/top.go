@@ -0,0 +1,234 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/db"
+	"github.com/subutai-io/agent/lib/cgroup"
+	"github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/lib/fs"
+	"github.com/subutai-io/agent/log"
+)
+
+var topSort = []string{"name", "cpu", "ram", "disk", "net", "pids", "saturation"}
+
+// topItem is the structured output schema of the top command:
+//	name, container name
+//	cpu, CPU usage in percents of the host CPU capacity
+//	cpuQuota, CPU quota in percents, 0 if not limited
+//	ram, ramQuota, memory usage and limit in bytes, limit is 0 if not limited
+//	disk, diskQuota, disk usage and limit in bytes, limit is 0 if not limited
+//	netIn, netOut, network throughput of the container in bytes per second
+//	pids, number of processes
+//	saturation, usage of the most saturated quota in percents
+type topItem struct {
+	Name       string  `json:"name"`
+	CPU        float64 `json:"cpu"`
+	CPUQuota   int     `json:"cpuQuota"`
+	RAM        int     `json:"ram"`
+	RAMQuota   int     `json:"ramQuota"`
+	Disk       int     `json:"disk"`
+	DiskQuota  int     `json:"diskQuota"`
+	NetIn      int     `json:"netIn"`
+	NetOut     int     `json:"netOut"`
+	Pids       int     `json:"pids"`
+	Saturation int     `json:"saturation"`
+}
+
+// topSample holds cumulative counters of the container
+type topSample struct {
+	ticks, rx, tx int
+	time          time.Time
+}
+
+// Top shows resource usage of the running containers, refreshing the view every interval seconds until interrupted.
+// Values are read from the same cgroup counters as alerts and metrics. Containers can be filtered by vlan or environment
+// and sorted by name, cpu, ram, disk, net, pids or saturation, which is usage of the most utilized quota.
+// With "once" option usage is measured over a single second and printed once; "json" option prints it in json format.
+func Top(sortBy, vlan, env string, interval int, once, json bool) {
+	if !stringInList(sortBy, topSort) {
+		log.ErrorCode(log.ExitUsage, "Unsupported sort key "+sortBy+", expected one of "+strings.Join(topSort, ", "))
+	}
+	if json {
+		SetFormat("json")
+	}
+	if interval <= 0 || once {
+		interval = 1
+	}
+
+	prev := topSamples()
+	for {
+		time.Sleep(time.Second * time.Duration(interval))
+		cur := topSamples()
+		items := topItems(prev, cur, topSelected(vlan, env))
+		prev = cur
+		topOrder(items, sortBy)
+
+		if once || Format != "table" {
+			output(items, func() { printTop(items) })
+		} else {
+			fmt.Print("\033[H\033[2J")
+			fmt.Println("subutai top - " + time.Now().Format("15:04:05") + ", " + strconv.Itoa(len(items)) + " containers, sorted by " + sortBy)
+			printTop(items)
+		}
+		if once {
+			return
+		}
+	}
+}
+
+// topSelected returns containers of the vlan and environment, nil means that containers are not filtered
+func topSelected(vlan, env string) (list []string) {
+	if vlan == "" && env == "" {
+		return nil
+	}
+	bolt, err := db.New()
+	log.Check(log.ErrorLevel, "Opening database", err)
+	defer bolt.Close()
+	list = []string{}
+	for _, name := range container.Containers() {
+		meta := bolt.ContainerByName(name)
+		if (vlan == "" || meta["vlan"] == vlan) && (env == "" || meta["environment"] == env) {
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+// topSamples reads cumulative CPU and network counters of the running containers
+func topSamples() map[string]topSample {
+	samples := make(map[string]topSample)
+	for _, name := range cgroup.Containers() {
+		s := topSample{time: time.Now()}
+		if user, system, err := cgroup.CPUStat(name); err == nil {
+			s.ticks = user + system
+		}
+		nic := container.GetConfigItem(config.Agent.LxcPrefix+name+"/config", "lxc.network.veth.pair")
+		if nic != "" {
+			// host side of veth pair receives what the container sends
+			s.tx = readCounter("/sys/class/net/" + nic + "/statistics/rx_bytes")
+			s.rx = readCounter("/sys/class/net/" + nic + "/statistics/tx_bytes")
+		}
+		samples[name] = s
+	}
+	return samples
+}
+
+func readCounter(path string) int {
+	out, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	value, _ := strconv.Atoi(strings.TrimSpace(string(out)))
+	return value
+}
+
+// topItems calculates usage between two samples
+func topItems(prev, cur map[string]topSample, selected []string) []topItem {
+	disk := fs.Usage()
+	items := []topItem{}
+	for name, s := range cur {
+		p, ok := prev[name]
+		if !ok || (selected != nil && !stringInList(name, selected)) {
+			continue
+		}
+		item := topItem{Name: name}
+		if sec := s.time.Sub(p.time).Seconds(); sec > 0 {
+			// cpuacct ticks are 1/100 of a second
+			item.CPU = float64(s.ticks-p.ticks) / sec / float64(runtime.NumCPU())
+			item.NetIn = int(float64(s.rx-p.rx) / sec)
+			item.NetOut = int(float64(s.tx-p.tx) / sec)
+		}
+		if quota, period, err := cgroup.CPULimit(name); err == nil && quota > 0 && period > 0 {
+			item.CPUQuota = quota * 100 / period / runtime.NumCPU()
+		}
+		item.RAM, _ = cgroup.MemoryUsage(name)
+		if limit, err := cgroup.MemoryLimit(name); err == nil && limit > 0 {
+			item.RAMQuota = limit
+		}
+		if d, ok := disk[name]; ok {
+			item.Disk, item.DiskQuota = d[0], d[1]
+		}
+		pidsLimit := 0
+		item.Pids, pidsLimit, _ = cgroup.Pids(name)
+
+		for _, v := range [][]float64{
+			{item.CPU, float64(item.CPUQuota)},
+			{float64(item.RAM), float64(item.RAMQuota)},
+			{float64(item.Disk), float64(item.DiskQuota)},
+			{float64(item.Pids), float64(pidsLimit)},
+		} {
+			if v[1] > 0 && int(v[0]*100/v[1]) > item.Saturation {
+				item.Saturation = int(v[0] * 100 / v[1])
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func topOrder(items []topItem, sortBy string) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		switch sortBy {
+		case "cpu":
+			return a.CPU > b.CPU
+		case "ram":
+			return a.RAM > b.RAM
+		case "disk":
+			return a.Disk > b.Disk
+		case "net":
+			return a.NetIn+a.NetOut > b.NetIn+b.NetOut
+		case "pids":
+			return a.Pids > b.Pids
+		case "saturation":
+			return a.Saturation > b.Saturation
+		}
+		return a.Name < b.Name
+	})
+}
+
+func printTop(items []topItem) {
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintln(w, "NAME\tCPU%\tRAM\tDISK\tNET IN/s\tNET OUT/s\tPIDS\tSAT%")
+	fmt.Fprintln(w, "----\t----\t---\t----\t--------\t---------\t----\t----")
+	for _, i := range items {
+		cpu := strconv.FormatFloat(i.CPU, 'f', 1, 64)
+		if i.CPUQuota > 0 {
+			cpu += "/" + strconv.Itoa(i.CPUQuota)
+		}
+		fmt.Fprintln(w, i.Name+"\t"+cpu+"\t"+topBytes(i.RAM, i.RAMQuota)+"\t"+topBytes(i.Disk, i.DiskQuota)+"\t"+
+			topBytes(i.NetIn, 0)+"\t"+topBytes(i.NetOut, 0)+"\t"+strconv.Itoa(i.Pids)+"\t"+strconv.Itoa(i.Saturation))
+	}
+	w.Flush()
+}
+
+// topBytes formats usage in human readable units, followed by the limit if it is set
+func topBytes(value, limit int) string {
+	format := func(v int) string {
+		units := []string{"B", "K", "M", "G", "T"}
+		f := float64(v)
+		i := 0
+		for ; f >= 1024 && i < len(units)-1; i++ {
+			f /= 1024
+		}
+		if i == 0 {
+			return strconv.Itoa(v) + units[0]
+		}
+		return strconv.FormatFloat(f, 'f', 1, 64) + units[i]
+	}
+	if limit > 0 {
+		return format(value) + "/" + format(limit)
+	}
+	return format(value)
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+
+	"github.com/subutai-io/agent/lib/template"
+	"github.com/subutai-io/agent/log"
+)
+
+// trustItem is the structured output schema of the trust list command:
+//	owner, template owner
+//	fingerprint, fingerprint of the owner public key
+//	identity, user identity of the key
+type trustItem template.Key
+
+// TrustAdd adds public GPG key of the template owner to the trust store. The key is read from the armored key file, "-" reads it from standard input.
+// Without key file, keys of the owner are fetched from the CDN, fingerprints of added keys are printed and should be checked by the user. Signatures of imported templates are verified with keys from the trust store according to
+// the signature policy set by "policy" option of [template] section of the agent config: "off", "warn", "verify" or "enforce".
+func TrustAdd(owner, file string) {
+	var keys []string
+	switch file {
+	case "":
+		var err error
+		keys, err = template.CDNKeys(owner)
+		log.Check(log.ErrorLevel, "Getting keys of "+owner+" from CDN", err)
+		if len(keys) == 0 {
+			log.ErrorCode(log.ExitNotFound, "No keys of "+owner+" found on CDN")
+		}
+	case "-":
+		key, err := ioutil.ReadAll(os.Stdin)
+		log.Check(log.ErrorLevel, "Reading key from standard input", err)
+		keys = append(keys, string(key))
+	default:
+		key, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.ErrorCode(log.ExitNotFound, "Reading key file "+file+": "+err.Error())
+		}
+		keys = append(keys, string(key))
+	}
+
+	for _, key := range keys {
+		k, err := template.Trust(owner, key)
+		if err != nil {
+			log.ErrorCode(log.ExitUsage, "Adding key of "+owner+": "+err.Error())
+		}
+		log.Info("Key " + k.Fingerprint + " " + k.Identity + " of " + owner + " added to trust store")
+	}
+}
+
+// TrustList prints template owner keys in the trust store
+func TrustList() {
+	items := []trustItem{}
+	for _, owner := range template.TrustedOwners() {
+		for _, k := range template.TrustedKeys(owner) {
+			items = append(items, trustItem(k))
+		}
+	}
+
+	output(items, func() {
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+		fmt.Fprintln(w, "OWNER\tFINGERPRINT\tIDENTITY")
+		fmt.Fprintln(w, "-----\t-----------\t--------")
+		for _, i := range items {
+			fmt.Fprintln(w, i.Owner+"\t"+i.Fingerprint+"\t"+i.Identity)
+		}
+		w.Flush()
+	})
+}
+
+// TrustRemove removes the owner key with the fingerprint from the trust store, all keys of the owner are removed if fingerprint is omitted
+func TrustRemove(owner, fingerprint string) {
+	n, err := template.Untrust(owner, fingerprint)
+	log.Check(log.ErrorLevel, "Removing keys of "+owner, err)
+	if n == 0 {
+		log.ErrorCode(log.ExitNotFound, "No matching keys of "+owner+" in trust store")
+	}
+	log.Info(fmt.Sprintf("%d key(s) of %s removed from trust store", n, owner))
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/subutai-io/agent/db"
+	"github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/log"
+)
+
+// TTLExtend prolongs lifetime of the container created with "clone --ttl" by the duration, e.g. 30m, 2h or 1d.
+// Expired containers are destroyed by the daemon, so only containers which still exist can be extended.
+func TTLExtend(name, duration string) {
+	if !container.IsContainer(name) {
+		log.ErrorCode(log.ExitNotFound, name+" is not a container")
+	}
+	ttl := parseTTL(duration)
+
+	bolt, err := db.New()
+	log.Check(log.ErrorLevel, "Opening database", err)
+	defer bolt.Close()
+	expires, ok := expiry(bolt.ContainerByName(name))
+	if !ok {
+		log.ErrorCode(log.ExitUsage, name+" has no TTL")
+	}
+	if expires.Before(time.Now()) {
+		expires = time.Now()
+	}
+	expires = expires.Add(ttl)
+	log.Check(log.ErrorLevel, "Writing container data to database",
+		bolt.ContainerAdd(name, map[string]string{"expires": strconv.FormatInt(expires.Unix(), 10)}))
+	log.Info(name + " expires at " + expires.Format(time.RFC3339))
+}
+
+// parseTTL parses container lifetime, in addition to time.ParseDuration units "d" suffix means days
+func parseTTL(duration string) time.Duration {
+	var ttl time.Duration
+	var err error
+	if days := strings.TrimSuffix(duration, "d"); days != duration {
+		var n int
+		n, err = strconv.Atoi(days)
+		ttl = time.Duration(n) * 24 * time.Hour
+	} else {
+		ttl, err = time.ParseDuration(duration)
+	}
+	if err != nil || ttl <= 0 {
+		log.ErrorCode(log.ExitUsage, "Invalid TTL "+duration+", expected positive duration, e.g. 30m, 2h or 1d")
+	}
+	return ttl
+}
+
+// expiry returns expiration time from container metadata, ok is false if container has no TTL
+func expiry(meta map[string]string) (expires time.Time, ok bool) {
+	sec, err := strconv.ParseInt(meta["expires"], 10, 64)
+	if err != nil || sec == 0 {
+		return
+	}
+	return time.Unix(sec, 0), true
+}
+
+// remaining formats lifetime left until container expiry, rounded to seconds
+func remaining(expires time.Time) string {
+	left := time.Until(expires)
+	if left < 0 {
+		return "expired"
+	}
+	return (left / time.Second * time.Second).String()
+}
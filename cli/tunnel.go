@@ -28,7 +28,7 @@ import (
 // TunAdd adds tunnel to specified network socket
 func TunAdd(socket, timeout string, global bool) {
 	if len(socket) == 0 {
-		log.Error("Please specify socket")
+		log.ErrorCode(log.ExitUsage, "Please specify socket")
 	}
 
 	if len(strings.Split(socket, ":")) == 1 {
@@ -98,6 +98,16 @@ func prepareKey() {
 	}
 }
 
+// tunnelItem is the structured output schema of the tunnel list:
+//	remote, public socket of the tunnel
+//	local, tunneled local socket
+//	ttl, tunnel expiration time in unix format, -1 for permanent tunnels
+type tunnelItem struct {
+	Remote string `json:"remote"`
+	Local  string `json:"local"`
+	TTL    string `json:"ttl"`
+}
+
 // TunList performs tunnel check and shows "alive" tunnels
 func TunList() {
 	TunCheck()
@@ -106,9 +116,15 @@ func TunList() {
 	list := bolt.GetTunList()
 	log.Check(log.WarnLevel, "Closing database", bolt.Close())
 
+	items := []tunnelItem{}
 	for _, item := range list {
-		fmt.Printf("%s\t%s\t%s\n", item["remote"], item["local"], item["ttl"])
+		items = append(items, tunnelItem{Remote: item["remote"], Local: item["local"], TTL: item["ttl"]})
 	}
+	output(items, func() {
+		for _, item := range items {
+			fmt.Printf("%s\t%s\t%s\n", item.Remote, item.Local, item.TTL)
+		}
+	})
 }
 
 // TunDel removes tunnel entry from list and kills running tunnel process
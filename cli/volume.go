@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/lib/fs"
+	"github.com/subutai-io/agent/log"
+)
+
+// volumeItem is the structured output schema of the volume list command:
+//	name, volume name
+//	used, quota, disk usage and limit in bytes, limit is 0 if not limited
+//	mounts, container:path pairs of the containers using the volume
+type volumeItem struct {
+	Name   string   `json:"name"`
+	Used   int      `json:"used"`
+	Quota  int      `json:"quota"`
+	Mounts []string `json:"mounts"`
+}
+
+// VolumeCreate creates named volume, a BTRFS subvolume which can be mounted into one or more containers and outlives them.
+// Size sets the volume quota in Gb.
+func VolumeCreate(name, size string) {
+	if err := container.ValidVolume(name); err != nil {
+		log.ErrorCode(log.ExitUsage, err.Error())
+	}
+	if container.IsVolume(name) {
+		log.ErrorCode(log.ExitExists, "Volume "+name+" already exists")
+	}
+	log.Check(log.ErrorLevel, "Creating volumes directory", os.MkdirAll(config.Agent.LxcPrefix+"volumes", 0755))
+	fs.SubvolumeCreate(container.VolumePath(name))
+	if size != "" {
+		log.Check(log.ErrorLevel, "Setting quota of volume "+name, fs.LimitVolume("volumes/"+name, size))
+	}
+	log.Info("Volume " + name + " created")
+}
+
+// VolumeList prints named volumes with their usage and containers they are mounted to
+func VolumeList() {
+	usage := fs.Usage()
+	items := []volumeItem{}
+	for _, name := range container.Volumes() {
+		item := volumeItem{Name: name, Mounts: []string{}}
+		if u, ok := usage["volumes/"+name]; ok {
+			item.Used, item.Quota = u[0], u[1]
+		}
+		for cont, paths := range container.VolumeMounts(name) {
+			for _, p := range paths {
+				item.Mounts = append(item.Mounts, cont+":"+p)
+			}
+		}
+		sort.Strings(item.Mounts)
+		items = append(items, item)
+	}
+
+	output(items, func() {
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+		fmt.Fprintln(w, "NAME\tUSED\tMOUNTS")
+		fmt.Fprintln(w, "----\t----\t------")
+		for _, i := range items {
+			fmt.Fprintln(w, i.Name+"\t"+topBytes(i.Used, i.Quota)+"\t"+strings.Join(i.Mounts, ","))
+		}
+		w.Flush()
+	})
+}
+
+// VolumeAttach mounts the volume into the container at the path. The same volume may be attached to several containers
+// sharing the same uid base; files of the volume belong to the user namespace of the first container it was attached to,
+// so attaching it to a container with different uid base is refused.
+// Running container gets the volume after restart.
+func VolumeAttach(name, cont, path string, readonly bool) {
+	if !container.IsVolume(name) {
+		log.ErrorCode(log.ExitNotFound, "Volume "+name+" not found")
+	}
+	if !container.IsContainer(cont) {
+		log.ErrorCode(log.ExitNotFound, cont+" is not a container")
+	}
+	if err := container.AttachVolume(name, cont, path, readonly); err != nil {
+		log.ErrorCode(log.ExitUsage, "Attaching volume "+name+": "+err.Error())
+	}
+	log.Info("Volume " + name + " attached to " + cont + ":" + path)
+	if container.State(cont) == "RUNNING" {
+		log.Info("Restart " + cont + " to mount the volume")
+	}
+}
+
+// VolumeDetach removes mounts of the volume from the container, the volume data is kept
+func VolumeDetach(name, cont string) {
+	if !container.ContainerOrTemplateExists(cont) {
+		log.ErrorCode(log.ExitNotFound, "Container "+cont+" not found")
+	}
+	found, err := container.DetachVolume(name, cont)
+	log.Check(log.ErrorLevel, "Detaching volume "+name, err)
+	if !found {
+		log.ErrorCode(log.ExitNotFound, "Volume "+name+" is not attached to "+cont)
+	}
+	log.Info("Volume " + name + " detached from " + cont)
+	if container.State(cont) == "RUNNING" {
+		log.Info("Restart " + cont + " to unmount the volume")
+	}
+}
+
+// VolumeRemove destroys the volume and its data. Volumes attached to containers can't be removed.
+func VolumeRemove(name string) {
+	if !container.IsVolume(name) {
+		log.ErrorCode(log.ExitNotFound, "Volume "+name+" not found")
+	}
+	var users []string
+	for cont := range container.VolumeMounts(name) {
+		users = append(users, cont)
+	}
+	if len(users) > 0 {
+		sort.Strings(users)
+		log.ErrorCode(log.ExitUsage, "Volume "+name+" is attached to "+strings.Join(users, ", ")+", detach it first")
+	}
+	fs.SubvolumeDestroy(container.VolumePath(name))
+	log.Info("Volume " + name + " removed")
+}
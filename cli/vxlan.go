@@ -35,12 +35,25 @@ func tunnelCreate(tunnel, addr, vlan, vni string) {
 	log.Check(log.FatalLevel, "MakeVNIMap set port: ", exec.Command("ovs-vsctl", "--if-exists", "set", "port", tunnel, "tag="+vlan).Run())
 }
 
+// vxlanItem is the structured output schema of the VXLAN tunnels list:
+//	tunnel, OVS interface name
+//	remoteIp, remote peer address
+//	vlan, environment VLAN tag
+//	vni, VXLAN network identifier
+type vxlanItem struct {
+	Tunnel   string `json:"tunnel"`
+	RemoteIP string `json:"remoteIp"`
+	Vlan     string `json:"vlan"`
+	Vni      string `json:"vni"`
+}
+
 //tunnelList prints a list of existing VXLAN tunnels
 func tunnelList() {
 	ret, err := exec.Command("ovs-vsctl", "show").CombinedOutput()
 	log.Check(log.FatalLevel, "Getting OVS interfaces list", err)
 	ports := strings.Split(string(ret), "\n")
 
+	items := []vxlanItem{}
 	for k, port := range ports {
 		if strings.Contains(port, "remote_ip") {
 			tunnel := strings.Trim(strings.Trim(ports[k-2], "Interface "), "\"")
@@ -48,7 +61,12 @@ func tunnelList() {
 			addr := strings.Fields(port)
 			vni := strings.Trim(strings.Trim(addr[1], "{key="), "\",")
 			ip := strings.Trim(strings.Trim(addr[2], "remote_ip="), "\",")
-			fmt.Println(tunnel, ip, tag, vni)
+			items = append(items, vxlanItem{Tunnel: tunnel, RemoteIP: ip, Vlan: strings.TrimSpace(tag), Vni: vni})
 		}
 	}
+	output(items, func() {
+		for _, item := range items {
+			fmt.Println(item.Tunnel, item.RemoteIP, item.Vlan, item.Vni)
+		}
+	})
 }
@@ -49,6 +49,17 @@ type templateConfig struct {
 	Branch  string
 	Version string
 	Arch    string
+	Sources  string
+	Trusted  string
+	Verified string
+	Policy   string
+}
+type registryConfig struct {
+	Enable bool
+	Bind   string
+	Port   string
+	Allow  string
+	Sync   int
 }
 type configFile struct {
 	Agent      agentConfig
@@ -56,6 +67,7 @@ type configFile struct {
 	Influxdb   influxdbConfig
 	CDN        cdnConfig
 	Template   templateConfig
+	Registry   registryConfig
 }
 
 const defaultConfig = `
@@ -91,6 +103,17 @@ const defaultConfig = `
 	version = 5.0.0
 	branch =
 	arch = amd64
+	sources = cdn
+	trusted =
+	verified = subutai,jenkins,docker
+	policy = verify
+
+	[registry]
+	enable = false
+	bind =
+	port = 8338
+	allow =
+	sync = 0
 `
 
 var (
@@ -105,6 +128,8 @@ var (
 	CDN cdnConfig
 	// Template describes template configuration options
 	Template templateConfig
+	// Registry describes local template registry options: listening address and port, allowed peers and upstream sync interval in hours
+	Registry registryConfig
 )
 
 func init() {
@@ -139,6 +164,7 @@ func init() {
 	Template = config.Template
 	Management = config.Management
 	CDN = config.CDN
+	Registry = config.Registry
 
 	CDN.Kurjun = "https://" + CDN.URL + ":" + CDN.SSLport + "/kurjun/rest"
 
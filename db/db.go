@@ -1,6 +1,7 @@
 package db
 
 import (
+	"encoding/binary"
 	"strconv"
 
 	"github.com/boltdb/bolt"
@@ -14,6 +15,9 @@ var (
 	containers = []byte("containers")
 	templates  = []byte("templates")
 	portmap    = []byte("portmap")
+	profiles   = []byte("profiles")
+	events     = []byte("events")
+	trust      = []byte("trust")
 )
 
 type Instance struct {
@@ -34,7 +38,7 @@ func New() (*Instance, error) {
 
 func initdb(db *bolt.DB) error {
 	return db.Update(func(tx *bolt.Tx) error {
-		for _, b := range [][]byte{uuidmap, sshtunnels, containers, templates, portmap} {
+		for _, b := range [][]byte{uuidmap, sshtunnels, containers, templates, portmap, profiles, events, trust} {
 			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
 				return err
 			}
@@ -238,6 +242,24 @@ func (i *Instance) ContainerAdd(name string, options map[string]string) (err err
 	return
 }
 
+// ContainerSet sets the option of the container, empty value removes it. Unlike ContainerAdd it never creates the container bucket,
+// so options of destroyed or renamed containers are not recreated.
+func (i *Instance) ContainerSet(name, key, value string) (err error) {
+	i.db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(containers); b != nil {
+			if b = b.Bucket([]byte(name)); b != nil {
+				if len(value) == 0 {
+					err = b.Delete([]byte(key))
+				} else {
+					err = b.Put([]byte(key), []byte(value))
+				}
+			}
+		}
+		return nil
+	})
+	return
+}
+
 func (i *Instance) ContainerDel(name string) (err error) {
 	i.db.Update(func(tx *bolt.Tx) error {
 		if b := tx.Bucket(containers); b != nil {
@@ -268,6 +290,77 @@ func (i *Instance) ContainerQuota(name, res, quota string) (err error) {
 	return err
 }
 
+// ContainerQuotas returns quotas of the container saved by quota command.
+func (i *Instance) ContainerQuotas(name string) map[string]string {
+	quota := make(map[string]string)
+	i.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(containers); b != nil {
+			if b = b.Bucket([]byte(name)); b != nil {
+				if b = b.Bucket([]byte("quota")); b != nil {
+					b.ForEach(func(k, v []byte) error {
+						quota[string(k)] = string(v)
+						return nil
+					})
+				}
+			}
+		}
+		return nil
+	})
+	return quota
+}
+
+// ContainerRename moves all container data, including nested buckets, and UID map entry to the new name in a single transaction.
+func (i *Instance) ContainerRename(src, dst string) error {
+	return i.db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(containers); b != nil {
+			if old := b.Bucket([]byte(src)); old != nil {
+				c, err := b.CreateBucket([]byte(dst))
+				if err != nil {
+					return err
+				}
+				if err = copyBucket(old, c); err != nil {
+					return err
+				}
+				if err = b.DeleteBucket([]byte(src)); err != nil {
+					return err
+				}
+			}
+		}
+		if b := tx.Bucket(uuidmap); b != nil {
+			var uid []byte
+			b.ForEach(func(k, v []byte) error {
+				if string(v) == src {
+					uid = append([]byte{}, k...)
+				}
+				return nil
+			})
+			if uid != nil {
+				return b.Put(uid, []byte(dst))
+			}
+		}
+		return nil
+	})
+}
+
+// copyBucket recursively copies keys and nested buckets
+func copyBucket(src, dst *bolt.Bucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		nested, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		if seq := src.Bucket(k).Sequence(); seq > 0 {
+			if err = nested.SetSequence(seq); err != nil {
+				return err
+			}
+		}
+		return copyBucket(src.Bucket(k), nested)
+	})
+}
+
 func (i *Instance) ContainerMapping(name, protocol, external, domain, internal string) (err error) {
 	i.db.Update(func(tx *bolt.Tx) error {
 		if b := tx.Bucket(containers); b != nil {
@@ -289,6 +382,120 @@ func (i *Instance) ContainerMapping(name, protocol, external, domain, internal s
 	return
 }
 
+// ContainerLabel sets label of the container, empty value removes the label.
+func (i *Instance) ContainerLabel(name, key, value string) (err error) {
+	i.db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(containers); b != nil {
+			if b = b.Bucket([]byte(name)); b != nil {
+				if b, err = b.CreateBucketIfNotExists([]byte("labels")); err != nil {
+					return err
+				}
+				if len(value) == 0 {
+					err = b.Delete([]byte(key))
+				} else {
+					err = b.Put([]byte(key), []byte(value))
+				}
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// ContainerLabels returns all labels of the container.
+func (i *Instance) ContainerLabels(name string) map[string]string {
+	labels := make(map[string]string)
+	i.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(containers); b != nil {
+			if b = b.Bucket([]byte(name)); b != nil {
+				if b = b.Bucket([]byte("labels")); b != nil {
+					b.ForEach(func(k, v []byte) error {
+						labels[string(k)] = string(v)
+						return nil
+					})
+				}
+			}
+		}
+		return nil
+	})
+	return labels
+}
+
+// ContainerByLabel returns list of containers having label with specified value.
+func (i *Instance) ContainerByLabel(key, value string) (list []string) {
+	i.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(containers); b != nil {
+			b.ForEach(func(k, v []byte) error {
+				if c := b.Bucket(k); c != nil {
+					if c = c.Bucket([]byte("labels")); c != nil && string(c.Get([]byte(key))) == value {
+						list = append(list, string(k))
+					}
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return
+}
+
+// ContainerMount saves host directory bind mounted into the container, keyed by the container path. Nil options remove the mount.
+func (i *Instance) ContainerMount(name, target string, options map[string]string) (err error) {
+	i.db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(containers); b != nil {
+			if b, err = b.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+			if b, err = b.CreateBucketIfNotExists([]byte("mounts")); err != nil {
+				return err
+			}
+			if b.Bucket([]byte(target)) != nil {
+				if err = b.DeleteBucket([]byte(target)); err != nil {
+					return err
+				}
+			}
+			if options == nil {
+				return nil
+			}
+			if b, err = b.CreateBucket([]byte(target)); err != nil {
+				return err
+			}
+			for k, v := range options {
+				if err = b.Put([]byte(k), []byte(v)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// ContainerMounts returns host directories bind mounted into the container, container path is returned in "target" field.
+func (i *Instance) ContainerMounts(name string) (list []map[string]string) {
+	i.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(containers); b != nil {
+			if b = b.Bucket([]byte(name)); b != nil {
+				if b = b.Bucket([]byte("mounts")); b != nil {
+					b.ForEach(func(k, v []byte) error {
+						m := map[string]string{"target": string(k)}
+						if c := b.Bucket(k); c != nil {
+							c.ForEach(func(kk, vv []byte) error {
+								m[string(kk)] = string(vv)
+								return nil
+							})
+						}
+						list = append(list, m)
+						return nil
+					})
+				}
+			}
+		}
+		return nil
+	})
+	return
+}
+
 func (i *Instance) GetContainerMapping(name string) (list []map[string]string) {
 	i.db.View(func(tx *bolt.Tx) error {
 		if b := tx.Bucket(containers); b != nil {
@@ -496,3 +703,251 @@ func (i *Instance) PortmapList(protocol string) (list []string) {
 	})
 	return
 }
+
+// ProfileAdd saves quota profile, replacing existing profile with the same name.
+func (i *Instance) ProfileAdd(name string, options map[string]string) error {
+	return i.db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(profiles); b != nil {
+			if b.Bucket([]byte(name)) != nil {
+				if err := b.DeleteBucket([]byte(name)); err != nil {
+					return err
+				}
+			}
+			p, err := b.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			for k, v := range options {
+				if err = p.Put([]byte(k), []byte(v)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// ProfileDel removes quota profile.
+func (i *Instance) ProfileDel(name string) error {
+	return i.db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(profiles); b != nil && b.Bucket([]byte(name)) != nil {
+			return b.DeleteBucket([]byte(name))
+		}
+		return nil
+	})
+}
+
+// Profile returns options of the quota profile or nil if profile does not exist.
+func (i *Instance) Profile(name string) (options map[string]string) {
+	i.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(profiles); b != nil {
+			if b = b.Bucket([]byte(name)); b != nil {
+				options = make(map[string]string)
+				b.ForEach(func(k, v []byte) error {
+					options[string(k)] = string(v)
+					return nil
+				})
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// ProfileList returns names of the saved quota profiles.
+func (i *Instance) ProfileList() (list []string) {
+	i.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(profiles); b != nil {
+			b.ForEach(func(k, v []byte) error {
+				if v == nil {
+					list = append(list, string(k))
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return
+}
+
+// EventAdd records container event with its fields and returns event id. Ids grow monotonically, so events are kept in order of recording.
+func (i *Instance) EventAdd(options map[string]string) (id uint64, err error) {
+	err = i.db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(events); b != nil {
+			if id, err = b.NextSequence(); err != nil {
+				return err
+			}
+			e, err := b.CreateBucket(itob(id))
+			if err != nil {
+				return err
+			}
+			for k, v := range options {
+				if err = e.Put([]byte(k), []byte(v)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// Events returns fields of the events recorded after the id, in order of recording. Empty container name returns events of all containers.
+// Positive limit returns no more than limit events.
+func (i *Instance) Events(name string, after uint64, limit int) (list []map[string]string) {
+	i.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(events); b != nil {
+			c := b.Cursor()
+			for k, v := c.Seek(itob(after + 1)); k != nil && (limit <= 0 || len(list) < limit); k, v = c.Next() {
+				e := b.Bucket(k)
+				if v != nil || e == nil {
+					continue
+				}
+				if name != "" && string(e.Get([]byte("container"))) != name {
+					continue
+				}
+				item := map[string]string{"id": strconv.FormatUint(binary.BigEndian.Uint64(k), 10)}
+				e.ForEach(func(k, v []byte) error {
+					item[string(k)] = string(v)
+					return nil
+				})
+				list = append(list, item)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// EventLast returns id of the last recorded event.
+func (i *Instance) EventLast() (id uint64) {
+	i.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(events); b != nil {
+			id = b.Sequence()
+		}
+		return nil
+	})
+	return
+}
+
+// EventTrim removes events with ids lower than the passed one.
+func (i *Instance) EventTrim(before uint64) error {
+	return i.db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(events); b != nil {
+			c := b.Cursor()
+			for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k) < before; k, _ = c.First() {
+				if err := b.DeleteBucket(k); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// EventCursor returns id of the last event delivered to the Management server.
+func (i *Instance) EventCursor() (id uint64) {
+	i.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte("config")); b != nil {
+			id, _ = strconv.ParseUint(string(b.Get([]byte("EventCursor"))), 10, 64)
+		}
+		return nil
+	})
+	return
+}
+
+// EventDelivered saves id of the last event delivered to the Management server.
+func (i *Instance) EventDelivered(id uint64) error {
+	return i.db.Update(func(tx *bolt.Tx) error {
+		c, err := tx.CreateBucketIfNotExists([]byte("config"))
+		if err != nil {
+			return err
+		}
+		return c.Put([]byte("EventCursor"), []byte(strconv.FormatUint(id, 10)))
+	})
+}
+
+// itob encodes id as big endian bytes, so bolt keeps keys in numeric order
+func itob(id uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, id)
+	return b
+}
+
+// TrustAdd saves public key of the template owner in the trust store, keyed by the key fingerprint.
+func (i *Instance) TrustAdd(owner, fingerprint, key string) (err error) {
+	i.db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(trust); b != nil {
+			if b, err = b.CreateBucketIfNotExists([]byte(owner)); err != nil {
+				return err
+			}
+			err = b.Put([]byte(fingerprint), []byte(key))
+		}
+		return err
+	})
+	return
+}
+
+// TrustDel removes public key of the template owner from the trust store, empty fingerprint removes all keys of the owner.
+// It returns the number of removed keys.
+func (i *Instance) TrustDel(owner, fingerprint string) (n int, err error) {
+	err = i.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(trust)
+		if b == nil || b.Bucket([]byte(owner)) == nil {
+			return nil
+		}
+		o := b.Bucket([]byte(owner))
+		if fingerprint == "" {
+			o.ForEach(func(k, v []byte) error {
+				n++
+				return nil
+			})
+			return b.DeleteBucket([]byte(owner))
+		}
+		if o.Get([]byte(fingerprint)) == nil {
+			return nil
+		}
+		n = 1
+		if err := o.Delete([]byte(fingerprint)); err != nil {
+			return err
+		}
+		if k, _ := o.Cursor().First(); k == nil {
+			return b.DeleteBucket([]byte(owner))
+		}
+		return nil
+	})
+	return
+}
+
+// TrustKeys returns public keys of the template owner saved in the trust store, keyed by fingerprint.
+func (i *Instance) TrustKeys(owner string) map[string]string {
+	keys := make(map[string]string)
+	i.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(trust); b != nil {
+			if b = b.Bucket([]byte(owner)); b != nil {
+				b.ForEach(func(k, v []byte) error {
+					keys[string(k)] = string(v)
+					return nil
+				})
+			}
+		}
+		return nil
+	})
+	return keys
+}
+
+// TrustOwners returns template owners which have public keys in the trust store.
+func (i *Instance) TrustOwners() (list []string) {
+	i.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(trust); b != nil {
+			b.ForEach(func(k, v []byte) error {
+				if v == nil {
+					list = append(list, string(k))
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,446 @@
+// Package cgroup provides access to control groups of Subutai containers on hosts with legacy (v1), hybrid or unified (v2) hierarchy
+package cgroup
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Cgroup hierarchy modes of the host.
+// Hybrid hosts have v2 hierarchy mounted without controllers, so limits and stats are handled as on legacy hosts.
+const (
+	Legacy  = "legacy"
+	Hybrid  = "hybrid"
+	Unified = "unified"
+)
+
+// cgroup2Magic is the filesystem type of cgroup v2 mount
+const cgroup2Magic = 0x63677270
+
+var (
+	// IOKeys are block I/O limit keys in the order of io.max file
+	IOKeys = []string{"rbps", "wbps", "riops", "wiops"}
+	// IOFiles maps block I/O limit keys to blkio throttle files of legacy hierarchy
+	IOFiles = map[string]string{
+		"rbps":  "blkio.throttle.read_bps_device",
+		"wbps":  "blkio.throttle.write_bps_device",
+		"riops": "blkio.throttle.read_iops_device",
+		"wiops": "blkio.throttle.write_iops_device",
+	}
+)
+
+var (
+	root = "/sys/fs/cgroup/"
+	mode string
+	once sync.Once
+)
+
+// Mode detects cgroup hierarchy of the host.
+func Mode() string {
+	once.Do(func() {
+		mode = Legacy
+		var st syscall.Statfs_t
+		if syscall.Statfs(root, &st) == nil && int64(st.Type) == cgroup2Magic {
+			mode = Unified
+		} else if syscall.Statfs(root+"unified", &st) == nil && int64(st.Type) == cgroup2Magic {
+			mode = Hybrid
+		}
+	})
+	return mode
+}
+
+// Path returns control group directory of the container for the controller. Controller is ignored on unified hierarchy.
+// LXC 3.1 and later place containers under lxc.payload groups on either hierarchy, older versions use lxc group, existing directory is returned.
+func Path(controller, name string) string {
+	base := hierarchy(controller)
+	for _, path := range []string{base + "lxc.payload." + name + "/", base + "lxc.payload/" + name + "/", base + "lxc/" + name + "/"} {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	if Mode() != Unified {
+		return base + "lxc/" + name + "/"
+	}
+	return base + "lxc.payload." + name + "/"
+}
+
+// Containers returns names of the containers having control groups, i.e. running containers.
+func Containers() (list []string) {
+	base := hierarchy("cpu")
+	list = dirs(base, "lxc.payload.")
+	for _, dir := range []string{base + "lxc.payload/", base + "lxc/"} {
+		for _, name := range dirs(dir, "") {
+			if !strings.HasPrefix(name, "lxc.monitor") {
+				list = append(list, name)
+			}
+		}
+	}
+	return
+}
+
+// hierarchy returns root directory of the controller hierarchy
+func hierarchy(controller string) string {
+	if Mode() != Unified {
+		return root + controller + "/"
+	}
+	return root
+}
+
+func dirs(path, prefix string) (list []string) {
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		if f.IsDir() && strings.HasPrefix(f.Name(), prefix) {
+			list = append(list, strings.TrimPrefix(f.Name(), prefix))
+		}
+	}
+	return
+}
+
+// ConfigKey returns container config key for control group file of the host hierarchy: v1 file on legacy and hybrid hosts, v2 file on unified ones.
+func ConfigKey(v1, v2 string) string {
+	if Mode() == Unified {
+		return "lxc.cgroup2." + v2
+	}
+	return "lxc.cgroup." + v1
+}
+
+// Config returns container config entries setting the value for control group file of the host hierarchy
+// and removing the entry of the other hierarchy, so containers moved between hosts do not keep stale limits.
+func Config(v1, v2, value string) [][]string {
+	if Mode() == Unified {
+		return [][]string{{"lxc.cgroup2." + v2, value}, {"lxc.cgroup." + v1, ""}}
+	}
+	return [][]string{{"lxc.cgroup." + v1, value}, {"lxc.cgroup2." + v2, ""}}
+}
+
+// Get reads control group file of the container.
+func Get(controller, name, file string) (string, error) {
+	out, err := ioutil.ReadFile(Path(controller, name) + file)
+	return strings.TrimSpace(string(out)), err
+}
+
+// Set writes value to control group file of the container.
+func Set(controller, name, file, value string) error {
+	return ioutil.WriteFile(Path(controller, name)+file, []byte(value), 0644)
+}
+
+// getInt reads numeric control group file, "max" value is returned as -1
+func getInt(controller, name, file string) (int, error) {
+	value, err := Get(controller, name, file)
+	if err != nil {
+		return 0, err
+	}
+	if value == "max" {
+		return -1, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// stat parses "key value" lines of control group statistics file
+func stat(controller, name, file string) map[string]int {
+	list := make(map[string]int)
+	out, err := Get(controller, name, file)
+	if err != nil {
+		return list
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if row := strings.Fields(line); len(row) == 2 {
+			if value, err := strconv.Atoi(row[1]); err == nil {
+				list[row[0]] = value
+			}
+		}
+	}
+	return list
+}
+
+// CPUStat returns user and system CPU time of the container in USER_HZ ticks.
+func CPUStat(name string) (user, system int, err error) {
+	if Mode() != Unified {
+		s := stat("cpuacct", name, "cpuacct.stat")
+		if len(s) == 0 {
+			return 0, 0, errors.New("no CPU statistics for " + name)
+		}
+		return s["user"], s["system"], nil
+	}
+	s := stat("cpu", name, "cpu.stat")
+	if len(s) == 0 {
+		return 0, 0, errors.New("no CPU statistics for " + name)
+	}
+	return s["user_usec"] / 10000, s["system_usec"] / 10000, nil
+}
+
+// CPULimit returns CFS quota and period of the container in microseconds, negative quota means no limit.
+func CPULimit(name string) (quota, period int, err error) {
+	if Mode() != Unified {
+		if quota, err = getInt("cpu", name, "cpu.cfs_quota_us"); err != nil {
+			return
+		}
+		period, err = getInt("cpu", name, "cpu.cfs_period_us")
+		return
+	}
+	value, err := Get("cpu", name, "cpu.max")
+	if err != nil {
+		return
+	}
+	quota, period = ParseCPU(value)
+	return
+}
+
+// SetCPULimit sets CFS quota and period of the container in microseconds, negative quota removes the limit.
+func SetCPULimit(name string, quota, period int) error {
+	if Mode() != Unified {
+		if err := Set("cpu", name, "cpu.cfs_period_us", strconv.Itoa(period)); err != nil {
+			return err
+		}
+		return Set("cpu", name, "cpu.cfs_quota_us", strconv.Itoa(quota))
+	}
+	return Set("cpu", name, "cpu.max", formatCPU(quota, period))
+}
+
+// MemoryUsage returns memory usage of the container in bytes.
+func MemoryUsage(name string) (int, error) {
+	if Mode() != Unified {
+		return getInt("memory", name, "memory.usage_in_bytes")
+	}
+	return getInt("memory", name, "memory.current")
+}
+
+// MemoryLimit returns memory limit of the container in bytes, -1 means no limit.
+func MemoryLimit(name string) (int, error) {
+	if Mode() != Unified {
+		limit, err := getInt("memory", name, "memory.limit_in_bytes")
+		// unlimited v1 group reports maximum page counter value
+		if err == nil && limit >= 1<<60 {
+			limit = -1
+		}
+		return limit, err
+	}
+	return getInt("memory", name, "memory.max")
+}
+
+// SetMemoryLimit sets memory limit of the container in bytes, zero value removes the limit.
+func SetMemoryLimit(name string, limit int) error {
+	if Mode() != Unified {
+		if limit == 0 {
+			limit = -1
+		}
+		return Set("memory", name, "memory.limit_in_bytes", strconv.Itoa(limit))
+	}
+	return Set("memory", name, "memory.max", formatMax(limit))
+}
+
+// MemoryStat returns memory statistics of the container.
+// On unified hierarchy "cache" and "rss" values of v1 statistics are provided as well, calculated from "file" and "anon".
+func MemoryStat(name string) map[string]int {
+	s := stat("memory", name, "memory.stat")
+	if Mode() == Unified {
+		if _, ok := s["file"]; ok {
+			s["cache"] = s["file"]
+		}
+		if _, ok := s["anon"]; ok {
+			s["rss"] = s["anon"]
+		}
+	}
+	return s
+}
+
+// OOMKills returns number of processes of the container killed by OOM killer.
+// Legacy hierarchy reports the counter in memory.oom_control on kernels 4.13 and newer.
+func OOMKills(name string) (int, error) {
+	s := stat("memory", name, "memory.events")
+	if Mode() != Unified {
+		s = stat("memory", name, "memory.oom_control")
+	}
+	kills, ok := s["oom_kill"]
+	if !ok {
+		return 0, errors.New("no OOM statistics for " + name)
+	}
+	return kills, nil
+}
+
+// CPUThrottling returns number of CFS periods of the container, number of throttled periods and total throttled time in microseconds.
+func CPUThrottling(name string) (periods, throttled, usec int, err error) {
+	if Mode() != Unified {
+		s := stat("cpu", name, "cpu.stat")
+		if len(s) == 0 {
+			return 0, 0, 0, errors.New("no CPU throttling statistics for " + name)
+		}
+		return s["nr_periods"], s["nr_throttled"], s["throttled_time"] / 1000, nil
+	}
+	s := stat("cpu", name, "cpu.stat")
+	if _, ok := s["nr_periods"]; !ok {
+		return 0, 0, 0, errors.New("no CPU throttling statistics for " + name)
+	}
+	return s["nr_periods"], s["nr_throttled"], s["throttled_usec"], nil
+}
+
+// CPUSet returns list of cores available to the container.
+func CPUSet(name string) (string, error) {
+	return Get("cpuset", name, "cpuset.cpus")
+}
+
+// SetCPUSet sets list of cores available to the container.
+func SetCPUSet(name, cpus string) error {
+	return Set("cpuset", name, "cpuset.cpus", cpus)
+}
+
+// Pids returns number of processes in the container and processes limit, -1 means no limit.
+func Pids(name string) (current, limit int, err error) {
+	if current, err = getInt("pids", name, "pids.current"); err != nil {
+		return
+	}
+	limit, err = getInt("pids", name, "pids.max")
+	return
+}
+
+// SetPidsLimit sets processes limit of the container, zero value removes the limit.
+func SetPidsLimit(name string, limit int) error {
+	return Set("pids", name, "pids.max", formatMax(limit))
+}
+
+// IOStat returns number of bytes and operations read and written by the container on all devices.
+func IOStat(name string) (rbytes, wbytes, rios, wios int) {
+	if Mode() != Unified {
+		rbytes, wbytes = ioStatV1(name, "blkio.throttle.io_service_bytes")
+		rios, wios = ioStatV1(name, "blkio.throttle.io_serviced")
+		return
+	}
+	out, err := Get("io", name, "io.stat")
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(out, "\n") {
+		for _, field := range strings.Fields(line) {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			value, err := strconv.Atoi(kv[1])
+			if err != nil {
+				continue
+			}
+			switch kv[0] {
+			case "rbytes":
+				rbytes += value
+			case "wbytes":
+				wbytes += value
+			case "rios":
+				rios += value
+			case "wios":
+				wios += value
+			}
+		}
+	}
+	return
+}
+
+func ioStatV1(name, file string) (read, write int) {
+	out, err := Get("blkio", name, file)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(out, "\n") {
+		row := strings.Fields(line)
+		if len(row) != 3 {
+			continue
+		}
+		if value, err := strconv.Atoi(row[2]); err == nil {
+			switch row[1] {
+			case "Read":
+				read += value
+			case "Write":
+				write += value
+			}
+		}
+	}
+	return
+}
+
+// IOLimits returns block I/O limits of the container for the device, or for any device if dev is empty.
+// Limits are returned by IOKeys, zero value means no limit.
+func IOLimits(name, dev string) map[string]int {
+	limits := map[string]int{"rbps": 0, "wbps": 0, "riops": 0, "wiops": 0}
+	if Mode() != Unified {
+		for k, file := range IOFiles {
+			out, _ := Get("blkio", name, file)
+			for _, line := range strings.Split(out, "\n") {
+				if row := strings.Fields(line); len(row) == 2 && (dev == "" || row[0] == dev) {
+					limits[k], _ = strconv.Atoi(row[1])
+				}
+			}
+		}
+		return limits
+	}
+	out, _ := Get("io", name, "io.max")
+	for _, line := range strings.Split(out, "\n") {
+		if row := strings.Fields(line); len(row) > 1 && (dev == "" || row[0] == dev) {
+			for k, v := range ParseIO(row[1:]) {
+				limits[k] = v
+			}
+		}
+	}
+	return limits
+}
+
+// SetIOLimit sets block I/O limit of the container on the device, zero value removes the limit.
+func SetIOLimit(name, dev, key string, value int) error {
+	file, ok := IOFiles[key]
+	if !ok {
+		return errors.New("unknown I/O limit " + key)
+	}
+	if Mode() != Unified {
+		return Set("blkio", name, file, dev+" "+strconv.Itoa(value))
+	}
+	return Set("io", name, "io.max", dev+" "+key+"="+formatMax(value))
+}
+
+func formatMax(value int) string {
+	if value <= 0 {
+		return "max"
+	}
+	return strconv.Itoa(value)
+}
+
+func formatCPU(quota, period int) string {
+	if quota < 0 {
+		return "max " + strconv.Itoa(period)
+	}
+	return strconv.Itoa(quota) + " " + strconv.Itoa(period)
+}
+
+// ParseCPU parses CFS quota and period of cpu.max value, quota is -1 if there is no limit.
+func ParseCPU(value string) (quota, period int) {
+	quota, period = -1, 100000
+	if fields := strings.Fields(value); len(fields) > 0 {
+		if q, err := strconv.Atoi(fields[0]); err == nil {
+			quota = q
+		}
+		if len(fields) > 1 {
+			if p, err := strconv.Atoi(fields[1]); err == nil {
+				period = p
+			}
+		}
+	}
+	return
+}
+
+// ParseIO parses key=value limits of io.max line, "max" values are returned as zero.
+func ParseIO(fields []string) map[string]int {
+	limits := make(map[string]int)
+	for _, field := range fields {
+		if kv := strings.SplitN(field, "=", 2); len(kv) == 2 {
+			if _, ok := IOFiles[kv[0]]; ok {
+				limits[kv[0]], _ = strconv.Atoi(kv[1])
+			}
+		}
+	}
+	return limits
+}
@@ -0,0 +1,102 @@
+package cgroup
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseCPU(t *testing.T) {
+	tests := []struct {
+		value         string
+		quota, period int
+	}{
+		{"max 100000", -1, 100000},
+		{"50000 100000", 50000, 100000},
+		{"200000 50000", 200000, 50000},
+		{"max", -1, 100000},
+		{"", -1, 100000},
+		{"25000", 25000, 100000},
+		{"bad value", -1, 100000},
+	}
+	for _, tt := range tests {
+		if quota, period := ParseCPU(tt.value); quota != tt.quota || period != tt.period {
+			t.Errorf("ParseCPU(%q) = %d, %d, want %d, %d", tt.value, quota, period, tt.quota, tt.period)
+		}
+	}
+}
+
+func TestParseIO(t *testing.T) {
+	tests := []struct {
+		fields []string
+		want   map[string]int
+	}{
+		{[]string{"rbps=1048576", "wbps=max", "riops=max", "wiops=100"},
+			map[string]int{"rbps": 1048576, "wbps": 0, "riops": 0, "wiops": 100}},
+		{[]string{"wbps=2097152"}, map[string]int{"wbps": 2097152}},
+		{[]string{"unknown=1", "rbps", "riops=10"}, map[string]int{"riops": 10}},
+		{nil, map[string]int{}},
+	}
+	for _, tt := range tests {
+		if got := ParseIO(tt.fields); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseIO(%q) = %v, want %v", tt.fields, got, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	if got := formatCPU(-1, 100000); got != "max 100000" {
+		t.Errorf("formatCPU(-1, 100000) = %q", got)
+	}
+	if got := formatCPU(50000, 100000); got != "50000 100000" {
+		t.Errorf("formatCPU(50000, 100000) = %q", got)
+	}
+	if got := formatMax(0); got != "max" {
+		t.Errorf("formatMax(0) = %q", got)
+	}
+	if got := formatMax(512); got != "512" {
+		t.Errorf("formatMax(512) = %q", got)
+	}
+}
+
+func TestPath(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	once.Do(func() {})
+	defer func(r, m string) { root, mode = r, m }(root, mode)
+	root = tmp + "/"
+
+	for _, dir := range []string{"cpu/lxc/old", "cpu/lxc.payload.new", "memory/lxc.payload/nested", "lxc.payload.v2"} {
+		if err = os.MkdirAll(root+dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		mode, controller, name, want string
+	}{
+		{Legacy, "cpu", "old", "cpu/lxc/old/"},
+		{Legacy, "cpu", "new", "cpu/lxc.payload.new/"},
+		{Hybrid, "memory", "nested", "memory/lxc.payload/nested/"},
+		{Legacy, "cpu", "stopped", "cpu/lxc/stopped/"},
+		{Unified, "cpu", "v2", "lxc.payload.v2/"},
+		{Unified, "memory", "stopped", "lxc.payload.stopped/"},
+	}
+	for _, tt := range tests {
+		mode = tt.mode
+		if got := Path(tt.controller, tt.name); got != root+tt.want {
+			t.Errorf("%s Path(%q, %q) = %q, want %q", tt.mode, tt.controller, tt.name, got, root+tt.want)
+		}
+	}
+
+	mode = Legacy
+	list := Containers()
+	sort.Strings(list)
+	if want := []string{"new", "old"}; !reflect.DeepEqual(list, want) {
+		t.Errorf("Containers() = %q, want %q", list, want)
+	}
+}
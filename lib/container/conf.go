@@ -0,0 +1,313 @@
+package container
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Config is the parsed LXC configuration file of the container. Comments, blank lines and order of the entries are preserved,
+// unchanged lines are written back exactly as they were read. Keys are looked up in both legacy and modern formats,
+// new and changed entries are written in the format of the installed LXC.
+type Config struct {
+	path    string
+	entries []configEntry
+}
+
+// configEntry is a key and value pair of the config, entries without key keep comments, blank and unparsable lines
+type configEntry struct {
+	key, value string
+	line       string
+	deleted    bool
+}
+
+// knownKeys are the keys of LXC 1.x, 2.0 and 2.1+ config formats accepted by validation
+var knownKeys = []string{
+	"lxc.arch", "lxc.utsname", "lxc.uts.name", "lxc.console", "lxc.console.path", "lxc.console.logfile", "lxc.console.buffer.size",
+	"lxc.tty", "lxc.tty.max", "lxc.devttydir", "lxc.tty.dir", "lxc.pts", "lxc.pty.max", "lxc.kmsg", "lxc.pivotdir",
+	"lxc.aa_profile", "lxc.aa_allow_incomplete", "lxc.apparmor.profile", "lxc.apparmor.allow_incomplete", "lxc.apparmor.raw",
+	"lxc.se_context", "lxc.selinux.context", "lxc.seccomp", "lxc.seccomp.profile", "lxc.no_new_privs",
+	"lxc.haltsignal", "lxc.rebootsignal", "lxc.stopsignal", "lxc.signal.halt", "lxc.signal.reboot", "lxc.signal.stop",
+	"lxc.init_cmd", "lxc.init_uid", "lxc.init_gid", "lxc.init.cmd", "lxc.init.uid", "lxc.init.gid", "lxc.init.cwd",
+	"lxc.ephemeral", "lxc.start.auto", "lxc.start.delay", "lxc.start.order", "lxc.group", "lxc.monitor.unshare",
+	"lxc.rootfs", "lxc.rootfs.path", "lxc.rootfs.mount", "lxc.rootfs.options", "lxc.rootfs.backend",
+	"lxc.mount", "lxc.mount.fstab", "lxc.mount.auto", "lxc.mount.entry",
+	"lxc.id_map", "lxc.idmap", "lxc.cap.drop", "lxc.cap.keep", "lxc.include", "lxc.environment", "lxc.autodev",
+	"lxc.loglevel", "lxc.logfile", "lxc.syslog", "lxc.log.level", "lxc.log.file", "lxc.log.syslog",
+	"lxc.network.type", "lxc.network.flags", "lxc.network.link", "lxc.network.name", "lxc.network.hwaddr", "lxc.network.mtu",
+	"lxc.network.ipv4", "lxc.network.ipv4.gateway", "lxc.network.ipv6", "lxc.network.ipv6.gateway",
+	"lxc.network.script.up", "lxc.network.script.down", "lxc.network.veth.pair", "lxc.network.macvlan.mode", "lxc.network.vlan.id",
+}
+
+// knownPrefixes are the key families with free form suffixes, e.g. cgroup controller files
+var knownPrefixes = []string{
+	"lxc.cgroup.", "lxc.cgroup2.", "lxc.hook.", "lxc.limit.", "lxc.prlimit.", "lxc.sysctl.", "lxc.proc.", "lxc.net.", "subutai.",
+}
+
+// multiValue are the keys which may occur in the config several times
+var multiValue = []string{
+	"lxc.include", "lxc.mount.entry", "lxc.id_map", "lxc.idmap", "lxc.cap.drop", "lxc.cap.keep", "lxc.environment", "lxc.group",
+	"lxc.apparmor.raw", "lxc.network.ipv4", "lxc.network.ipv6", "lxc.cgroup.devices.allow", "lxc.cgroup.devices.deny",
+	"lxc.cgroup2.devices.allow", "lxc.cgroup2.devices.deny",
+}
+
+// pseudoKeys are Subutai keys kept in LXC comments, LXC ignores them while the agent reads and writes them as regular entries
+var pseudoKeys = []string{"#vlan_id"}
+
+// ValidKey checks that the key belongs to the LXC or Subutai configuration keys
+func ValidKey(key string) error {
+	if stringInList(key, pseudoKeys) {
+		return nil
+	}
+	if key == "" || strings.ContainsAny(key, " \t=\n#") {
+		return errors.New("invalid config key \"" + key + "\"")
+	}
+	for _, k := range knownKeys {
+		if key == k {
+			return nil
+		}
+	}
+	for _, p := range knownPrefixes {
+		if strings.HasPrefix(key, p) && len(key) > len(p) {
+			return nil
+		}
+	}
+	return errors.New("unknown config key " + key)
+}
+
+// MultiValue returns true if the key may occur in the config several times, e.g. lxc.mount.entry or hooks
+func MultiValue(key string) bool {
+	key = legacyKey(key)
+	if strings.HasPrefix(key, "lxc.hook.") {
+		return true
+	}
+	for _, k := range multiValue {
+		if key == k {
+			return true
+		}
+	}
+	return strings.HasPrefix(key, "lxc.net.") && (strings.HasSuffix(key, ".ipv4.address") || strings.HasSuffix(key, ".ipv6.address"))
+}
+
+// ReadConfig parses LXC configuration file. Comments are kept as they are, except for the pseudo keys like #vlan_id.
+func ReadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{path: path}
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		e := configEntry{line: line}
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			if kv := strings.SplitN(trimmed, "=", 2); len(kv) == 2 {
+				if key := strings.TrimSpace(kv[0]); !strings.HasPrefix(key, "#") || stringInList(key, pseudoKeys) {
+					e.key, e.value = key, strings.TrimSpace(kv[1])
+				}
+			}
+		}
+		c.entries = append(c.entries, e)
+	}
+	if len(data) == 0 {
+		c.entries = nil
+	}
+	return c, nil
+}
+
+// Get returns value of the first occurrence of the key, empty string if the key is not set
+func (c *Config) Get(key string) string {
+	if values := c.Values(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Values returns values of all occurrences of the key in the order of the config
+func (c *Config) Values(key string) (list []string) {
+	for _, e := range c.entries {
+		if !e.deleted && sameKey(e.key, key) {
+			list = append(list, e.value)
+		}
+	}
+	return
+}
+
+// Entries returns key and value pairs of the config
+func (c *Config) Entries() (list [][]string) {
+	for _, e := range c.entries {
+		if !e.deleted && e.key != "" {
+			list = append(list, []string{e.key, e.value})
+		}
+	}
+	return
+}
+
+// Set replaces all occurrences of the key with the single entry in place of the first one, empty value removes the key
+func (c *Config) Set(key, value string) error {
+	if err := validEntry(key, value); err != nil {
+		return err
+	}
+	found := false
+	for i := range c.entries {
+		e := &c.entries[i]
+		if e.deleted || !sameKey(e.key, key) {
+			continue
+		}
+		if found || value == "" {
+			e.deleted = true
+		} else if e.value != value || e.key != formatKey(key) {
+			e.key, e.value, e.line = formatKey(key), value, ""
+		}
+		found = true
+	}
+	if !found && value != "" {
+		c.insert(key, value)
+	}
+	return nil
+}
+
+// Add appends the value of the multi-value key after its last occurrence, unless the same value is already set.
+// Values of the single-value keys are replaced.
+func (c *Config) Add(key, value string) error {
+	if !MultiValue(key) {
+		return c.Set(key, value)
+	}
+	if err := validEntry(key, value); err != nil {
+		return err
+	}
+	for _, v := range c.Values(key) {
+		if v == value {
+			return nil
+		}
+	}
+	if value != "" {
+		c.insert(key, value)
+	}
+	return nil
+}
+
+// Delete removes occurrences of the key with the value, every occurrence of the key is removed if value is empty.
+// It returns false if nothing matched.
+func (c *Config) Delete(key, value string) bool {
+	found := false
+	for i := range c.entries {
+		e := &c.entries[i]
+		if !e.deleted && sameKey(e.key, key) && (value == "" || e.value == value) {
+			e.deleted, found = true, true
+		}
+	}
+	return found
+}
+
+// Apply sets key and value pairs in the way SetContainerConf always did: n-th pair of the key replaces n-th occurrence of the key in the config,
+// empty value removes that occurrence, pairs without matching occurrence are added after the last entry of the key.
+// Pairs are validated before any change is made.
+func (c *Config) Apply(conf [][]string) error {
+	for _, kv := range conf {
+		if err := validEntry(kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	count := make(map[string]int)
+	for _, kv := range conf {
+		n := count[legacyKey(kv[0])]
+		count[legacyKey(kv[0])]++
+		i := c.occurrence(kv[0], n)
+		switch {
+		case i >= 0 && kv[1] == "":
+			c.entries[i].deleted = true
+		case i >= 0 && (c.entries[i].value != kv[1] || c.entries[i].key != formatKey(kv[0])):
+			c.entries[i].key, c.entries[i].value, c.entries[i].line = formatKey(kv[0]), kv[1], ""
+		case i < 0 && kv[1] != "":
+			c.insert(kv[0], kv[1])
+		}
+	}
+	return nil
+}
+
+// occurrence returns index of the n-th entry of the key, counting entries removed by Apply, -1 if there is no such entry
+func (c *Config) occurrence(key string, n int) int {
+	for i, e := range c.entries {
+		if sameKey(e.key, key) {
+			if n == 0 {
+				if e.deleted {
+					return -1
+				}
+				return i
+			}
+			n--
+		}
+	}
+	return -1
+}
+
+// insert adds new entry after the last entry of the key or to the end of the config
+func (c *Config) insert(key, value string) {
+	pos := len(c.entries)
+	for i, e := range c.entries {
+		if sameKey(e.key, key) {
+			pos = i + 1
+		}
+	}
+	c.entries = append(c.entries, configEntry{})
+	copy(c.entries[pos+1:], c.entries[pos:])
+	c.entries[pos] = configEntry{key: formatKey(key), value: value}
+}
+
+// Write saves the config atomically: new content is written to the temporary file which replaces the config,
+// previous version of the config is kept in the file with .bak suffix.
+func (c *Config) Write() error {
+	var lines []string
+	for _, e := range c.entries {
+		switch {
+		case e.deleted:
+		case e.line != "" || e.key == "":
+			lines = append(lines, e.line)
+		default:
+			lines = append(lines, e.key+" = "+e.value)
+		}
+	}
+	data := strings.Join(lines, "\n")
+	if len(lines) > 0 {
+		data += "\n"
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(c.path); err == nil {
+		mode = info.Mode().Perm()
+		old, err := ioutil.ReadFile(c.path)
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(c.path+".bak", old, mode); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := os.OpenFile(c.path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.WriteString(data); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(c.path + ".tmp")
+		return err
+	}
+	return os.Rename(c.path+".tmp", c.path)
+}
+
+// validEntry validates the key and makes sure the value fits a single config line
+func validEntry(key, value string) error {
+	if err := ValidKey(key); err != nil {
+		return err
+	}
+	if strings.ContainsAny(value, "\n\r") {
+		return errors.New("value of " + key + " must be a single line")
+	}
+	return nil
+}
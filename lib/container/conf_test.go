@@ -0,0 +1,203 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/subutai-io/agent/config"
+)
+
+// testContainers creates configs of the containers in a temporary LXC prefix
+func testContainers(t *testing.T, configs map[string]string) {
+	dir, err := ioutil.TempDir("", "lxc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := config.Agent.LxcPrefix
+	t.Cleanup(func() { config.Agent.LxcPrefix = prefix; os.RemoveAll(dir) })
+	config.Agent.LxcPrefix = dir + "/"
+	for name, content := range configs {
+		if err = os.MkdirAll(dir+"/"+name+"/rootfs", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(dir+"/"+name+"/config", []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testConfig writes the content into a config of the temporary container and parses it
+func testConfig(t *testing.T, content string) *Config {
+	testContainers(t, map[string]string{"test": content})
+	c, err := ReadConfig(config.Agent.LxcPrefix + "test/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// written saves the config and returns the resulting file content
+func written(t *testing.T, c *Config) string {
+	if err := c.Write(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"lxc.utsname", true},
+		{"lxc.uts.name", true},
+		{"lxc.cgroup.memory.limit_in_bytes", true},
+		{"lxc.net.0.type", true},
+		{"subutai.parent", true},
+		{"#vlan_id", true},
+		{"", false},
+		{"lxc.cgroup.", false},
+		{"lxc.unknown", false},
+		{"#comment", false},
+		{"lxc.utsname = x", false},
+	}
+	for _, tt := range tests {
+		if err := ValidKey(tt.key); (err == nil) != tt.valid {
+			t.Errorf("ValidKey(%q) = %v, want valid %v", tt.key, err, tt.valid)
+		}
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	c := testConfig(t, "# comment\n\nlxc.utsname = foo\n#vlan_id = 100\n# lxc.rootfs = /old\nlxc.include=/a\nlxc.include = /b\ngarbage\n")
+	tests := []struct {
+		key    string
+		values []string
+	}{
+		{"lxc.utsname", []string{"foo"}},
+		{"#vlan_id", []string{"100"}},
+		{"lxc.rootfs", nil},
+		{"lxc.include", []string{"/a", "/b"}},
+		{"garbage", nil},
+	}
+	for _, tt := range tests {
+		if got := c.Values(tt.key); !equalStrings(got, tt.values) {
+			t.Errorf("Values(%q) = %q, want %q", tt.key, got, tt.values)
+		}
+	}
+	if got := len(c.Entries()); got != 4 {
+		t.Errorf("Entries() has %d pairs, want 4", got)
+	}
+}
+
+func TestApply(t *testing.T) {
+	base := "# mounts\nlxc.arch = amd64\nlxc.mount.entry = /a a\nlxc.mount.entry = /b b\n#vlan_id = 100\nlxc.include = /a\n"
+	tests := []struct {
+		name string
+		conf [][]string
+		want string
+		err  bool
+	}{
+		{"unchanged", [][]string{{"lxc.arch", "amd64"}}, base, false},
+		{"replace",
+			[][]string{{"lxc.mount.entry", "/c c"}},
+			"# mounts\nlxc.arch = amd64\nlxc.mount.entry = /c c\nlxc.mount.entry = /b b\n#vlan_id = 100\nlxc.include = /a\n", false},
+		{"second occurrence",
+			[][]string{{"lxc.mount.entry", "/a a"}, {"lxc.mount.entry", ""}},
+			"# mounts\nlxc.arch = amd64\nlxc.mount.entry = /a a\n#vlan_id = 100\nlxc.include = /a\n", false},
+		{"append after last occurrence",
+			[][]string{{"lxc.include", "/a"}, {"lxc.include", "/b"}},
+			base + "lxc.include = /b\n", false},
+		{"new key",
+			[][]string{{"subutai.parent", "debian"}},
+			base + "subutai.parent = debian\n", false},
+		{"vlan",
+			[][]string{{"#vlan_id", "200"}},
+			"# mounts\nlxc.arch = amd64\nlxc.mount.entry = /a a\nlxc.mount.entry = /b b\n#vlan_id = 200\nlxc.include = /a\n", false},
+		{"vlan removed",
+			[][]string{{"lxc.mount.entry", ""}, {"lxc.mount.entry", ""}, {"#vlan_id", ""}},
+			"# mounts\nlxc.arch = amd64\nlxc.include = /a\n", false},
+		{"invalid key", [][]string{{"lxc.include", "/b"}, {"lxc.bogus", "1"}}, base, true},
+		{"multiline value", [][]string{{"lxc.include", "/b\n/c"}}, base, true},
+	}
+	for _, tt := range tests {
+		c := testConfig(t, base)
+		err := c.Apply(tt.conf)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: Apply() error = %v, want error %v", tt.name, err, tt.err)
+		}
+		if got := written(t, c); got != tt.want {
+			t.Errorf("%s: config is\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSetDelete(t *testing.T) {
+	base := "lxc.arch = amd64\nlxc.mount.entry = /a a\nlxc.mount.entry = /b b\n"
+	tests := []struct {
+		name string
+		edit func(c *Config) error
+		want string
+	}{
+		{"set replaces value", func(c *Config) error { return c.Set("lxc.arch", "i686") },
+			"lxc.arch = i686\nlxc.mount.entry = /a a\nlxc.mount.entry = /b b\n"},
+		{"set collapses occurrences", func(c *Config) error { return c.Set("lxc.mount.entry", "/c c") },
+			"lxc.arch = amd64\nlxc.mount.entry = /c c\n"},
+		{"set empty removes", func(c *Config) error { return c.Set("lxc.arch", "") },
+			"lxc.mount.entry = /a a\nlxc.mount.entry = /b b\n"},
+		{"add appends", func(c *Config) error { return c.Add("lxc.mount.entry", "/c c") },
+			base + "lxc.mount.entry = /c c\n"},
+		{"add skips duplicate", func(c *Config) error { return c.Add("lxc.mount.entry", "/a a") }, base},
+		{"delete value", func(c *Config) error { c.Delete("lxc.mount.entry", "/a a"); return nil },
+			"lxc.arch = amd64\nlxc.mount.entry = /b b\n"},
+		{"delete key", func(c *Config) error { c.Delete("lxc.mount.entry", ""); return nil },
+			"lxc.arch = amd64\n"},
+	}
+	for _, tt := range tests {
+		c := testConfig(t, base)
+		if err := tt.edit(c); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if got := written(t, c); got != tt.want {
+			t.Errorf("%s: config is\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+
+	c := testConfig(t, base)
+	if c.Delete("lxc.rootfs", "") {
+		t.Error("Delete() of missing key returned true")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	c := testConfig(t, "lxc.utsname = foo\n")
+	if err := c.Set("lxc.include", "/a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := written(t, c); got != "lxc.utsname = foo\nlxc.include = /a\n" {
+		t.Errorf("config is %q", got)
+	}
+	if backup, err := ioutil.ReadFile(c.path + ".bak"); err != nil || string(backup) != "lxc.utsname = foo\n" {
+		t.Errorf("backup is %q, %v", backup, err)
+	}
+	if _, err := os.Stat(c.path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file is left: %v", err)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
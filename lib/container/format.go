@@ -0,0 +1,160 @@
+package container
+
+import (
+	"strconv"
+	"strings"
+
+	"gopkg.in/lxc/go-lxc.v2"
+)
+
+// Config formats: LegacyFormat uses keys of LXC 1.x and 2.0, ModernFormat uses keys introduced by LXC 2.1, which are the only keys accepted by LXC 3.x
+const (
+	LegacyFormat = iota
+	ModernFormat
+)
+
+// renamedKeys maps legacy keys to the keys of the modern format
+var renamedKeys = map[string]string{
+	"lxc.utsname":             "lxc.uts.name",
+	"lxc.rootfs":              "lxc.rootfs.path",
+	"lxc.mount":               "lxc.mount.fstab",
+	"lxc.id_map":              "lxc.idmap",
+	"lxc.console":             "lxc.console.path",
+	"lxc.tty":                 "lxc.tty.max",
+	"lxc.devttydir":           "lxc.tty.dir",
+	"lxc.pts":                 "lxc.pty.max",
+	"lxc.aa_profile":          "lxc.apparmor.profile",
+	"lxc.aa_allow_incomplete": "lxc.apparmor.allow_incomplete",
+	"lxc.se_context":          "lxc.selinux.context",
+	"lxc.seccomp":             "lxc.seccomp.profile",
+	"lxc.haltsignal":          "lxc.signal.halt",
+	"lxc.rebootsignal":        "lxc.signal.reboot",
+	"lxc.stopsignal":          "lxc.signal.stop",
+	"lxc.init_cmd":            "lxc.init.cmd",
+	"lxc.init_uid":            "lxc.init.uid",
+	"lxc.init_gid":            "lxc.init.gid",
+	"lxc.loglevel":            "lxc.log.level",
+	"lxc.logfile":             "lxc.log.file",
+	"lxc.syslog":              "lxc.log.syslog",
+}
+
+// removedKeys are legacy keys without modern equivalent, they are dropped on migration
+var removedKeys = []string{"lxc.rootfs.backend", "lxc.kmsg", "lxc.pivotdir"}
+
+var configFormat = -1
+
+// ConfigFormat returns config format supported by the installed LXC
+func ConfigFormat() int {
+	if configFormat < 0 {
+		configFormat = LegacyFormat
+		if lxc.VersionAtLeast(2, 1, 0) {
+			configFormat = ModernFormat
+		}
+	}
+	return configFormat
+}
+
+// modernKey translates legacy key to the modern format, network keys belong to the interface with the index
+func modernKey(key string, index int) string {
+	if k, ok := renamedKeys[key]; ok {
+		return k
+	}
+	if strings.HasPrefix(key, "lxc.limit.") {
+		return "lxc.prlimit." + strings.TrimPrefix(key, "lxc.limit.")
+	}
+	if strings.HasPrefix(key, "lxc.network.") {
+		switch suffix := strings.TrimPrefix(key, "lxc.network."); suffix {
+		case "ipv4", "ipv6":
+			return "lxc.net." + strconv.Itoa(index) + "." + suffix + ".address"
+		default:
+			return "lxc.net." + strconv.Itoa(index) + "." + suffix
+		}
+	}
+	return key
+}
+
+// legacyKey translates key of the modern format to the legacy one. Only the first network interface has legacy keys
+// in this mapping, since legacy format binds network keys to interfaces by order rather than by index.
+func legacyKey(key string) string {
+	for k, v := range renamedKeys {
+		if key == v {
+			return k
+		}
+	}
+	if strings.HasPrefix(key, "lxc.prlimit.") {
+		return "lxc.limit." + strings.TrimPrefix(key, "lxc.prlimit.")
+	}
+	if strings.HasPrefix(key, "lxc.net.0.") {
+		suffix := strings.TrimPrefix(key, "lxc.net.0.")
+		return "lxc.network." + strings.TrimSuffix(suffix, ".address")
+	}
+	return key
+}
+
+// formatKey returns name of the key in the format of the installed LXC
+func formatKey(key string) string {
+	if ConfigFormat() == ModernFormat {
+		return modernKey(legacyKey(key), 0)
+	}
+	return legacyKey(key)
+}
+
+// sameKey checks if two keys are the same key, possibly written in different formats
+func sameKey(a, b string) bool {
+	return a != "" && b != "" && legacyKey(a) == legacyKey(b)
+}
+
+// Migrate renames keys of the config to the format of the installed LXC and returns the number of changed entries.
+// Every lxc.network.type key except the first one starts the next network interface, as it does in the legacy format.
+func (c *Config) Migrate() (changed int) {
+	index, typed := 0, false
+	for i := range c.entries {
+		e := &c.entries[i]
+		if e.deleted || e.key == "" {
+			continue
+		}
+		key := legacyKey(e.key)
+		if ConfigFormat() == ModernFormat {
+			if stringInList(e.key, removedKeys) {
+				e.deleted = true
+				changed++
+				continue
+			}
+			if e.key == "lxc.network.type" {
+				if typed {
+					index++
+				}
+				typed = true
+			}
+			key = modernKey(e.key, index)
+		}
+		if key != e.key {
+			e.key, e.line = key, ""
+			changed++
+		}
+	}
+	return changed
+}
+
+// MigrateConfig converts the config file to the format of the installed LXC and returns the number of changed entries,
+// the file is written only if anything has changed
+func MigrateConfig(path string) (int, error) {
+	cfg, err := ReadConfig(path)
+	if err != nil {
+		return 0, err
+	}
+	n := cfg.Migrate()
+	if n > 0 {
+		err = cfg.Write()
+	}
+	return n, err
+}
+
+func stringInList(item string, list []string) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package container
+
+import "testing"
+
+func TestModernKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		index int
+		want  string
+	}{
+		{"lxc.utsname", 0, "lxc.uts.name"},
+		{"lxc.id_map", 0, "lxc.idmap"},
+		{"lxc.limit.nofile", 0, "lxc.prlimit.nofile"},
+		{"lxc.network.type", 0, "lxc.net.0.type"},
+		{"lxc.network.link", 1, "lxc.net.1.link"},
+		{"lxc.network.ipv4", 0, "lxc.net.0.ipv4.address"},
+		{"lxc.network.ipv6", 2, "lxc.net.2.ipv6.address"},
+		{"lxc.network.ipv4.gateway", 0, "lxc.net.0.ipv4.gateway"},
+		{"lxc.uts.name", 0, "lxc.uts.name"},
+		{"lxc.mount.entry", 0, "lxc.mount.entry"},
+		{"subutai.parent", 0, "subutai.parent"},
+		{"#vlan_id", 0, "#vlan_id"},
+	}
+	for _, tt := range tests {
+		if got := modernKey(tt.key, tt.index); got != tt.want {
+			t.Errorf("modernKey(%q, %d) = %q, want %q", tt.key, tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestLegacyKey(t *testing.T) {
+	tests := []struct {
+		key, want string
+	}{
+		{"lxc.uts.name", "lxc.utsname"},
+		{"lxc.rootfs.path", "lxc.rootfs"},
+		{"lxc.prlimit.nofile", "lxc.limit.nofile"},
+		{"lxc.net.0.type", "lxc.network.type"},
+		{"lxc.net.0.ipv4.address", "lxc.network.ipv4"},
+		{"lxc.net.0.ipv4.gateway", "lxc.network.ipv4.gateway"},
+		{"lxc.net.1.type", "lxc.net.1.type"},
+		{"lxc.utsname", "lxc.utsname"},
+		{"lxc.rootfs.mount", "lxc.rootfs.mount"},
+		{"#vlan_id", "#vlan_id"},
+	}
+	for _, tt := range tests {
+		if got := legacyKey(tt.key); got != tt.want {
+			t.Errorf("legacyKey(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestSameKey(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"lxc.utsname", "lxc.uts.name", true},
+		{"lxc.network.ipv4", "lxc.net.0.ipv4.address", true},
+		{"lxc.network.ipv4", "lxc.network.ipv4.gateway", false},
+		{"lxc.network.type", "lxc.net.1.type", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := sameKey(tt.a, tt.b); got != tt.same {
+			t.Errorf("sameKey(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.same)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	legacy := "# template\nlxc.utsname = foo\nlxc.rootfs.backend = btrfs\nlxc.pivotdir = lxc_putold\n" +
+		"lxc.network.type = veth\nlxc.network.ipv4 = 10.0.0.2/24\n#vlan_id = 100\n" +
+		"lxc.network.type = veth\nlxc.network.link = br1\nsubutai.parent = debian\n"
+	modern := "# template\nlxc.uts.name = foo\n" +
+		"lxc.net.0.type = veth\nlxc.net.0.ipv4.address = 10.0.0.2/24\n#vlan_id = 100\n" +
+		"lxc.net.1.type = veth\nlxc.net.1.link = br1\nsubutai.parent = debian\n"
+	tests := []struct {
+		name          string
+		format        int
+		content, want string
+		changed       int
+	}{
+		{"legacy to modern", ModernFormat, legacy, modern, 7},
+		{"modern is up to date", ModernFormat, modern, modern, 0},
+		{"modern to legacy", LegacyFormat, "lxc.uts.name = foo\nlxc.net.0.type = veth\n", "lxc.utsname = foo\nlxc.network.type = veth\n", 2},
+		{"legacy is up to date", LegacyFormat, legacy, legacy, 0},
+	}
+	for _, tt := range tests {
+		configFormat = tt.format
+		c := testConfig(t, tt.content)
+		if n := c.Migrate(); n != tt.changed {
+			t.Errorf("%s: Migrate() = %d, want %d", tt.name, n, tt.changed)
+		}
+		if got := written(t, c); got != tt.want {
+			t.Errorf("%s: config is\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+	configFormat = -1
+}
+
+func TestValuesByEitherKey(t *testing.T) {
+	c := testConfig(t, "lxc.utsname = foo\nlxc.net.0.type = veth\nlxc.net.0.ipv4.address = 10.0.0.2/24\n")
+	tests := []struct {
+		key    string
+		values []string
+	}{
+		{"lxc.utsname", []string{"foo"}},
+		{"lxc.uts.name", []string{"foo"}},
+		{"lxc.network.type", []string{"veth"}},
+		{"lxc.network.ipv4", []string{"10.0.0.2/24"}},
+		{"lxc.network.ipv4.gateway", nil},
+	}
+	for _, tt := range tests {
+		if got := c.Values(tt.key); !equalStrings(got, tt.values) {
+			t.Errorf("Values(%q) = %q, want %q", tt.key, got, tt.values)
+		}
+	}
+}
+
+func TestApplyFormat(t *testing.T) {
+	defer func() { configFormat = -1 }()
+
+	base := "# net\nlxc.network.type = veth\nlxc.network.ipv4 = 10.0.0.2/24\nlxc.network.ipv4 = 10.0.0.3/24\n#vlan_id = 100\n"
+	tests := []struct {
+		name   string
+		format int
+		conf   [][]string
+		want   string
+	}{
+		{"legacy unchanged", LegacyFormat, [][]string{{"lxc.network.type", "veth"}}, base},
+		{"legacy second occurrence", LegacyFormat,
+			[][]string{{"lxc.network.ipv4", "10.0.0.2/24"}, {"lxc.network.ipv4", ""}},
+			"# net\nlxc.network.type = veth\nlxc.network.ipv4 = 10.0.0.2/24\n#vlan_id = 100\n"},
+		{"legacy by modern key", LegacyFormat, [][]string{{"lxc.net.0.ipv4.address", "10.0.0.5/24"}},
+			"# net\nlxc.network.type = veth\nlxc.network.ipv4 = 10.0.0.5/24\nlxc.network.ipv4 = 10.0.0.3/24\n#vlan_id = 100\n"},
+		{"modern rewrites changed key", ModernFormat, [][]string{{"lxc.network.ipv4", "10.0.0.5/24"}},
+			"# net\nlxc.network.type = veth\nlxc.net.0.ipv4.address = 10.0.0.5/24\nlxc.network.ipv4 = 10.0.0.3/24\n#vlan_id = 100\n"},
+		{"modern new key", ModernFormat, [][]string{{"lxc.utsname", "foo"}}, base + "lxc.uts.name = foo\n"},
+	}
+	for _, tt := range tests {
+		configFormat = tt.format
+		c := testConfig(t, base)
+		if err := c.Apply(tt.conf); err != nil {
+			t.Errorf("%s: Apply() error = %v", tt.name, err)
+		}
+		if got := written(t, c); got != tt.want {
+			t.Errorf("%s: config is\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSetFormat(t *testing.T) {
+	configFormat = ModernFormat
+	defer func() { configFormat = -1 }()
+
+	base := "lxc.utsname = foo\nlxc.mount.entry = /a a\n"
+	tests := []struct {
+		name       string
+		key, value string
+		want       string
+	}{
+		{"set renames key", "lxc.utsname", "bar", "lxc.uts.name = bar\nlxc.mount.entry = /a a\n"},
+		{"set by modern key", "lxc.uts.name", "foo", "lxc.uts.name = foo\nlxc.mount.entry = /a a\n"},
+		{"set empty removes", "lxc.uts.name", "", "lxc.mount.entry = /a a\n"},
+	}
+	for _, tt := range tests {
+		c := testConfig(t, base)
+		if err := c.Set(tt.key, tt.value); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if got := written(t, c); got != tt.want {
+			t.Errorf("%s: config is\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -15,6 +15,8 @@ import (
 
 	"github.com/subutai-io/agent/config"
 	"github.com/subutai-io/agent/db"
+	"github.com/subutai-io/agent/lib/cgroup"
+	"github.com/subutai-io/agent/lib/event"
 	"github.com/subutai-io/agent/lib/fs"
 	"github.com/subutai-io/agent/lib/net"
 	"github.com/subutai-io/agent/log"
@@ -22,6 +24,14 @@ import (
 	"gopkg.in/lxc/go-lxc.v2"
 )
 
+// reservedNames are directories of the LXC prefix used by the agent itself, containers and templates can't have these names
+var reservedNames = []string{"tmpdir", "registry", "volumes"}
+
+// IsReserved checks if the name is reserved for agent directories of the LXC prefix
+func IsReserved(name string) bool {
+	return stringInList(name, reservedNames)
+}
+
 // All returns list of all containers
 func All() []string {
 	return lxc.DefinedContainerNames(config.Agent.LxcPrefix)
@@ -121,11 +131,13 @@ func Start(name string) error {
 	}
 	defer lxc.Release(c)
 
+	log.Check(log.WarnLevel, "Restoring seccomp policy of "+name, restorePolicy(name))
 	log.Check(log.DebugLevel, "Starting LXC container "+name, c.Start())
 	if c.State().String() != "RUNNING" {
 		return errors.New("Unable to start container " + name)
 	}
 	AddMetadata(name, map[string]string{"state": "RUNNING"})
+	event.Add(name, event.Start, "")
 	return nil
 }
 
@@ -148,6 +160,7 @@ func Stop(name string, addMetadata bool) error {
 	if addMetadata {
 		AddMetadata(name, map[string]string{"state": "STOPPED"})
 	}
+	event.Add(name, event.Stop, "")
 
 	return nil
 }
@@ -164,6 +177,7 @@ func Freeze(name string) error {
 		return err
 	}
 	AddMetadata(name, map[string]string{"state": State(name)})
+	event.Add(name, event.Freeze, "")
 	return nil
 }
 
@@ -179,6 +193,7 @@ func Unfreeze(name string) error {
 		return err
 	}
 	AddMetadata(name, map[string]string{"state": State(name)})
+	event.Add(name, event.Unfreeze, "")
 	return nil
 }
 
@@ -220,7 +235,11 @@ func DumpRestore(name string) error {
 		Directory: config.Agent.LxcPrefix + "/" + name + "/checkpoint",
 		Verbose:   true,
 	}
-	return c.Restore(options)
+	if err = c.Restore(options); err != nil {
+		return err
+	}
+	event.Add(name, event.Restore, "restored from checkpoint")
+	return nil
 }
 
 // AttachExec executes a command inside Subutai container.
@@ -301,6 +320,7 @@ func DestroyContainer(name string) error {
 	log.Check(log.WarnLevel, "Deleting container metadata entry", bolt.ContainerDel(name))
 	log.Check(log.WarnLevel, "Deleting uuid entry", bolt.DelUuidEntry(name))
 	log.Check(log.WarnLevel, "Closing database", bolt.Close())
+	event.Add(name, event.Destroy, "")
 
 	return nil
 }
@@ -372,6 +392,11 @@ func Clone(parent, child string) error {
 	fs.SubvolumeClone(config.Agent.LxcPrefix+parent+"/opt", config.Agent.LxcPrefix+child+"/opt")
 	fs.SubvolumeClone(config.Agent.LxcPrefix+parent+"/var", config.Agent.LxcPrefix+child+"/var")
 
+	// templates imported by older agents may have configs in the legacy format
+	if _, err = MigrateConfig(config.Agent.LxcPrefix + child + "/config"); log.Check(log.DebugLevel, "Migrating config of "+child, err) {
+		return err
+	}
+
 	SetContainerConf(child, [][]string{
 		{"lxc.network.link", ""},
 		{"lxc.network.veth.pair", strings.Replace(GetConfigItem(config.Agent.LxcPrefix+child+"/config", "lxc.network.hwaddr"), ":", "", -1)},
@@ -382,13 +407,14 @@ func Clone(parent, child string) error {
 		{"lxc.mount.entry", config.Agent.LxcPrefix + child + "/var var none bind,rw 0 0"},
 		{"lxc.network.mtu", "1300"},
 	})
+	event.Add(child, event.Clone, "cloned from "+parent)
 	return nil
 }
 
 // ResetNet sets default parameters of the network configuration for container.
 // It's used right before converting container into template.
-func ResetNet(name string) {
-	SetContainerConf(name, [][]string{
+func ResetNet(name string) error {
+	return SetContainerConf(name, [][]string{
 		{"lxc.network.type", "veth"},
 		{"lxc.network.flags", "up"},
 		{"lxc.network.link", "lxcbr0"},
@@ -404,31 +430,32 @@ func ResetNet(name string) {
 // QuotaRAM sets the memory quota to the Subutai container.
 // If quota size argument is missing, it's just return current value.
 func QuotaRAM(name string, size ...string) int {
-	c, err := lxc.NewContainer(name, config.Agent.LxcPrefix)
-	if err == nil {
-		defer lxc.Release(c)
-	}
-	log.Check(log.DebugLevel, "Looking for container: "+name, err)
 	i, err := strconv.Atoi(size[0])
 	log.Check(log.DebugLevel, "Parsing quota size", err)
 	if i > 0 {
-		log.Check(log.DebugLevel, "Setting memory limit", c.SetMemoryLimit(lxc.ByteSize(i*1024*1024)))
-		SetContainerConf(name, [][]string{{"lxc.cgroup.memory.limit_in_bytes", size[0] + "M"}})
+		if State(name) == "RUNNING" {
+			log.Check(log.DebugLevel, "Setting memory limit", cgroup.SetMemoryLimit(name, i*1024*1024))
+		}
+		SetContainerConf(name, cgroup.Config("memory.limit_in_bytes", "memory.max", size[0]+"M"))
 	}
-	limit, err := c.MemoryLimit()
-	log.Check(log.DebugLevel, "Getting memory limit of container: "+name, err)
-	return int(limit / 1024 / 1024)
+	limit, err := cgroup.MemoryLimit(name)
+	if err != nil {
+		value := GetConfigItem(config.Agent.LxcPrefix+name+"/config", cgroup.ConfigKey("memory.limit_in_bytes", "memory.max"))
+		if mb, err := strconv.Atoi(strings.TrimSuffix(value, "M")); err == nil && strings.HasSuffix(value, "M") {
+			return mb
+		}
+		limit, _ = strconv.Atoi(value)
+	}
+	if limit < 0 {
+		return 0
+	}
+	return limit / 1024 / 1024
 }
 
 // QuotaCPU sets container CPU limitation and return current value in percents.
 // If passed value < 100, we assume that this value mean percents.
 // If passed value > 100, we assume that this value mean MHz.
 func QuotaCPU(name string, size ...string) int {
-	c, err := lxc.NewContainer(name, config.Agent.LxcPrefix)
-	if err == nil {
-		defer lxc.Release(c)
-	}
-	log.Check(log.DebugLevel, "Looking for container: "+name, err)
 	cfsPeriod := 100000
 	tmp, err := strconv.Atoi(size[0])
 	log.Check(log.DebugLevel, "Parsing quota size", err)
@@ -453,30 +480,40 @@ func QuotaCPU(name string, size ...string) int {
 		quota = quota * 100 / float32(freq) / float32(runtime.NumCPU())
 	}
 
-	if size[0] != "" && State(name) == "RUNNING" {
-		value := strconv.Itoa(int(float32(cfsPeriod) * float32(runtime.NumCPU()) * quota / 100))
-		log.Check(log.DebugLevel, "Setting cpu.cfs_quota_us", c.SetCgroupItem("cpu.cfs_quota_us", value))
-
-		SetContainerConf(name, [][]string{{"lxc.cgroup.cpu.cfs_quota_us", value}})
+	if size[0] != "" {
+		value := int(float32(cfsPeriod) * float32(runtime.NumCPU()) * quota / 100)
+		if State(name) == "RUNNING" {
+			log.Check(log.DebugLevel, "Setting CPU limit", cgroup.SetCPULimit(name, value, cfsPeriod))
+		}
+		conf := strconv.Itoa(value)
+		if cgroup.Mode() == cgroup.Unified {
+			conf += " " + strconv.Itoa(cfsPeriod)
+		}
+		SetContainerConf(name, cgroup.Config("cpu.cfs_quota_us", "cpu.max", conf))
 	}
 
-	result, err := strconv.Atoi(c.CgroupItem("cpu.cfs_quota_us")[0])
-	log.Check(log.DebugLevel, "Parsing quota size", err)
-	return result * 100 / cfsPeriod / runtime.NumCPU()
+	result, period, err := cgroup.CPULimit(name)
+	if err != nil {
+		result, period = cgroup.ParseCPU(GetConfigItem(config.Agent.LxcPrefix+name+"/config", cgroup.ConfigKey("cpu.cfs_quota_us", "cpu.max")))
+	}
+	if result < 0 || period == 0 {
+		return 0
+	}
+	return result * 100 / period / runtime.NumCPU()
 }
 
 // QuotaCPUset sets particular cores that can be used by the Subutai container.
 func QuotaCPUset(name string, size ...string) string {
-	c, err := lxc.NewContainer(name, config.Agent.LxcPrefix)
-	if err == nil {
-		defer lxc.Release(c)
-	}
-	log.Check(log.DebugLevel, "Looking for container: "+name, err)
 	if size[0] != "" {
-		log.Check(log.DebugLevel, "Setting cpuset.cpus", c.SetCgroupItem("cpuset.cpus", size[0]))
-		SetContainerConf(name, [][]string{{"lxc.cgroup.cpuset.cpus", size[0]}})
+		if State(name) == "RUNNING" {
+			log.Check(log.DebugLevel, "Setting cpuset.cpus", cgroup.SetCPUSet(name, size[0]))
+		}
+		SetContainerConf(name, cgroup.Config("cpuset.cpus", "cpuset.cpus", size[0]))
+	}
+	if cpus, err := cgroup.CPUSet(name); err == nil && cpus != "" {
+		return cpus
 	}
-	return c.CgroupItem("cpuset.cpus")[0]
+	return GetConfigItem(config.Agent.LxcPrefix+name+"/config", cgroup.ConfigKey("cpuset.cpus", "cpuset.cpus"))
 }
 
 // QuotaNet sets network bandwidth for the Subutai container.
@@ -493,51 +530,128 @@ func QuotaNet(name string, size ...string) string {
 	return net.RateLimit(nic, size[0])
 }
 
-// SetContainerConf sets any parameter in the configuration file of the Subutai container.
-func SetContainerConf(container string, conf [][]string) error {
-	confPath := config.Agent.LxcPrefix + container + "/config"
-	newconf := ""
+// QuotaIO sets block I/O limits of the Subutai container on the device holding containers and returns current limits.
+// Limits are passed as comma separated key=value pairs, zero value removes the limit:
+//	rbps, wbps, read and write bandwidth in bytes per second
+//	riops, wiops, read and write operations per second
+func QuotaIO(name string, size ...string) string {
+	dev, err := fs.Device()
+	log.Check(log.DebugLevel, "Looking for containers block device", err)
+	running := State(name) == "RUNNING"
 
-	file, err := os.Open(confPath)
-	if log.Check(log.DebugLevel, "Opening container config "+confPath, err) {
-		return err
+	limits := ioConfig(name, dev)
+	if running {
+		limits = cgroup.IOLimits(name, dev)
 	}
-	defer file.Close()
-	scanner := bufio.NewScanner(bufio.NewReader(file))
-	for scanner.Scan() {
-		newline := scanner.Text() + "\n"
-		for i := 0; i < len(conf); i++ {
-			line := strings.Split(scanner.Text(), "=")
-			if len(line) > 1 && strings.Trim(line[0], " ") == conf[i][0] {
-				if newline = ""; len(conf[i][1]) > 0 {
-					newline = conf[i][0] + " = " + conf[i][1] + "\n"
-				}
-				conf = append(conf[:i], conf[i+1:]...)
-				break
+
+	if size[0] != "" && dev != "" {
+		for _, limit := range strings.Split(size[0], ",") {
+			kv := strings.SplitN(limit, "=", 2)
+			if _, ok := cgroup.IOFiles[kv[0]]; len(kv) != 2 || !ok {
+				log.Debug("Skipping unknown I/O limit " + limit)
+				continue
+			}
+			value, err := strconv.Atoi(kv[1])
+			if log.Check(log.DebugLevel, "Parsing quota size", err) {
+				continue
 			}
+			if running {
+				log.Check(log.DebugLevel, "Setting "+kv[0]+" limit", cgroup.SetIOLimit(name, dev, kv[0], value))
+			}
+			limits[kv[0]] = value
 		}
-		newconf = newconf + newline
+		SetContainerConf(name, ioConf(dev, limits))
 	}
 
-	for i := range conf {
-		if conf[i][1] != "" {
-			newconf = newconf + conf[i][0] + " = " + conf[i][1] + "\n"
+	var list []string
+	for _, k := range cgroup.IOKeys {
+		list = append(list, k+"="+strconv.Itoa(limits[k]))
+	}
+	return strings.Join(list, ",")
+}
+
+// ioConfig reads block I/O limits on the device from container config
+func ioConfig(name, dev string) map[string]int {
+	confPath := config.Agent.LxcPrefix + name + "/config"
+	limits := make(map[string]int)
+	if cgroup.Mode() == cgroup.Unified {
+		if fields := strings.Fields(GetConfigItem(confPath, "lxc.cgroup2.io.max")); len(fields) > 1 && fields[0] == dev {
+			limits = cgroup.ParseIO(fields[1:])
 		}
+		return limits
 	}
-	return ioutil.WriteFile(confPath, []byte(newconf), 0644)
+	for k, file := range cgroup.IOFiles {
+		if fields := strings.Fields(GetConfigItem(confPath, "lxc.cgroup."+file)); len(fields) > 1 && fields[0] == dev {
+			limits[k], _ = strconv.Atoi(fields[1])
+		}
+	}
+	return limits
 }
 
-// GetConfigItem return any parameter from the configuration file of the Subutai container.
-func GetConfigItem(path, item string) string {
-	if cfg, err := os.Open(path); err == nil {
-		defer cfg.Close()
-		scanner := bufio.NewScanner(cfg)
-		for scanner.Scan() {
-			line := strings.Split(scanner.Text(), "=")
-			if strings.Trim(line[0], " ") == item {
-				return strings.Trim(line[1], " ")
+// ioConf returns container config entries of block I/O limits: legacy hierarchy has an entry per limit, unified one keeps all limits in io.max entry
+func ioConf(dev string, limits map[string]int) (conf [][]string) {
+	var max []string
+	for _, k := range cgroup.IOKeys {
+		value := ""
+		if limits[k] > 0 {
+			max = append(max, k+"="+strconv.Itoa(limits[k]))
+			if cgroup.Mode() != cgroup.Unified {
+				value = dev + " " + strconv.Itoa(limits[k])
+			}
+		}
+		conf = append(conf, []string{"lxc.cgroup." + cgroup.IOFiles[k], value})
+	}
+	value := ""
+	if len(max) > 0 && cgroup.Mode() == cgroup.Unified {
+		value = dev + " " + strings.Join(max, " ")
+	}
+	return append(conf, []string{"lxc.cgroup2.io.max", value})
+}
+
+// QuotaPids sets maximum number of processes in the Subutai container, zero value removes the limit.
+func QuotaPids(name string, size ...string) int {
+	if size[0] != "" {
+		value, err := strconv.Atoi(size[0])
+		if !log.Check(log.DebugLevel, "Parsing quota size", err) {
+			if State(name) == "RUNNING" {
+				log.Check(log.DebugLevel, "Setting pids.max", cgroup.SetPidsLimit(name, value))
 			}
+			limit := ""
+			if value > 0 {
+				limit = strconv.Itoa(value)
+			}
+			SetContainerConf(name, cgroup.Config("pids.max", "pids.max", limit))
+		}
+	}
+
+	if _, limit, err := cgroup.Pids(name); err == nil {
+		if limit < 0 {
+			return 0
 		}
+		return limit
+	}
+	limit, _ := strconv.Atoi(GetConfigItem(config.Agent.LxcPrefix+name+"/config", cgroup.ConfigKey("pids.max", "pids.max")))
+	return limit
+}
+
+// SetContainerConf sets any parameter in the configuration file of the Subutai container.
+// Repeated keys address successive occurrences of the key, empty value removes the occurrence.
+func SetContainerConf(container string, conf [][]string) error {
+	confPath := config.Agent.LxcPrefix + container + "/config"
+	cfg, err := ReadConfig(confPath)
+	if log.Check(log.DebugLevel, "Opening container config "+confPath, err) {
+		return err
+	}
+	if err = cfg.Apply(conf); err != nil {
+		return err
+	}
+	return cfg.Write()
+}
+
+// GetConfigItem return any parameter from the configuration file of the Subutai container.
+func GetConfigItem(path, item string) string {
+	if cfg, err := ReadConfig(path); err == nil {
+		return cfg.Get(item)
 	}
 	return ""
 }
@@ -594,11 +708,10 @@ func SetDNS(name string) {
 
 // CriuHax adds container config needed by CRIU
 func CriuHax(name string) {
-	SetContainerConf(name, [][]string{
+	SetContainerConf(name, append([][]string{
 		{"lxc.console", "none"},
 		{"lxc.tty", "0"},
-		{"lxc.cgroup.devices.deny", "c 5:1 rwm"},
-	})
+	}, cgroup.Config("devices.deny", "devices.deny", "c 5:1 rwm")...))
 }
 
 func CopyParentReference(name string, owner string, version string) {
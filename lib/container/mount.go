@@ -0,0 +1,446 @@
+package container
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/db"
+	"github.com/subutai-io/agent/log"
+
+	"golang.org/x/sys/unix"
+	"gopkg.in/lxc/go-lxc.v2"
+)
+
+// BindMount is a host directory or file bind mounted into the container.
+// Shift means that ownership of the source was shifted into the container user namespace when the mount was added.
+type BindMount struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"readonly"`
+	Shift    bool   `json:"shift"`
+}
+
+// systemDirs are host directories whose ownership is never shifted, neither the directories themselves nor anything inside them
+var systemDirs = []string{
+	"/bin", "/boot", "/dev", "/etc", "/lib", "/lib32", "/lib64", "/libx32", "/proc", "/root", "/run", "/sbin", "/snap", "/sys", "/usr",
+	"/var/cache", "/var/lib", "/var/log", "/var/mail", "/var/run", "/var/snap", "/var/spool",
+}
+
+// topDirs are host directories whose ownership is never shifted, while their subdirectories may be shifted
+var topDirs = []string{"/home", "/media", "/mnt", "/opt", "/srv", "/tmp", "/var"}
+
+// entry returns config mount entry of the bind mount, mount point is created if it doesn't exist
+func (m BindMount) entry() string {
+	options := "bind,create=dir"
+	if info, err := os.Stat(m.Source); err == nil && !info.IsDir() {
+		options = "bind,create=file"
+	}
+	if m.ReadOnly {
+		options += ",ro"
+	}
+	return m.Source + " " + strings.TrimPrefix(m.Target, "/") + " none " + options + " 0 0"
+}
+
+// ValidMount checks source and target paths of the bind mount and returns them cleaned.
+// Sources inside LXC prefix are refused, named volumes should be used to share container data.
+func ValidMount(name string, m BindMount) (BindMount, error) {
+	if !filepath.IsAbs(m.Source) || !filepath.IsAbs(m.Target) {
+		return m, errors.New("host and container paths must be absolute")
+	}
+	m.Source, m.Target = filepath.Clean(m.Source), filepath.Clean(m.Target)
+	if strings.ContainsAny(m.Source+m.Target, " \t\n") {
+		return m, errors.New("paths with whitespaces are not supported")
+	}
+	if m.Source == "/" || m.Target == "/" {
+		return m, errors.New("root directory can't be bind mounted")
+	}
+	for _, p := range []string{"/proc", "/sys", strings.TrimSuffix(config.Agent.LxcPrefix, "/")} {
+		if m.Source == p || strings.HasPrefix(m.Source, p+"/") {
+			return m, errors.New(m.Source + " can't be bind mounted")
+		}
+	}
+	if _, err := os.Stat(m.Source); err != nil {
+		return m, errors.New(m.Source + " not found")
+	}
+	if m.Shift {
+		for _, p := range systemDirs {
+			if m.Source == p || strings.HasPrefix(m.Source, p+"/") {
+				return m, errors.New("ownership of system directory " + m.Source + " can't be shifted")
+			}
+		}
+		if stringInList(m.Source, topDirs) {
+			return m, errors.New("ownership of system directory " + m.Source + " can't be shifted")
+		}
+	}
+	if src, ok := Mounts(name)[m.Target]; ok {
+		return m, errors.New(m.Target + " is already mounted from " + src)
+	}
+	return m, nil
+}
+
+// HostMounts returns host directories bind mounted into the container, i.e. bind mount entries of the config
+// except the container volumes and named volumes.
+func HostMounts(name string) (list []BindMount) {
+	own := config.Agent.LxcPrefix + name + "/"
+	for _, entry := range ConfigItems(config.Agent.LxcPrefix+name+"/config", "lxc.mount.entry") {
+		fields := strings.Fields(entry)
+		if len(fields) < 4 || !strings.Contains(fields[3], "bind") || !filepath.IsAbs(fields[0]) ||
+			strings.HasPrefix(fields[0], own) || strings.HasPrefix(fields[0], VolumePath("")) {
+			continue
+		}
+		m := BindMount{Source: filepath.Clean(fields[0]), Target: filepath.Clean("/" + fields[1])}
+		m.ReadOnly = stringInList("ro", strings.Split(fields[3], ","))
+		list = append(list, m)
+	}
+	return list
+}
+
+// SavedMounts returns bind mounts of the container saved in the database
+func SavedMounts(name string) (list []BindMount) {
+	bolt, err := db.New()
+	if log.Check(log.WarnLevel, "Opening database", err) {
+		return nil
+	}
+	defer bolt.Close()
+	for _, m := range bolt.ContainerMounts(name) {
+		list = append(list, BindMount{Source: m["source"], Target: m["target"], ReadOnly: m["readonly"] == "true", Shift: m["shift"] == "true"})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Target < list[j].Target })
+	return list
+}
+
+// saveMount records the bind mount in the database, nil mount removes the record of the target
+func saveMount(name, target string, m *BindMount) error {
+	bolt, err := db.New()
+	if err != nil {
+		return err
+	}
+	defer bolt.Close()
+	if m == nil {
+		return bolt.ContainerMount(name, target, nil)
+	}
+	return bolt.ContainerMount(name, target, map[string]string{
+		"source":   m.Source,
+		"readonly": strconv.FormatBool(m.ReadOnly),
+		"shift":    strconv.FormatBool(m.Shift),
+	})
+}
+
+// AddMount bind mounts host directory or file into the container: adds config mount entry and saves it in the database.
+// Shift option passes ownership of the source tree into the container user namespace, it is refused if the tree has ids
+// which don't fit the namespace, i.e. outside 0-65535 range. Original owners are recorded, so DelMount restores them exactly.
+// If the container is running, the mount is also applied to it right away when the kernel allows,
+// live is false if the container has to be restarted.
+func AddMount(name string, m BindMount) (live bool, err error) {
+	base := UIDBase(name)
+	if m.Shift && base > 0 {
+		if err = shiftIn(name, m, base); err != nil {
+			return false, err
+		}
+	}
+
+	cfg, err := ReadConfig(config.Agent.LxcPrefix + name + "/config")
+	if err != nil {
+		return false, err
+	}
+	if err = cfg.Add("lxc.mount.entry", m.entry()); err != nil {
+		return false, err
+	}
+	if err = cfg.Write(); err != nil {
+		return false, err
+	}
+	if err = saveMount(name, m.Target, &m); err != nil {
+		return false, err
+	}
+	return mountLive(name, m), nil
+}
+
+// DelMount removes bind mount of the target from the container config and the database, unmounts it from the running container
+// and shifts ownership of the source back to the host if it was shifted when the mount was added.
+func DelMount(name, target string) error {
+	target = filepath.Clean("/" + target)
+	var m *BindMount
+	for _, saved := range SavedMounts(name) {
+		if saved.Target == target {
+			m = &saved
+			break
+		}
+	}
+	if m == nil {
+		for _, mounted := range HostMounts(name) {
+			if mounted.Target == target {
+				m = &mounted
+				break
+			}
+		}
+	}
+	if m == nil {
+		return errors.New(target + " is not mounted")
+	}
+
+	cfg, err := ReadConfig(config.Agent.LxcPrefix + name + "/config")
+	if err != nil {
+		return err
+	}
+	for _, entry := range cfg.Values("lxc.mount.entry") {
+		if fields := strings.Fields(entry); len(fields) > 1 && filepath.Clean("/"+fields[1]) == target {
+			cfg.Delete("lxc.mount.entry", entry)
+		}
+	}
+	if err = cfg.Write(); err != nil {
+		return err
+	}
+	if err = saveMount(name, target, nil); err != nil {
+		return err
+	}
+
+	if pid := initPid(name); pid > 0 {
+		err = inMountNS(pid, func() error { return unix.Unmount(target, unix.MNT_DETACH|unix.UMOUNT_NOFOLLOW) })
+		log.Check(log.DebugLevel, "Unmounting "+target+" from "+name, err)
+	}
+
+	if base := UIDBase(name); m.Shift && base > 0 {
+		return shiftOut(name, *m, base)
+	}
+	return nil
+}
+
+// ownersFile returns path of the file recording original owners of the shifted mount source
+func ownersFile(name, target string) string {
+	return config.Agent.LxcPrefix + name + "/shift/" + url.QueryEscape(strings.TrimPrefix(target, "/"))
+}
+
+// shiftIn records owners of the mount source tree and shifts them into the container user namespace.
+// Nothing is changed if any id of the tree is out of 0-65535 range, partially shifted tree is restored on failure.
+func shiftIn(name string, m BindMount, base int) error {
+	owners := make(map[string][2]int)
+	err := filepath.Walk(m.Source, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			if st.Uid >= 65536 || st.Gid >= 65536 {
+				return errors.New("owner of " + p + " is out of 0-65535 range, ownership can't be shifted")
+			}
+			owners[p] = [2]int{int(st.Uid), int(st.Gid)}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(owners)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(ownersFile(name, m.Target)), 0700); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(ownersFile(name, m.Target), data, 0600); err != nil {
+		return err
+	}
+
+	err = shiftTree(m.Source, func(p string, uid, gid int) (int, int) {
+		if _, ok := owners[p]; ok && uid < 65536 && gid < 65536 {
+			return uid + base, gid + base
+		}
+		return uid, gid
+	})
+	if err != nil {
+		log.Check(log.WarnLevel, "Restoring owners of "+m.Source, shiftOut(name, m, base))
+	}
+	return err
+}
+
+// shiftOut shifts ownership of the mount source tree back to the host. Files which still have shifted owners get
+// the recorded ones, files created or chowned in the container are shifted by the uid base.
+func shiftOut(name string, m BindMount, base int) error {
+	owners := make(map[string][2]int)
+	if data, err := ioutil.ReadFile(ownersFile(name, m.Target)); err == nil {
+		log.Check(log.WarnLevel, "Parsing owners of "+m.Source, json.Unmarshal(data, &owners))
+	}
+	unshift := func(id int) int {
+		if id >= base && id < base+65536 {
+			return id - base
+		}
+		return id
+	}
+	err := shiftTree(m.Source, func(p string, uid, gid int) (int, int) {
+		if o, ok := owners[p]; ok && uid == o[0]+base && gid == o[1]+base {
+			return o[0], o[1]
+		}
+		return unshift(uid), unshift(gid)
+	})
+	if err == nil {
+		os.Remove(ownersFile(name, m.Target))
+	}
+	return err
+}
+
+// ExportMounts writes database records of the container bind mounts into mounts.json file of the directory,
+// backup keeps it with container meta files, so restore and migration to other host reproduce the mounts
+func ExportMounts(name, dir string) error {
+	data, err := json.Marshal(SavedMounts(name))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "mounts.json"), data, 0644)
+}
+
+// RestoreMounts reproduces bind mounts of the source container in the restored or migrated one.
+// Mounts are taken from the database records of the source, if any, from mounts.json file restored from the backup
+// and from the restored config, missing config entries are added and all mounts are saved in the database under the new name.
+func RestoreMounts(src, dst string) {
+	mounts := make(map[string]BindMount)
+	for _, m := range HostMounts(dst) {
+		mounts[m.Target] = m
+	}
+	if data, err := ioutil.ReadFile(config.Agent.LxcPrefix + dst + "/mounts.json"); err == nil {
+		var list []BindMount
+		log.Check(log.WarnLevel, "Parsing mounts of "+src, json.Unmarshal(data, &list))
+		for _, m := range list {
+			mounts[m.Target] = m
+		}
+		log.Check(log.DebugLevel, "Removing mounts.json", os.Remove(config.Agent.LxcPrefix+dst+"/mounts.json"))
+	}
+	for _, m := range SavedMounts(src) {
+		mounts[m.Target] = m
+	}
+
+	cfg, err := ReadConfig(config.Agent.LxcPrefix + dst + "/config")
+	if log.Check(log.WarnLevel, "Reading config of "+dst, err) {
+		return
+	}
+	existing := make(map[string]bool)
+	for _, m := range HostMounts(dst) {
+		existing[m.Target] = true
+	}
+	for target, m := range mounts {
+		if _, err := os.Stat(m.Source); err != nil {
+			log.Warn("Source " + m.Source + " of " + dst + ":" + target + " mount not found on this host")
+		}
+		if !existing[target] {
+			log.Check(log.WarnLevel, "Adding mount "+target, cfg.Add("lxc.mount.entry", m.entry()))
+		}
+		log.Check(log.WarnLevel, "Saving mount "+target, saveMount(dst, target, &m))
+	}
+	log.Check(log.WarnLevel, "Writing config of "+dst, cfg.Write())
+}
+
+// mountLive applies the bind mount to the running container. The source tree is cloned on the host into a detached mount,
+// which is moved onto the mount point from inside the container mount namespace, so the mount point is resolved against
+// the container root and symlinks inside the container can't redirect the mount to the host. It requires Linux 5.2,
+// read-only mounts require Linux 5.12; otherwise the mount is applied on restart.
+func mountLive(name string, m BindMount) bool {
+	pid := initPid(name)
+	if pid <= 0 {
+		return false
+	}
+	info, err := os.Stat(m.Source)
+	if err != nil {
+		return false
+	}
+	fd, err := unix.OpenTree(unix.AT_FDCWD, m.Source, unix.OPEN_TREE_CLONE|unix.O_CLOEXEC)
+	if log.Check(log.DebugLevel, "Cloning "+m.Source, err) {
+		return false
+	}
+	defer unix.Close(fd)
+	if m.ReadOnly {
+		err = unix.MountSetattr(fd, "", unix.AT_EMPTY_PATH, &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY})
+		if log.Check(log.DebugLevel, "Making "+m.Source+" read-only", err) {
+			return false
+		}
+	}
+
+	base := UIDBase(name)
+	err = inMountNS(pid, func() error {
+		if _, err := os.Lstat(m.Target); os.IsNotExist(err) {
+			if info.IsDir() {
+				err = os.MkdirAll(m.Target, 0755)
+			} else if err = os.MkdirAll(filepath.Dir(m.Target), 0755); err == nil {
+				var f *os.File
+				if f, err = os.OpenFile(m.Target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644); err == nil {
+					f.Close()
+				}
+			}
+			if err != nil {
+				return err
+			}
+			log.Check(log.DebugLevel, "Changing mount point owner", os.Lchown(m.Target, base, base))
+		}
+		return unix.MoveMount(fd, "", unix.AT_FDCWD, m.Target, unix.MOVE_MOUNT_F_EMPTY_PATH)
+	})
+	return !log.Check(log.DebugLevel, "Mounting "+m.Source+" to "+name+":"+m.Target, err)
+}
+
+// inMountNS runs the function in the mount namespace of the process, so paths are resolved against the container root.
+// Mount namespace can't be entered by a thread sharing filesystem attributes with others, so the function runs on a locked
+// thread with own attributes, which is never unlocked and exits with the goroutine.
+func inMountNS(pid int, fn func() error) error {
+	ns, err := os.Open("/proc/" + strconv.Itoa(pid) + "/ns/mnt")
+	if err != nil {
+		return err
+	}
+	defer ns.Close()
+	result := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if err := unix.Unshare(unix.CLONE_FS); err != nil {
+			result <- err
+			return
+		}
+		if err := unix.Setns(int(ns.Fd()), unix.CLONE_NEWNS); err != nil {
+			result <- err
+			return
+		}
+		result <- fn()
+	}()
+	return <-result
+}
+
+// initPid returns host pid of the container init process, 0 if container is not running
+func initPid(name string) int {
+	c, err := lxc.NewContainer(name, config.Agent.LxcPrefix)
+	if err != nil {
+		return 0
+	}
+	defer lxc.Release(c)
+	if !c.Running() {
+		return 0
+	}
+	return c.InitPid()
+}
+
+// shiftTree changes owner ids of all files of the tree with the map function, setuid and setgid bits cleared by chown are restored
+func shiftTree(path string, shift func(p string, uid, gid int) (int, int)) error {
+	return filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		uid, gid := shift(p, int(st.Uid), int(st.Gid))
+		if uid == int(st.Uid) && gid == int(st.Gid) {
+			return nil
+		}
+		if err = os.Lchown(p, uid, gid); err != nil {
+			return err
+		}
+		if info.Mode()&(os.ModeSetuid|os.ModeSetgid) != 0 && info.Mode()&os.ModeSymlink == 0 {
+			return os.Chmod(p, info.Mode())
+		}
+		return nil
+	})
+}
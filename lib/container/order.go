@@ -0,0 +1,98 @@
+package container
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/subutai-io/agent/config"
+)
+
+// StartAfter returns list of containers which should be started before the specified one.
+// Dependencies are set in the "subutai.start.after" container config key as comma or space separated names.
+func StartAfter(name string) (list []string) {
+	value := GetConfigItem(config.Agent.LxcPrefix+name+"/config", "subutai.start.after")
+	for _, dep := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if dep != name {
+			list = append(list, dep)
+		}
+	}
+	return
+}
+
+// StartOrder returns start priority of the container set in the "subutai.start.order" config key.
+// Containers with lower value are started first, default priority is 0.
+func StartOrder(name string) int {
+	order, _ := strconv.Atoi(GetConfigItem(config.Agent.LxcPrefix+name+"/config", "subutai.start.order"))
+	return order
+}
+
+// StartDelay returns number of seconds to wait after the container start before starting containers depending on it.
+// The delay is set in the "subutai.start.delay" config key.
+func StartDelay(name string) int {
+	if delay, err := strconv.Atoi(GetConfigItem(config.Agent.LxcPrefix+name+"/config", "subutai.start.delay")); err == nil && delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+// Order splits containers into start levels: containers of each level depend only on containers of previous levels,
+// so containers of the same level may be started simultaneously. Besides explicit "subutai.start.after" dependencies,
+// each container depends on all containers with lower start order. Dependencies on containers not present in the list are ignored.
+// Containers with cyclic dependencies, and containers depending on them, cannot be ordered and are returned separately.
+func Order(names []string) (levels [][]string, cycle []string) {
+	deps := make(map[string][]string)
+	order := make(map[string]int)
+	for _, name := range names {
+		deps[name] = []string{}
+		order[name] = StartOrder(name)
+	}
+	for _, name := range names {
+		for _, dep := range StartAfter(name) {
+			if _, ok := deps[dep]; ok {
+				deps[name] = append(deps[name], dep)
+			}
+		}
+		for _, dep := range names {
+			if order[dep] < order[name] {
+				deps[name] = append(deps[name], dep)
+			}
+		}
+	}
+
+	done := make(map[string]bool)
+	for len(done) < len(deps) {
+		var level []string
+		for name, list := range deps {
+			if done[name] {
+				continue
+			}
+			ready := true
+			for _, dep := range list {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				level = append(level, name)
+			}
+		}
+		if len(level) == 0 {
+			break
+		}
+		sort.Strings(level)
+		for _, name := range level {
+			done[name] = true
+		}
+		levels = append(levels, level)
+	}
+
+	for name := range deps {
+		if !done[name] {
+			cycle = append(cycle, name)
+		}
+	}
+	sort.Strings(cycle)
+	return
+}
@@ -0,0 +1,95 @@
+package container
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStartAfter(t *testing.T) {
+	testContainers(t, map[string]string{
+		"a": "subutai.start.after = b, c d\n",
+		"b": "subutai.start.after = b\n",
+		"c": "lxc.utsname = c\n",
+	})
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"a", []string{"b", "c", "d"}},
+		{"b", nil},
+		{"c", nil},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		if got := StartAfter(tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("StartAfter(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStartOrder(t *testing.T) {
+	testContainers(t, map[string]string{
+		"a": "subutai.start.order = 5\n",
+		"b": "subutai.start.order = -2\n",
+		"c": "subutai.start.order = first\n",
+		"d": "lxc.utsname = d\n",
+	})
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"a", 5},
+		{"b", -2},
+		{"c", 0},
+		{"d", 0},
+		{"missing", 0},
+	}
+	for _, tt := range tests {
+		if got := StartOrder(tt.name); got != tt.want {
+			t.Errorf("StartOrder(%q) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs map[string]string
+		names   []string
+		levels  [][]string
+		cycle   []string
+	}{
+		{"independent",
+			map[string]string{"a": "", "b": "", "c": ""},
+			[]string{"c", "a", "b"},
+			[][]string{{"a", "b", "c"}}, nil},
+		{"dependencies",
+			map[string]string{"db": "", "app": "subutai.start.after = db\n", "web": "subutai.start.after = app,db\n"},
+			[]string{"web", "app", "db"},
+			[][]string{{"db"}, {"app"}, {"web"}}, nil},
+		{"start order",
+			map[string]string{"a": "subutai.start.order = 2\n", "b": "subutai.start.order = -1\n", "c": "", "d": ""},
+			[]string{"a", "b", "c", "d"},
+			[][]string{{"b"}, {"c", "d"}, {"a"}}, nil},
+		{"order and dependencies",
+			map[string]string{"a": "subutai.start.after = c\n", "b": "subutai.start.order = 1\n", "c": ""},
+			[]string{"a", "b", "c"},
+			[][]string{{"c"}, {"a"}, {"b"}}, nil},
+		{"dependency not in list",
+			map[string]string{"a": "subutai.start.after = missing\n", "b": ""},
+			[]string{"a", "b"},
+			[][]string{{"a", "b"}}, nil},
+		{"cycle",
+			map[string]string{"a": "subutai.start.after = b\n", "b": "subutai.start.after = a\n", "c": "subutai.start.after = a\n", "d": ""},
+			[]string{"a", "b", "c", "d"},
+			[][]string{{"d"}}, []string{"a", "b", "c"}},
+		{"empty", map[string]string{}, nil, nil, nil},
+	}
+	for _, tt := range tests {
+		testContainers(t, tt.configs)
+		levels, cycle := Order(tt.names)
+		if !reflect.DeepEqual(levels, tt.levels) || !reflect.DeepEqual(cycle, tt.cycle) {
+			t.Errorf("%s: Order(%q) = %q, %q, want %q, %q", tt.name, tt.names, levels, cycle, tt.levels, tt.cycle)
+		}
+	}
+}
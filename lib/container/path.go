@@ -0,0 +1,93 @@
+package container
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/subutai-io/agent/config"
+)
+
+// Mounts returns bind mounts of the Subutai container: absolute paths inside the container mapped to host paths.
+// The container root is mapped to its rootfs, so every container path resolves to a host path.
+func Mounts(name string) map[string]string {
+	mounts := map[string]string{"/": config.Agent.LxcPrefix + name + "/rootfs"}
+	for _, entry := range ConfigItems(config.Agent.LxcPrefix+name+"/config", "lxc.mount.entry") {
+		fields := strings.Fields(entry)
+		if len(fields) < 4 || !strings.Contains(fields[3], "bind") || !filepath.IsAbs(fields[0]) {
+			continue
+		}
+		mounts[filepath.Clean("/"+fields[1])] = filepath.Clean(fields[0])
+	}
+	return mounts
+}
+
+// ConfigItems returns values of all occurrences of the item in the container config, e.g. mount entries.
+func ConfigItems(path, item string) []string {
+	if cfg, err := ReadConfig(path); err == nil {
+		return cfg.Values(item)
+	}
+	return nil
+}
+
+// HostPath resolves absolute path inside the Subutai container to the path on the host, taking bind mounted subvolumes into account.
+// Symlinks inside the container are resolved relative to the container root, so the result never points outside of the container.
+// The last path element is not required to exist.
+func HostPath(name, path string) (string, error) {
+	mounts := Mounts(name)
+	resolved := "/"
+	rest := strings.Split(filepath.Clean("/"+path), "/")
+	for hops := 0; len(rest) > 0; {
+		elem := rest[0]
+		rest = rest[1:]
+		if elem == "" || elem == "." {
+			continue
+		}
+		if elem == ".." {
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, elem)
+		target, err := os.Readlink(hostPath(mounts, next))
+		if err != nil {
+			resolved = next
+			continue
+		}
+		if hops++; hops > 255 {
+			return "", errors.New("too many levels of symbolic links in " + path)
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(resolved, target)
+		}
+		resolved = "/"
+		rest = append(strings.Split(filepath.Clean(target), "/"), rest...)
+	}
+	return hostPath(mounts, resolved), nil
+}
+
+// hostPath maps clean container path to the host using the longest matching mount point
+func hostPath(mounts map[string]string, path string) string {
+	for mp := path; ; mp = filepath.Dir(mp) {
+		if src, ok := mounts[mp]; ok {
+			return filepath.Join(src, strings.TrimPrefix(path, mp))
+		}
+		if mp == "/" {
+			return filepath.Join(mounts["/"], path)
+		}
+	}
+}
+
+// UIDBase returns the first host uid of the user namespace of the Subutai container, i.e. host uid of the container root.
+// Zero is returned for the containers without id mapping.
+func UIDBase(name string) int {
+	for _, entry := range ConfigItems(config.Agent.LxcPrefix+name+"/config", "lxc.id_map") {
+		if fields := strings.Fields(entry); len(fields) == 4 && fields[0] == "u" && fields[1] == "0" {
+			if base, err := strconv.Atoi(fields[2]); err == nil {
+				return base
+			}
+		}
+	}
+	return 0
+}
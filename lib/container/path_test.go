@@ -0,0 +1,62 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/subutai-io/agent/config"
+)
+
+func TestHostPath(t *testing.T) {
+	testContainers(t, map[string]string{"foo": ""})
+	prefix := config.Agent.LxcPrefix
+	rootfs := prefix + "foo/rootfs"
+	if err := os.MkdirAll(rootfs+"/etc/app", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(prefix+"data", 0755); err != nil {
+		t.Fatal(err)
+	}
+	conf := "lxc.mount.entry = " + prefix + "data var/data none bind,create=dir 0 0\n" +
+		"lxc.mount.entry = proc proc proc nodev,noexec,nosuid 0 0\n"
+	if err := ioutil.WriteFile(prefix+"foo/config", []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"/etc/current": "app",
+		"/etc/abs":     "/etc/app",
+		"/etc/escape":  "../../../../..",
+		"/etc/data":    "/var/data/sub",
+		"/etc/loop":    "loop",
+	} {
+		if err := os.Symlink(target, rootfs+link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path, want string
+		err        bool
+	}{
+		{"/", rootfs, false},
+		{"/etc/hosts", rootfs + "/etc/hosts", false},
+		{"etc/./app/../hosts", rootfs + "/etc/hosts", false},
+		{"/../../etc", rootfs + "/etc", false},
+		{"/etc/current/file", rootfs + "/etc/app/file", false},
+		{"/etc/abs/file", rootfs + "/etc/app/file", false},
+		{"/etc/escape/etc", rootfs + "/etc", false},
+		{"/var/data", prefix + "data", false},
+		{"/var/data/sub/file", prefix + "data/sub/file", false},
+		{"/etc/data/file", prefix + "data/sub/file", false},
+		{"/var/database", rootfs + "/var/database", false},
+		{"/proc/1", rootfs + "/proc/1", false},
+		{"/etc/loop", "", true},
+	}
+	for _, tt := range tests {
+		got, err := HostPath("foo", tt.path)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("HostPath(%q) = %q, %v, want %q, error %v", tt.path, got, err, tt.want, tt.err)
+		}
+	}
+}
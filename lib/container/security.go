@@ -0,0 +1,192 @@
+package container
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/subutai-io/agent/config"
+)
+
+// Profile describes confinement of the container: AppArmor profile, seccomp policy and capabilities dropped in addition to LXC defaults.
+// Seccomp is either the name of a built-in policy or the path to a policy file.
+type Profile struct {
+	Name     string   `json:"profile"`
+	AppArmor string   `json:"apparmor,omitempty"`
+	Seccomp  string   `json:"seccomp,omitempty"`
+	CapsDrop []string `json:"capsDrop,omitempty"`
+}
+
+// Profiles are the built-in security profiles
+var Profiles = map[string]Profile{
+	"default": {
+		Name:     "default",
+		AppArmor: "lxc-container-default-cgns",
+		Seccomp:  "default",
+		CapsDrop: []string{"mac_admin", "mac_override", "sys_time", "sys_module", "sys_rawio"},
+	},
+	"strict": {
+		Name:     "strict",
+		AppArmor: "lxc-container-default",
+		Seccomp:  "strict",
+		CapsDrop: []string{"mac_admin", "mac_override", "sys_time", "sys_module", "sys_rawio", "sys_ptrace", "sys_boot", "syslog", "audit_control", "net_raw"},
+	},
+	"nesting": {
+		Name:     "nesting",
+		AppArmor: "lxc-container-default-with-nesting",
+		Seccomp:  "default",
+		CapsDrop: []string{"mac_admin", "mac_override", "sys_time", "sys_module", "sys_rawio"},
+	},
+}
+
+// seccompPolicies are the built-in seccomp policies in LXC policy format
+var seccompPolicies = map[string]string{
+	"default": `2
+blacklist
+reject_force_umount
+[all]
+kexec_load errno 1
+open_by_handle_at errno 1
+init_module errno 1
+finit_module errno 1
+delete_module errno 1
+`,
+	"strict": `2
+blacklist
+reject_force_umount
+[all]
+kexec_load errno 1
+open_by_handle_at errno 1
+init_module errno 1
+finit_module errno 1
+delete_module errno 1
+keyctl errno 38
+add_key errno 38
+request_key errno 38
+bpf errno 1
+perf_event_open errno 1
+userfaultfd errno 1
+ptrace errno 1
+process_vm_readv errno 1
+process_vm_writev errno 1
+kcmp errno 1
+lookup_dcookie errno 1
+swapon errno 1
+swapoff errno 1
+acct errno 1
+quotactl errno 1
+`,
+}
+
+// capabilities are Linux capability names accepted by lxc.cap.drop, without "cap_" prefix
+var capabilities = []string{
+	"chown", "dac_override", "dac_read_search", "fowner", "fsetid", "kill", "setgid", "setuid", "setpcap", "linux_immutable",
+	"net_bind_service", "net_broadcast", "net_admin", "net_raw", "ipc_lock", "ipc_owner", "sys_module", "sys_rawio", "sys_chroot",
+	"sys_ptrace", "sys_pacct", "sys_admin", "sys_boot", "sys_nice", "sys_resource", "sys_time", "sys_tty_config", "mknod", "lease",
+	"audit_write", "audit_control", "setfcap", "mac_override", "mac_admin", "syslog", "wake_alarm", "block_suspend", "audit_read",
+	"perfmon", "bpf", "checkpoint_restore",
+}
+
+// seccompPath returns path of the built-in seccomp policy file
+func seccompPath(policy string) string {
+	return config.Agent.DataPrefix + "seccomp/" + policy + ".seccomp"
+}
+
+// writePolicy creates the file of the built-in seccomp policy if it doesn't exist
+func writePolicy(policy string) error {
+	path := seccompPath(policy)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(seccompPolicies[policy]), 0644)
+}
+
+// SetSecurity writes confinement settings of the profile to the config of the container or template.
+// Empty AppArmor profile or seccomp policy leaves the current value, "none" in CapsDrop removes additional dropped capabilities.
+// Containers cloned from the template inherit its settings.
+func SetSecurity(name string, p Profile) error {
+	for _, c := range p.CapsDrop {
+		if c == "none" && len(p.CapsDrop) > 1 {
+			return errors.New("\"none\" can't be combined with capability names")
+		} else if c != "none" && !stringInList(c, capabilities) {
+			return errors.New("unknown capability " + c)
+		}
+	}
+	cfg, err := ReadConfig(config.Agent.LxcPrefix + name + "/config")
+	if err != nil {
+		return err
+	}
+	if p.AppArmor != "" {
+		if strings.ContainsAny(p.AppArmor, " \t") {
+			return errors.New("invalid AppArmor profile " + p.AppArmor)
+		}
+		if err = cfg.Set("lxc.aa_profile", p.AppArmor); err != nil {
+			return err
+		}
+	}
+	if p.Seccomp != "" {
+		path := p.Seccomp
+		if _, ok := seccompPolicies[p.Seccomp]; ok {
+			if err = writePolicy(p.Seccomp); err != nil {
+				return err
+			}
+			path = seccompPath(p.Seccomp)
+		} else if _, err = os.Stat(path); err != nil || !filepath.IsAbs(path) {
+			return errors.New("seccomp policy " + p.Seccomp + " not found")
+		}
+		if err = cfg.Set("lxc.seccomp", path); err != nil {
+			return err
+		}
+	}
+	if len(p.CapsDrop) > 0 {
+		cfg.Delete("lxc.cap.drop", "")
+		if p.CapsDrop[0] != "none" {
+			if err = cfg.Add("lxc.cap.drop", strings.Join(p.CapsDrop, " ")); err != nil {
+				return err
+			}
+		}
+	}
+	return cfg.Write()
+}
+
+// Security returns effective confinement settings of the container. The profile name is the name of the matching built-in profile,
+// "default" if nothing is set in the container config, so LXC defaults apply, or "custom" otherwise.
+func Security(name string) Profile {
+	path := config.Agent.LxcPrefix + name + "/config"
+	p := Profile{AppArmor: GetConfigItem(path, "lxc.aa_profile"), Seccomp: GetConfigItem(path, "lxc.seccomp")}
+	for _, caps := range ConfigItems(path, "lxc.cap.drop") {
+		p.CapsDrop = append(p.CapsDrop, strings.Fields(caps)...)
+	}
+	for policy := range seccompPolicies {
+		if p.Seccomp == seccompPath(policy) {
+			p.Seccomp = policy
+		}
+	}
+
+	p.Name = "custom"
+	if p.AppArmor == "" && p.Seccomp == "" && len(p.CapsDrop) == 0 {
+		p.Name = "default"
+	}
+	for n, b := range Profiles {
+		if p.AppArmor == b.AppArmor && p.Seccomp == b.Seccomp && strings.Join(p.CapsDrop, " ") == strings.Join(b.CapsDrop, " ") {
+			p.Name = n
+		}
+	}
+	return p
+}
+
+// restorePolicy recreates missing built-in seccomp policy file referenced by the container config, e.g. after template import on another host
+func restorePolicy(name string) error {
+	path := GetConfigItem(config.Agent.LxcPrefix+name+"/config", "lxc.seccomp")
+	for policy := range seccompPolicies {
+		if path == seccompPath(policy) {
+			return writePolicy(policy)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package container
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/subutai-io/agent/config"
+)
+
+var volumeName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// VolumePath returns host path of the named volume. Volumes are BTRFS subvolumes in the "volumes" directory of LXC prefix,
+// so they are not affected by destruction of containers using them.
+func VolumePath(name string) string {
+	return config.Agent.LxcPrefix + "volumes/" + name
+}
+
+// ValidVolume checks the volume name
+func ValidVolume(name string) error {
+	if !volumeName.MatchString(name) {
+		return errors.New("invalid volume name " + name + ", only letters, digits, dots, dashes and underscores are allowed")
+	}
+	return nil
+}
+
+// Volumes returns sorted list of the named volumes
+func Volumes() (list []string) {
+	files, _ := ioutil.ReadDir(config.Agent.LxcPrefix + "volumes")
+	for _, f := range files {
+		if f.IsDir() {
+			list = append(list, f.Name())
+		}
+	}
+	sort.Strings(list)
+	return
+}
+
+// IsVolume returns true if the named volume exists
+func IsVolume(name string) bool {
+	if ValidVolume(name) != nil {
+		return false
+	}
+	info, err := os.Stat(VolumePath(name))
+	return err == nil && info.IsDir()
+}
+
+// VolumeMounts returns container paths the volume is mounted to in each container and template using it
+func VolumeMounts(volume string) map[string][]string {
+	mounts := make(map[string][]string)
+	for _, name := range All() {
+		for target, src := range Mounts(name) {
+			if src == VolumePath(volume) {
+				mounts[name] = append(mounts[name], target)
+			}
+		}
+	}
+	return mounts
+}
+
+// AttachVolume adds bind mount entry of the volume to the container config, the mount point is created in the container if it doesn't exist.
+// If the volume root directory is still owned by host root, it is passed to the root of the container user namespace.
+// Containers sharing the volume must have the same uid base, attaching the volume to a container of other user namespace is refused.
+func AttachVolume(volume, name, path string, readonly bool) error {
+	target := filepath.Clean("/" + path)
+	if target == "/" || strings.ContainsAny(target, " \t") {
+		return errors.New("invalid mount point " + path)
+	}
+	if src, ok := Mounts(name)[target]; ok {
+		return errors.New(target + " is already mounted from " + src)
+	}
+	options := "bind,create=dir"
+	if readonly {
+		options += ",ro"
+	}
+
+	base := UIDBase(name)
+	for other := range VolumeMounts(volume) {
+		if other != name && UIDBase(other) != base {
+			return errors.New("volume " + volume + " is used by " + other + ", which has different uid base")
+		}
+	}
+	if info, err := os.Stat(VolumePath(volume)); err != nil {
+		return err
+	} else if st, ok := info.Sys().(*syscall.Stat_t); ok && st.Uid == 0 {
+		if base > 0 {
+			if err = os.Chown(VolumePath(volume), base, base); err != nil {
+				return err
+			}
+		}
+	} else if ok && st.Uid >= 65536 && (int(st.Uid) < base || int(st.Uid) >= base+65536) {
+		return errors.New("volume " + volume + " belongs to other user namespace")
+	}
+
+	cfg, err := ReadConfig(config.Agent.LxcPrefix + name + "/config")
+	if err != nil {
+		return err
+	}
+	if err = cfg.Add("lxc.mount.entry", VolumePath(volume)+" "+strings.TrimPrefix(target, "/")+" none "+options+" 0 0"); err != nil {
+		return err
+	}
+	return cfg.Write()
+}
+
+// DetachVolume removes all bind mount entries of the volume from the container config, it returns false if the volume was not attached
+func DetachVolume(volume, name string) (bool, error) {
+	cfg, err := ReadConfig(config.Agent.LxcPrefix + name + "/config")
+	if err != nil {
+		return false, err
+	}
+	found := false
+	for _, entry := range cfg.Values("lxc.mount.entry") {
+		if fields := strings.Fields(entry); len(fields) > 0 && filepath.Clean(fields[0]) == VolumePath(volume) {
+			found = cfg.Delete("lxc.mount.entry", entry) || found
+		}
+	}
+	if !found {
+		return false, nil
+	}
+	return true, cfg.Write()
+}
@@ -0,0 +1,113 @@
+// Package event records container events in the agent database and provides them to CLI and heartbeat
+package event
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/subutai-io/agent/db"
+	"github.com/subutai-io/agent/log"
+)
+
+// Event types.
+const (
+	OOM      = "oom"
+	Throttle = "throttle"
+	Start    = "start"
+	Stop     = "stop"
+	Freeze   = "freeze"
+	Unfreeze = "unfreeze"
+	Clone    = "clone"
+	Destroy  = "destroy"
+	Restore  = "restore"
+	Expire   = "expire"
+)
+
+// History is the number of the latest events kept in the database.
+const History = 10000
+
+// Batch is the maximum number of events delivered to the Management server in one heartbeat.
+const Batch = 100
+
+// Event describes something that happened to the container.
+type Event struct {
+	ID        uint64    `json:"id"`
+	Container string    `json:"container"`
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Details   string    `json:"details,omitempty"`
+}
+
+// Add records event of the container with current time.
+func Add(name, kind, details string) {
+	bolt, err := db.New()
+	if log.Check(log.WarnLevel, "Opening database", err) {
+		return
+	}
+	defer bolt.Close()
+	id, err := bolt.EventAdd(map[string]string{
+		"container": name,
+		"time":      time.Now().Format(time.RFC3339Nano),
+		"type":      kind,
+		"details":   details,
+	})
+	if !log.Check(log.WarnLevel, "Recording "+kind+" event of "+name, err) && id > History {
+		log.Check(log.WarnLevel, "Removing old events", bolt.EventTrim(id-History+1))
+	}
+}
+
+// Last returns id of the last recorded event.
+func Last() uint64 {
+	bolt, err := db.New()
+	if log.Check(log.WarnLevel, "Opening database", err) {
+		return 0
+	}
+	defer bolt.Close()
+	return bolt.EventLast()
+}
+
+// List returns events of the container recorded after the id, empty name returns events of all containers.
+func List(name string, after uint64) (list []Event) {
+	bolt, err := db.New()
+	if log.Check(log.WarnLevel, "Opening database", err) {
+		return
+	}
+	defer bolt.Close()
+	for _, item := range bolt.Events(name, after, 0) {
+		list = append(list, parse(item))
+	}
+	return
+}
+
+// Pending returns up to Batch oldest events which were not delivered to the Management server yet,
+// so the backlog accumulated while the server was unreachable is delivered in chunks over several heartbeats.
+func Pending() (list []Event) {
+	bolt, err := db.New()
+	if log.Check(log.WarnLevel, "Opening database", err) {
+		return
+	}
+	defer bolt.Close()
+	for _, item := range bolt.Events("", bolt.EventCursor(), Batch) {
+		list = append(list, parse(item))
+	}
+	return
+}
+
+// Delivered marks events up to the last one in the list as delivered to the Management server.
+func Delivered(list []Event) {
+	if len(list) == 0 {
+		return
+	}
+	bolt, err := db.New()
+	if log.Check(log.WarnLevel, "Opening database", err) {
+		return
+	}
+	defer bolt.Close()
+	log.Check(log.WarnLevel, "Saving delivered events", bolt.EventDelivered(list[len(list)-1].ID))
+}
+
+func parse(item map[string]string) Event {
+	id, _ := strconv.ParseUint(item["id"], 10, 64)
+	t, _ := time.Parse(time.RFC3339Nano, item["time"])
+	return Event{ID: id, Container: item["container"], Time: t, Type: item["type"], Details: item["details"]}
+}
@@ -4,11 +4,13 @@ package fs
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/subutai-io/agent/config"
 	"github.com/subutai-io/agent/log"
@@ -65,6 +67,20 @@ func SubvolumeClone(src, dst string) {
 	log.Check(log.FatalLevel, "Creating snapshot: "+string(out), err)
 }
 
+// Snapshot creates snapshot of the BTRFS subvolume like SubvolumeClone, but returns an error instead of exiting on failure.
+// Readonly flag creates read-only snapshot.
+func Snapshot(src, dst string, readonly bool) error {
+	args := []string{"subvolume", "snapshot", src, dst}
+	if readonly {
+		args = []string{"subvolume", "snapshot", "-r", src, dst}
+	}
+	out, err := exec.Command("btrfs", args...).CombinedOutput()
+	if err != nil {
+		return errors.New("creating snapshot " + dst + ": " + strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
 // SubvolumeDestroy deletes BTRFS subvolume and all subdirectories.
 // It also destroys quota groups.
 func SubvolumeDestroy(path string) {
@@ -171,6 +187,44 @@ func Stat(path, index string, raw bool) (value string) {
 	return value
 }
 
+// Usage returns exclusive disk usage and limit in bytes of all subvolumes under LxcPrefix, keyed by subvolume path relative to LxcPrefix.
+// Values of level 1 quota group are returned for container subvolumes, so they include all container volumes. Zero limit means no limit.
+func Usage() map[string][]int {
+	usage := make(map[string][]int)
+	out, err := exec.Command("btrfs", "subvolume", "list", config.Agent.LxcPrefix).Output()
+	if log.Check(log.DebugLevel, "Getting BTRFS subvolume list", err) {
+		return usage
+	}
+	paths := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if line := strings.Fields(scanner.Text()); len(line) > 8 {
+			paths[line[1]] = line[8]
+		}
+	}
+
+	out, err = exec.Command("btrfs", "qgroup", "show", "-re", "--raw", config.Agent.LxcPrefix).Output()
+	if log.Check(log.DebugLevel, "Getting btrfs stats", err) {
+		return usage
+	}
+	scanner = bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.Fields(scanner.Text())
+		if len(line) < 4 {
+			continue
+		}
+		group := strings.SplitN(line[0], "/", 2)
+		path, ok := paths[group[len(group)-1]]
+		if !ok || (group[0] == "0" && usage[path] != nil) {
+			continue
+		}
+		used, _ := strconv.Atoi(line[2])
+		limit, _ := strconv.Atoi(line[3])
+		usage[path] = []int{used, limit}
+	}
+	return usage
+}
+
 // DiskQuota returns total disk quota for Subutai container.
 // If size argument is set, it sets new quota value.
 func DiskQuota(path string, size ...string) string {
@@ -182,9 +236,7 @@ func DiskQuota(path string, size ...string) string {
 	exec.Command("btrfs", "qgroup", "assign", "0/"+id(path+"/rootfs"), "1/"+parent, config.Agent.LxcPrefix+path).Run()
 
 	if len(size) > 0 && len(size[0]) > 0 {
-		out, err := exec.Command("btrfs", "qgroup", "limit", size[0]+"G", "1/"+parent, config.Agent.LxcPrefix+path).CombinedOutput()
-		log.Check(log.ErrorLevel, "Limiting BTRFS group 1/"+parent+" "+string(out), err)
-		exec.Command("btrfs", "quota", "rescan", "-w", config.Agent.LxcPrefix).Run()
+		log.Check(log.ErrorLevel, "Limiting BTRFS group 1/"+parent, LimitDisk(path, size[0]))
 	}
 	return Stat(path, "quota", false)
 }
@@ -193,16 +245,62 @@ func DiskQuota(path string, size ...string) string {
 // If size argument is set, it sets new quota value.
 func Quota(path string, size ...string) string {
 	if len(size) > 0 && len(size[0]) > 0 {
-		out, err := exec.Command("btrfs", "qgroup", "limit", size[0]+"G", config.Agent.LxcPrefix+path).CombinedOutput()
-		log.Check(log.ErrorLevel, "Limiting BTRFS subvolume "+config.Agent.LxcPrefix+path+" "+string(out), err)
-		exec.Command("btrfs", "quota", "rescan", "-w", config.Agent.LxcPrefix).Run()
+		log.Check(log.ErrorLevel, "Limiting BTRFS subvolume "+config.Agent.LxcPrefix+path, LimitVolume(path, size[0]))
 	}
 	return Stat(path, "quota", false)
 }
 
+// LimitDisk sets total disk quota of the container in Gb, "none" removes the limit.
+// Unlike DiskQuota it returns error instead of exiting, and the container quota group should already exist.
+func LimitDisk(path, size string) error {
+	return limit(size, "1/"+id(path), config.Agent.LxcPrefix+path)
+}
+
+// LimitVolume sets quota of the subvolume in Gb, "none" removes the limit.
+func LimitVolume(path, size string) error {
+	return limit(size, config.Agent.LxcPrefix+path)
+}
+
+func limit(size string, args ...string) error {
+	if size != "none" {
+		size += "G"
+	}
+	out, err := exec.Command("btrfs", append([]string{"qgroup", "limit", size}, args...)...).CombinedOutput()
+	if err != nil {
+		return errors.New(strings.TrimSpace(err.Error() + " " + string(out)))
+	}
+	exec.Command("btrfs", "quota", "rescan", "-w", config.Agent.LxcPrefix).Run()
+	return nil
+}
+
 // GetBtrfsRoot returns BTRFS root
 func GetBtrfsRoot() string {
 	data, err := exec.Command("findmnt", "-nT", config.Agent.LxcPrefix).Output()
 	log.Check(log.FatalLevel, "Searching btrfs mount point", err)
 	return strings.Fields(string(data))[0] + "/"
 }
+
+// Device returns "major:minor" number of the block device holding containers, used to set block I/O limits.
+// If containers are placed on a partition, the number of the whole disk is returned.
+func Device() (string, error) {
+	out, err := exec.Command("findmnt", "-nvo", "SOURCE", "-T", config.Agent.LxcPrefix).Output()
+	if err != nil {
+		return "", err
+	}
+	dev := strings.TrimSpace(string(out))
+	if disk, err := exec.Command("lsblk", "-no", "PKNAME", dev).Output(); err == nil && len(strings.TrimSpace(string(disk))) > 0 {
+		dev = "/dev/" + strings.Fields(string(disk))[0]
+	}
+	info, err := os.Stat(dev)
+	if err != nil {
+		return "", err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || info.Mode()&os.ModeDevice == 0 {
+		return "", errors.New(dev + " is not a block device")
+	}
+	rdev := uint64(stat.Rdev)
+	major := (rdev>>8)&0xfff | (rdev>>32)&^0xfff
+	minor := rdev&0xff | (rdev>>12)&^0xff
+	return strconv.FormatUint(major, 10) + ":" + strconv.FormatUint(minor, 10), nil
+}
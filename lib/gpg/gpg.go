@@ -5,6 +5,8 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -147,6 +149,21 @@ func GenerateKey(name string) {
 	}
 }
 
+// RenameKey replaces user id of the Subutai container GPG key with the one issued for the new container name.
+// The key files are taken from the directory, the key itself and its fingerprint stay the same.
+func RenameKey(dir, old, name string) error {
+	cmd := exec.Command("gpg", "--batch", "--no-tty", "--yes", "--command-fd", "0", "--passphrase", config.Agent.GpgPassword,
+		"--no-default-keyring", "--keyring", dir+"/public.pub", "--secret-keyring", dir+"/secret.sec",
+		"--edit-key", old+"@subutai.io", "adduid")
+	// answers to adduid prompts, then the old user id is selected and deleted
+	cmd.Stdin = strings.NewReader(name + "\n" + name + "@subutai.io\n" + name + " GPG key\nuid 1\ndeluid\ny\nsave\n")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.New(strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
 // GetFingerprint returns fingerprint of the Subutai container.
 func GetFingerprint(email string) string {
 	var out []byte
@@ -296,6 +313,22 @@ func KurjunUserPK(owner string) []string {
 	return nil
 }
 
+// KeyInfo returns fingerprint and user identity of the armored public key.
+func KeyInfo(key string) (fingerprint, identity string, err error) {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewBufferString(key))
+	if err != nil {
+		return "", "", err
+	}
+	if len(entities) == 0 || entities[0].PrimaryKey == nil {
+		return "", "", errors.New("no public key found")
+	}
+	for name := range entities[0].Identities {
+		identity = name
+		break
+	}
+	return fmt.Sprintf("%X", entities[0].PrimaryKey.Fingerprint), identity, nil
+}
+
 // VerifySignature check if signature retrieved from Kurjun is valid.
 func VerifySignature(key, signature string) string {
 	entity, err := openpgp.ReadArmoredKeyRing(bytes.NewBufferString(key))
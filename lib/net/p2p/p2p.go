@@ -114,3 +114,26 @@ func Interfaces() (list []net.Interface, err error) {
 	}
 	return list, nil
 }
+
+// Instance describes P2P instance running on the Resource Host.
+type Instance struct {
+	Mac  string `json:"mac"`
+	IP   string `json:"ip"`
+	Hash string `json:"hash"`
+}
+
+// List returns P2P instances running on the Resource Host
+func List() (list []Instance, err error) {
+	out, err := exec.Command("p2p", "show").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if line := strings.Fields(scanner.Text()); len(line) > 2 {
+			list = append(list, Instance{Mac: line[0], IP: line[1], Hash: line[2]})
+		}
+	}
+	return list, nil
+}
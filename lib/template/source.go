@@ -0,0 +1,334 @@
+package template
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mcuadros/go-version"
+
+	"github.com/subutai-io/agent/agent/utils"
+	"github.com/subutai-io/agent/config"
+)
+
+// ErrNotFound is returned by template sources which don't have the requested template
+var ErrNotFound = errors.New("template not found")
+
+// Meta is the template metadata in the format of Kurjun /template/info response
+type Meta struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Owner   []string          `json:"owner"`
+	Version string            `json:"version"`
+	File    string            `json:"filename"`
+	Size    int64             `json:"size"`
+	Signs   map[string]string `json:"signature"`
+	Hash    struct {
+		Md5    string `json:"md5"`
+		Sha256 string `json:"sha256"`
+	} `json:"hash"`
+}
+
+// Source is a repository templates are imported from
+type Source interface {
+	// String returns the source as it is written in the agent config
+	String() string
+	// Info returns metadata of the template with the id, or of the template matching name, owner and version.
+	// Empty owner selects verified templates, empty version selects the latest one.
+	Info(id, name, owner, version, token string) (Meta, error)
+	// Open returns reader of the template archive and its size, -1 if unknown
+	Open(m Meta, token string) (io.ReadCloser, int64, error)
+}
+
+// Sources returns template sources in the order they are listed in "sources" option of [template] section of the agent config.
+// Supported sources are:
+//	cdn, the Kurjun repository configured in [cdn] section
+//	kurjun:<url>, other Kurjun compatible repository, e.g. kurjun:https://peer:8338/kurjun/rest for template registry of a peer
+//	http://host/path or https://host/path, plain HTTP mirror with index.json file
+//	/path or file:///path, local or NFS directory with index.json file
+// Invalid entries are skipped.
+func Sources() (list []Source) {
+	for _, s := range strings.Split(config.Template.Sources, ",") {
+		if src, err := ParseSource(strings.TrimSpace(s)); err == nil {
+			list = append(list, src)
+		}
+	}
+	if len(list) == 0 {
+		list = append(list, kurjun{name: "cdn", url: config.CDN.Kurjun})
+	}
+	return list
+}
+
+// ParseSource returns template source described by the config entry
+func ParseSource(s string) (Source, error) {
+	switch {
+	case s == "cdn":
+		return kurjun{name: s, url: config.CDN.Kurjun}, nil
+	case strings.HasPrefix(s, "kurjun:"):
+		return kurjun{name: s, url: strings.TrimSuffix(strings.TrimPrefix(s, "kurjun:"), "/")}, nil
+	case strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://"):
+		return mirror{url: strings.TrimSuffix(s, "/")}, nil
+	case strings.HasPrefix(s, "file://"):
+		return directory{path: filepath.Clean(strings.TrimPrefix(s, "file://"))}, nil
+	case filepath.IsAbs(s):
+		return directory{path: filepath.Clean(s)}, nil
+	}
+	return nil, errors.New("unknown template source " + s)
+}
+
+// CDNKeys returns public GPG keys of the template owner published on the CDN. Sources other than the CDN don't provide owner keys,
+// since the source serving the template must not supply the key verifying it.
+func CDNKeys(owner string) ([]string, error) {
+	return kurjun{name: "cdn", url: config.CDN.Kurjun}.Keys(owner)
+}
+
+// Trusted returns true if the source is listed in "trusted" option of [template] section of the agent config.
+// Signatures of templates from trusted sources are not verified unless signature policy is "enforce", hash sums of archives are checked anyway.
+func Trusted(src Source) bool {
+	for _, s := range strings.Split(config.Template.Trusted, ",") {
+		if trusted, err := ParseSource(strings.TrimSpace(s)); err == nil && trusted.String() == src.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// Sort orders the template list by name, owner and version, latest versions first
+func Sort(list []Meta) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		if Owner(list[i]) != Owner(list[j]) {
+			return Owner(list[i]) < Owner(list[j])
+		}
+		return version.Compare(list[i].Version, list[j].Version, ">")
+	})
+}
+
+// Verified filters the template list by owners listed in "verified" option of [template] section of the agent config.
+// It is applied to the lookups without owner in the sources which don't mark verified templates themselves, so a mirror can't substitute
+// a template of arbitrary owner for the verified one.
+func Verified(list []Meta) (result []Meta) {
+	owners := strings.Split(config.Template.Verified, ",")
+	for i := range owners {
+		owners[i] = strings.TrimSpace(owners[i])
+	}
+	for _, m := range list {
+		if owner := Owner(m); owner != "" && stringInList(owner, owners) {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// Match filters the template list by the query and sorts it.
+// Empty fields match any value, empty or "latest" version selects the latest version of each owner's template.
+func Match(list []Meta, id, name, owner, ver string) (result []Meta) {
+	Sort(list)
+	seen := make(map[string]bool)
+	for _, m := range list {
+		if id != "" && m.ID != id || name != "" && m.Name != name || owner != "" && !stringInList(owner, m.Owner) {
+			continue
+		}
+		if id == "" && (ver == "" || ver == "latest") {
+			if key := m.Name + "@" + Owner(m); !seen[key] {
+				seen[key] = true
+				result = append(result, m)
+			}
+		} else if id != "" || m.Version == ver {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// Owner returns the first owner of the template
+func Owner(m Meta) string {
+	if len(m.Owner) == 0 {
+		return ""
+	}
+	return m.Owner[0]
+}
+
+// kurjun is Kurjun REST API of the CDN or of the template registry of a peer
+type kurjun struct {
+	name string
+	url  string
+}
+
+func (k kurjun) String() string {
+	return k.name
+}
+
+// credential returns the token for the CDN only, the CDN token must not be sent to the registries of the other peers
+func (k kurjun) credential(token string) string {
+	if k.name != "cdn" {
+		return ""
+	}
+	return token
+}
+
+func (k kurjun) Info(id, name, owner, ver, token string) (Meta, error) {
+	token = k.credential(token)
+	address := k.url + "/template/info?"
+	if id != "" {
+		address += "id=" + id
+	} else {
+		address += "name=" + name
+		if owner != "" {
+			address += "&owner=" + owner
+		} else if token == "" {
+			address += "&verified=true"
+		}
+		if ver == "" {
+			ver = "latest"
+		}
+		address += "&version=" + ver
+	}
+	if token != "" {
+		address += "&token=" + token
+	}
+
+	body, err := get(address, utils.GetClient(config.CDN.Allowinsecure, 15))
+	if err != nil {
+		return Meta{}, err
+	}
+	var list []Meta
+	if err = json.Unmarshal(body, &list); err != nil {
+		return Meta{}, err
+	}
+	if len(list) == 0 {
+		return Meta{}, ErrNotFound
+	}
+	return list[0], nil
+}
+
+func (k kurjun) Keys(owner string) ([]string, error) {
+	body, err := get(k.url+"/auth/keys?user="+owner, utils.GetClient(config.CDN.Allowinsecure, 15))
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	return keys, json.Unmarshal(body, &keys)
+}
+
+func (k kurjun) Open(m Meta, token string) (io.ReadCloser, int64, error) {
+	address := k.url + "/template/download?id=" + m.ID
+	if token = k.credential(token); token != "" {
+		address += "&token=" + token
+	}
+	return open(address, utils.GetClientForUploadDownload())
+}
+
+// mirror is a plain HTTP server with index.json file listing metadata of the templates, archives are located next to the index
+type mirror struct {
+	url string
+}
+
+func (m mirror) String() string {
+	return m.url
+}
+
+func (m mirror) Info(id, name, owner, ver, token string) (Meta, error) {
+	body, err := get(m.url+"/index.json", utils.GetClient(config.CDN.Allowinsecure, 15))
+	if err != nil {
+		return Meta{}, err
+	}
+	return find(body, id, name, owner, ver)
+}
+
+func (m mirror) Open(t Meta, token string) (io.ReadCloser, int64, error) {
+	return open(m.url+"/"+t.File, utils.GetClientForUploadDownload())
+}
+
+// directory is a local or NFS mounted directory with the same layout as the HTTP mirror
+type directory struct {
+	path string
+}
+
+func (d directory) String() string {
+	return d.path
+}
+
+func (d directory) Info(id, name, owner, ver, token string) (Meta, error) {
+	body, err := ioutil.ReadFile(filepath.Join(d.path, "index.json"))
+	if err != nil {
+		return Meta{}, err
+	}
+	return find(body, id, name, owner, ver)
+}
+
+func (d directory) Open(m Meta, token string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(filepath.Join(d.path, filepath.Base(m.File)))
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// find looks for the template in the index, templates without id are identified by MD5 hash sum of the archive.
+// Lookups by name without owner select templates of the verified owners only.
+func find(index []byte, id, name, owner, ver string) (Meta, error) {
+	var list []Meta
+	if err := json.Unmarshal(index, &list); err != nil {
+		return Meta{}, err
+	}
+	for i := range list {
+		if list[i].ID == "" {
+			list[i].ID = list[i].Hash.Md5
+		}
+	}
+	if id == "" && owner == "" {
+		list = Verified(list)
+	}
+	if found := Match(list, id, name, owner, ver); len(found) > 0 {
+		return found[0], nil
+	}
+	return Meta{}, ErrNotFound
+}
+
+func get(url string, client *http.Client) ([]byte, error) {
+	body, _, err := open(url, client)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
+
+func open(url string, client *http.Client) (io.ReadCloser, int64, error) {
+	response, err := client.Get(url)
+	if err != nil {
+		return nil, 0, err
+	}
+	if response.StatusCode == http.StatusNotFound {
+		utils.Close(response)
+		return nil, 0, ErrNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		utils.Close(response)
+		return nil, 0, errors.New(response.Status)
+	}
+	return response.Body, response.ContentLength, nil
+}
+
+func stringInList(s string, list []string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package template
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/db"
+	"github.com/subutai-io/agent/lib/gpg"
+	"github.com/subutai-io/agent/log"
+)
+
+// Signature policies, set by "policy" option of [template] section of the agent config:
+//	off, template signatures are not checked
+//	warn, unsigned templates and invalid signatures are reported as warnings only;
+//	keys published on the CDN are used for owners missing in the trust store
+//	verify, the default, unsigned templates and invalid signatures are refused; keys published on the CDN are used for owners missing in the trust store
+//	enforce, templates must be signed by the owner key from the trust store, other templates are refused at import and clone
+const (
+	PolicyOff     = "off"
+	PolicyWarn    = "warn"
+	PolicyVerify  = "verify"
+	PolicyEnforce = "enforce"
+)
+
+// Key is the public GPG key of the template owner saved in the trust store
+type Key struct {
+	Owner       string `json:"owner"`
+	Fingerprint string `json:"fingerprint"`
+	Identity    string `json:"identity"`
+	Key         string `json:"-"`
+}
+
+// Policy returns configured signature policy, unknown values are treated as "verify"
+func Policy() string {
+	switch p := strings.ToLower(strings.TrimSpace(config.Template.Policy)); p {
+	case PolicyOff, PolicyWarn, PolicyVerify, PolicyEnforce:
+		return p
+	case "":
+	default:
+		log.Warn("Unknown template signature policy " + p + ", using " + PolicyVerify)
+	}
+	return PolicyVerify
+}
+
+// TrustedKeys returns public keys of the template owner from the trust store sorted by fingerprint
+func TrustedKeys(owner string) (list []Key) {
+	bolt, err := db.New()
+	if log.Check(log.WarnLevel, "Opening database", err) {
+		return nil
+	}
+	keys := bolt.TrustKeys(owner)
+	log.Check(log.WarnLevel, "Closing database", bolt.Close())
+
+	for fingerprint, key := range keys {
+		_, identity, _ := gpg.KeyInfo(key)
+		list = append(list, Key{Owner: owner, Fingerprint: fingerprint, Identity: identity, Key: key})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Fingerprint < list[j].Fingerprint })
+	return list
+}
+
+// TrustedOwners returns sorted list of template owners having keys in the trust store
+func TrustedOwners() []string {
+	bolt, err := db.New()
+	if log.Check(log.WarnLevel, "Opening database", err) {
+		return nil
+	}
+	defer bolt.Close()
+	list := bolt.TrustOwners()
+	sort.Strings(list)
+	return list
+}
+
+// Trust adds armored public key of the template owner to the trust store and returns its description
+func Trust(owner, key string) (Key, error) {
+	if owner == "" || strings.ContainsAny(owner, "/\\ ") {
+		return Key{}, errors.New("invalid owner " + owner)
+	}
+	fingerprint, identity, err := gpg.KeyInfo(key)
+	if err != nil {
+		return Key{}, err
+	}
+	bolt, err := db.New()
+	if err != nil {
+		return Key{}, err
+	}
+	defer bolt.Close()
+	return Key{Owner: owner, Fingerprint: fingerprint, Identity: identity, Key: key}, bolt.TrustAdd(owner, fingerprint, key)
+}
+
+// Untrust removes the owner key with the fingerprint from the trust store, empty fingerprint removes all keys of the owner.
+// It returns the number of removed keys.
+func Untrust(owner, fingerprint string) (int, error) {
+	bolt, err := db.New()
+	if err != nil {
+		return 0, err
+	}
+	defer bolt.Close()
+	return bolt.TrustDel(owner, strings.ToUpper(strings.Replace(fingerprint, " ", "", -1)))
+}
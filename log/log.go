@@ -2,9 +2,12 @@
 package log
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/syslog"
 	"os"
+	"strconv"
 
 	"github.com/Sirupsen/logrus"
 )
@@ -24,11 +27,33 @@ var (
 	PanicLevel = logrus.PanicLevel
 )
 
+// Exit codes returned by the CLI on errors.
+const (
+	// ExitFailure is a generic failure of the requested operation.
+	ExitFailure = 1
+	// ExitUsage means wrong command arguments or options.
+	ExitUsage = 2
+	// ExitNotFound means that requested container, template or other object does not exist.
+	ExitNotFound = 3
+	// ExitExists means that object with the same name or socket already exists.
+	ExitExists = 4
+	// ExitPermission means that command cannot be run with current permissions.
+	ExitPermission = 5
+)
+
 var (
 	syslogServer string
 	appName      string
+	structured   string
+	recovering   bool
 )
 
+// failure carries exit code and message of the fatal error raised inside Recover
+type failure struct {
+	code    int
+	message string
+}
+
 func init() {
 	format := new(logrus.TextFormatter)
 	format.FullTimestamp = true
@@ -76,6 +101,14 @@ func Panic(msg ...interface{}) {
 
 // Fatal stops process after showing fatal message.
 func Fatal(msg ...interface{}) {
+	if recovering {
+		sendSyslog(syslog.LOG_CRIT, msg...)
+		panic(failure{ExitFailure, fmt.Sprint(msg...)})
+	}
+	if printStructured(ExitFailure, msg...) {
+		sendSyslog(syslog.LOG_CRIT, msg...)
+		os.Exit(ExitFailure)
+	}
 	logrus.SetOutput(os.Stderr)
 	logrus.Fatal(msg...)
 	sendSyslog(syslog.LOG_CRIT, msg...)
@@ -83,10 +116,40 @@ func Fatal(msg ...interface{}) {
 
 // Error stops process after showing error message.
 func Error(msg ...interface{}) {
+	ErrorCode(ExitFailure, msg...)
+}
+
+// ErrorCode stops process with specified exit code after showing error message.
+func ErrorCode(code int, msg ...interface{}) {
+	sendSyslog(syslog.LOG_ERR, msg...)
+	if recovering {
+		panic(failure{code, fmt.Sprint(msg...)})
+	}
+	if printStructured(code, msg...) {
+		os.Exit(code)
+	}
 	logrus.SetOutput(os.Stderr)
 	logrus.Error(msg...)
-	sendSyslog(syslog.LOG_ERR, msg...)
-	os.Exit(1)
+	os.Exit(code)
+}
+
+// Recover runs fn, returning exit code and message of the fatal error instead of stopping the process.
+// Commands acting on a group of containers use it, so failure of one container doesn't abort the rest of the group.
+func Recover(fn func()) (code int, err error) {
+	previous := recovering
+	recovering = true
+	defer func() {
+		recovering = previous
+		if r := recover(); r != nil {
+			f, ok := r.(failure)
+			if !ok {
+				panic(r)
+			}
+			code, err = f.code, errors.New(f.message)
+		}
+	}()
+	fn()
+	return 0, nil
 }
 
 // Warn keeps process working after showing warning message.
@@ -119,3 +182,32 @@ func ActivateSyslog(socket, app string) {
 	syslogServer = socket
 	appName = app
 }
+
+// Structured switches error messages to {code, message} objects in json or yaml format, empty format restores plain text messages.
+// Log messages are written to stderr in structured mode, so they don't corrupt the output.
+func Structured(format string) {
+	structured = format
+	if format != "" {
+		logrus.SetOutput(os.Stderr)
+	} else {
+		logrus.SetOutput(os.Stdout)
+	}
+}
+
+// printStructured writes error object to stderr if structured output is enabled
+func printStructured(code int, msg ...interface{}) bool {
+	message := fmt.Sprint(msg...)
+	switch structured {
+	case "json":
+		out, _ := json.Marshal(struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}{code, message})
+		fmt.Fprintln(os.Stderr, string(out))
+	case "yaml":
+		fmt.Fprintf(os.Stderr, "code: %d\nmessage: %s\n", code, strconv.Quote(message))
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,26 @@
+package log
+
+import "testing"
+
+func TestRecover(t *testing.T) {
+	code, err := Recover(func() { ErrorCode(ExitNotFound, "foo is not a container") })
+	if code != ExitNotFound || err == nil || err.Error() != "foo is not a container" {
+		t.Errorf("Recover() = %d, %v", code, err)
+	}
+
+	code, err = Recover(func() { Check(FatalLevel, "Cloning volume", errTest("busy")) })
+	if code != ExitFailure || err == nil || err.Error() != "Cloning volume, busy" {
+		t.Errorf("Recover() = %d, %v", code, err)
+	}
+
+	if code, err = Recover(func() {}); code != 0 || err != nil {
+		t.Errorf("Recover() = %d, %v", code, err)
+	}
+	if recovering {
+		t.Error("Recover() left fatal errors recoverable")
+	}
+}
+
+type errTest string
+
+func (e errTest) Error() string { return string(e) }
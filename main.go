@@ -4,6 +4,7 @@
 package main
 
 import (
+	"flag"
 	"os"
 
 	"github.com/subutai-io/agent/agent"
@@ -19,7 +20,7 @@ var version = "unknown"
 
 func init() {
 	if os.Getuid() != 0 {
-		log.Error("Please run as root")
+		log.ErrorCode(log.ExitPermission, "Please run as root")
 	}
 	os.Setenv("PATH", "/apps/subutai/current/bin:"+os.Getenv("PATH"))
 	log.ActivateSyslog("127.0.0.1:1514", "cli")
@@ -51,7 +52,15 @@ func main() {
 
 	app.Flags = []gcli.Flag{gcli.BoolFlag{
 		Name:  "d",
-		Usage: "debug mode"}}
+		Usage: "debug mode"}, gcli.StringFlag{
+		Name:  "format",
+		Value: "table",
+		Usage: "output format (table|json|yaml)"}}
+
+	app.Before = func(c *gcli.Context) error {
+		cli.SetFormat(c.GlobalString("format"))
+		return nil
+	}
 
 	app.Commands = []gcli.Command{{
 		Name: "attach", Usage: "attach to Subutai container",
@@ -67,9 +76,14 @@ func main() {
 		Name: "backup", Usage: "backup Subutai container",
 		Flags: []gcli.Flag{
 			gcli.BoolFlag{Name: "full, f", Usage: "make full backup"},
-			gcli.BoolFlag{Name: "stop, s", Usage: "stop container at the time of backup"}},
+			gcli.BoolFlag{Name: "stop, s", Usage: "stop container at the time of backup"},
+			gcli.StringFlag{Name: "selector", Usage: "backup containers with matching key=value labels"}},
 		Action: func(c *gcli.Context) error {
-			if c.Args().Get(0) != "" {
+			if c.String("selector") != "" {
+				cli.ForSelected(c.String("selector"), "backup", func(name string) {
+					cli.BackupContainer(name, c.Bool("f"), c.Bool("s"))
+				})
+			} else if c.Args().Get(0) != "" {
 				cli.BackupContainer(c.Args().Get(0), c.Bool("f"), c.Bool("s"))
 			} else {
 				gcli.ShowSubcommandHelp(c)
@@ -89,6 +103,20 @@ func main() {
 			return nil
 		}}, {
 
+		Name: "boot", Usage: "configure Subutai container start dependencies",
+		Flags: []gcli.Flag{
+			gcli.StringFlag{Name: "order, o", Usage: "start priority, lower values start first"},
+			gcli.StringFlag{Name: "after, a", Usage: "comma separated containers to start before this one"},
+			gcli.StringFlag{Name: "delay, d", Usage: "seconds to wait after start before starting dependent containers"}},
+		Action: func(c *gcli.Context) error {
+			if c.Args().Get(0) != "" {
+				cli.LxcBoot(c.Args().Get(0), c.String("o"), c.String("a"), c.String("d"))
+			} else {
+				gcli.ShowSubcommandHelp(c)
+			}
+			return nil
+		}}, {
+
 		Name: "checkpoint", Usage: "chekpoint/restore in user space",
 		Flags: []gcli.Flag{
 			gcli.BoolFlag{Name: "stop, s", Usage: "Stop container during checkpoint"},
@@ -107,10 +135,14 @@ func main() {
 			gcli.StringFlag{Name: "env, e", Usage: "set environment id for container"},
 			gcli.StringFlag{Name: "ipaddr, i", Usage: "set container IP address and VLAN"},
 			gcli.StringFlag{Name: "token, t", Usage: "CDN token to clone private and shared templates"},
-			gcli.StringFlag{Name: "secret, s", Usage: "Console secret"}},
+			gcli.StringFlag{Name: "secret, s", Usage: "Console secret"},
+			gcli.StringFlag{Name: "profile, p", Usage: "apply quota profile to container"},
+			gcli.StringFlag{Name: "ttl", Usage: "destroy container after lifetime, e.g. 30m, 2h or 1d"},
+			gcli.BoolFlag{Name: "ephemeral", Usage: "destroy container when it stops"},
+			gcli.StringSliceFlag{Name: "label, l", Usage: "set key=value label for container"}},
 		Action: func(c *gcli.Context) error {
 			if c.Args().Get(0) != "" && c.Args().Get(1) != "" {
-				cli.LxcClone(c.Args().Get(0), c.Args().Get(1), c.String("e"), c.String("i"), c.String("s"), c.String("t"))
+				cli.LxcClone(c.Args().Get(0), c.Args().Get(1), c.String("e"), c.String("i"), c.String("s"), c.String("t"), c.String("p"), c.String("ttl"), c.Bool("ephemeral"), c.StringSlice("l"))
 			} else {
 				gcli.ShowSubcommandHelp(c)
 			}
@@ -143,9 +175,31 @@ func main() {
 			gcli.StringFlag{Name: "key, k", Usage: "configuration key"},
 			gcli.StringFlag{Name: "value, v", Usage: "configuration value"},
 		},
+		Subcommands: []gcli.Command{
+			{
+				Name:  "migrate",
+				Usage: "convert configs of the containers and templates to the format of the installed LXC: migrate [names]",
+				Action: func(c *gcli.Context) error {
+					cli.ConfigMigrate(c.Args())
+					return nil
+				}},
+		},
 		Action: func(c *gcli.Context) error {
-			if c.Args().Get(0) != "" {
-				cli.LxcConfig(c.Args().Get(0), c.String("o"), c.String("k"), c.String("v"))
+			if name := c.Args().Get(0); name != "" {
+				c = tailFlags(c, "o", "k", "v")
+				cli.LxcConfig(name, c.String("o"), c.String("k"), c.String("v"))
+			} else {
+				gcli.ShowSubcommandHelp(c)
+			}
+			return nil
+		}}, {
+
+		Name: "cp", Usage: "copy files between host and Subutai containers",
+		Flags: []gcli.Flag{
+			gcli.BoolFlag{Name: "recursive, r", Usage: "copy directories recursively"}},
+		Action: func(c *gcli.Context) error {
+			if c.Args().Get(0) != "" && c.Args().Get(1) != "" {
+				cli.LxcCp(c.Args().Get(0), c.Args().Get(1), c.Bool("r"))
 			} else {
 				gcli.ShowSubcommandHelp(c)
 			}
@@ -176,9 +230,14 @@ func main() {
 		Name: "destroy", Usage: "destroy Subutai container",
 		Flags: []gcli.Flag{
 			gcli.BoolFlag{Name: "vlan, v", Usage: "destroy environment by passed vlan"},
+			gcli.StringFlag{Name: "selector", Usage: "destroy containers with matching key=value labels"},
 		},
 		Action: func(c *gcli.Context) error {
-			if c.Args().Get(0) != "" {
+			if c.String("selector") != "" {
+				cli.ForSelected(c.String("selector"), "destroy", func(name string) {
+					cli.LxcDestroy(name, false)
+				})
+			} else if c.Args().Get(0) != "" {
 				cli.LxcDestroy(c.Args().Get(0), c.Bool("v"))
 			} else {
 				gcli.ShowSubcommandHelp(c)
@@ -186,6 +245,116 @@ func main() {
 			return nil
 		}}, {
 
+		Name: "diff", Usage: "show files changed in Subutai container since it was cloned from the template",
+		Flags: []gcli.Flag{
+			gcli.BoolFlag{Name: "json", Usage: "print changes in json format"}},
+		Action: func(c *gcli.Context) error {
+			if c.Args().Get(0) != "" {
+				cli.LxcDiff(c.Args().Get(0), c.Args().Tail(), c.Bool("json"))
+			} else {
+				gcli.ShowSubcommandHelp(c)
+			}
+			return nil
+		}}, {
+
+		Name: "env", Usage: "manage Subutai environment containers",
+		Subcommands: []gcli.Command{
+			{
+				Name:  "list",
+				Usage: "list environment containers",
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" {
+						cli.EnvList(c.Args().Get(0))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}}, {
+				Name:  "status",
+				Usage: "show state and health of environment containers",
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" {
+						cli.EnvStatus(c.Args().Get(0))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}}, {
+				Name:  "start",
+				Usage: "start environment containers",
+				Flags: []gcli.Flag{
+					gcli.IntFlag{Name: "parallel, p", Value: 4, Usage: "number of containers processed simultaneously"}},
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" {
+						cli.EnvStart(c.Args().Get(0), c.Int("p"))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}}, {
+				Name:  "stop",
+				Usage: "stop environment containers",
+				Flags: []gcli.Flag{
+					gcli.IntFlag{Name: "parallel, p", Value: 4, Usage: "number of containers processed simultaneously"}},
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" {
+						cli.EnvStop(c.Args().Get(0), c.Int("p"))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}}, {
+				Name:  "restart",
+				Usage: "restart environment containers",
+				Flags: []gcli.Flag{
+					gcli.IntFlag{Name: "parallel, p", Value: 4, Usage: "number of containers processed simultaneously"}},
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" {
+						cli.EnvRestart(c.Args().Get(0), c.Int("p"))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}}, {
+				Name:  "destroy",
+				Usage: "destroy environment containers",
+				Flags: []gcli.Flag{
+					gcli.IntFlag{Name: "parallel, p", Value: 4, Usage: "number of containers processed simultaneously"}},
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" {
+						cli.EnvDestroy(c.Args().Get(0), c.Int("p"))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}},
+		}}, {
+
+		Name: "events", Usage: "show lifecycle and resource events of Subutai containers",
+		Flags: []gcli.Flag{
+			gcli.BoolFlag{Name: "follow, f", Usage: "keep printing new events"}},
+		Action: func(c *gcli.Context) error {
+			cli.Events(c.Args().Get(0), c.Bool("f"))
+			return nil
+		}}, {
+
+		Name: "exec", Usage: "execute command inside Subutai container",
+		Flags: []gcli.Flag{
+			gcli.StringFlag{Name: "user, u", Usage: "run command as container user"},
+			gcli.StringFlag{Name: "cwd, w", Usage: "working directory inside container"},
+			gcli.StringSliceFlag{Name: "env, e", Usage: "set KEY=VALUE environment variable"},
+			gcli.IntFlag{Name: "timeout, t", Usage: "command timeout in seconds"},
+			gcli.BoolFlag{Name: "stdin, i", Usage: "connect standard input to command"},
+			gcli.BoolFlag{Name: "tty", Usage: "allocate pseudo-terminal for command"}},
+		Action: func(c *gcli.Context) error {
+			if c.Args().Get(0) != "" {
+				cli.LxcExec(c.Args().Get(0), c.Args().Tail(), c.String("u"), c.String("w"), c.StringSlice("e"), c.Int("t"), c.Bool("i"), c.Bool("tty"))
+			} else {
+				gcli.ShowSubcommandHelp(c)
+			}
+			return nil
+		}}, {
+
 		Name: "export", Usage: "export Subutai container",
 		Flags: []gcli.Flag{
 			gcli.StringFlag{Name: "version, v", Usage: "template version"},
@@ -223,6 +392,23 @@ func main() {
 			return nil
 		}}, {
 
+		Name: "health", Usage: "health check of Subutai container",
+		Flags: []gcli.Flag{
+			gcli.StringFlag{Name: "type, t", Usage: "health check type (exec|tcp|http|none)"},
+			gcli.StringFlag{Name: "check, c", Usage: "command, port or port/path to check"},
+			gcli.IntFlag{Name: "interval, i", Usage: "check interval in seconds"},
+			gcli.IntFlag{Name: "timeout", Usage: "check timeout in seconds"},
+			gcli.IntFlag{Name: "retries, r", Usage: "failed checks before container is unhealthy"},
+			gcli.StringFlag{Name: "restart", Usage: "restart policy (no|unhealthy)"}},
+		Action: func(c *gcli.Context) error {
+			if c.Args().Get(0) != "" {
+				cli.LxcHealth(c.Args().Get(0), c.String("t"), c.String("c"), c.String("restart"), c.Int("i"), c.Int("timeout"), c.Int("r"))
+			} else {
+				gcli.ShowSubcommandHelp(c)
+			}
+			return nil
+		}}, {
+
 		Name: "hostname", Usage: "Set hostname of container or host",
 		Action: func(c *gcli.Context) error {
 			if c.Args().Get(0) == "" {
@@ -235,15 +421,28 @@ func main() {
 			return nil
 		}}, {
 
+		Name: "label", Usage: "manage Subutai container labels",
+		Flags: []gcli.Flag{
+			gcli.BoolFlag{Name: "remove, r", Usage: "remove labels by key"}},
+		Action: func(c *gcli.Context) error {
+			if c.Args().Get(0) != "" {
+				cli.LxcLabel(c.Args().Get(0), c.Args().Tail(), c.Bool("r"))
+			} else {
+				gcli.ShowSubcommandHelp(c)
+			}
+			return nil
+		}}, {
+
 		Name: "list", Usage: "list Subutai container",
 		Flags: []gcli.Flag{
 			gcli.BoolFlag{Name: "container, c", Usage: "containers only"},
 			gcli.BoolFlag{Name: "template, t", Usage: "templates only"},
 			gcli.BoolFlag{Name: "info, i", Usage: "detailed container info"},
 			gcli.BoolFlag{Name: "ancestor, a", Usage: "with ancestors"},
-			gcli.BoolFlag{Name: "parent, p", Usage: "with parent"}},
+			gcli.BoolFlag{Name: "parent, p", Usage: "with parent"},
+			gcli.StringFlag{Name: "selector", Usage: "list containers with matching key=value labels"}},
 		Action: func(c *gcli.Context) error {
-			cli.LxcList(c.Args().Get(0), c.Bool("c"), c.Bool("t"), c.Bool("i"), c.Bool("a"), c.Bool("p"))
+			cli.LxcList(c.Args().Get(0), c.Bool("c"), c.Bool("t"), c.Bool("i"), c.Bool("a"), c.Bool("p"), c.String("selector"))
 			return nil
 		}}, {
 
@@ -303,6 +502,44 @@ func main() {
 			return nil
 		}}, {
 
+		Name: "mount", Usage: "bind mount host directories into Subutai containers",
+		Subcommands: []gcli.Command{
+			{
+				Name:  "add",
+				Usage: "mount host path into container: add <container> <hostpath> <containerpath>",
+				Flags: []gcli.Flag{
+					gcli.BoolFlag{Name: "ro", Usage: "mount read-only"},
+					gcli.BoolFlag{Name: "shift", Usage: "shift ownership of host files into container user namespace"}},
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" && c.Args().Get(1) != "" && c.Args().Get(2) != "" {
+						cli.MountAdd(c.Args().Get(0), c.Args().Get(1), c.Args().Get(2), c.Bool("ro"), c.Bool("shift"))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}}, {
+				Name:  "del",
+				Usage: "remove mount: del <container> <containerpath>",
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" && c.Args().Get(1) != "" {
+						cli.MountDel(c.Args().Get(0), c.Args().Get(1))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}}, {
+				Name:  "list",
+				Usage: "list mounts of container",
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" {
+						cli.MountList(c.Args().Get(0))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}},
+		}}, {
+
 		Name: "p2p", Usage: "P2P network operations",
 		Flags: []gcli.Flag{
 			gcli.BoolFlag{Name: "create, c", Usage: "create p2p instance (interfaceName hash key ttl localPeepIPAddr portRange)"},
@@ -319,7 +556,7 @@ func main() {
 			case c.Bool("v"):
 				cli.P2Pversion()
 			default:
-				cli.P2P(c.Bool("c"), c.Bool("d"), c.Bool("u"), c.Bool("l"), c.Bool("p"), os.Args)
+				cli.P2P(c.Bool("c"), c.Bool("d"), c.Bool("u"), c.Bool("l"), c.Bool("p"), c.Args())
 			}
 			return nil
 		}}, {
@@ -335,6 +572,40 @@ func main() {
 			return nil
 		}}, {
 
+		Name: "profile", Usage: "Subutai quota profiles",
+		Subcommands: []gcli.Command{
+			{
+				Name:  "list",
+				Usage: "list quota profiles",
+				Action: func(c *gcli.Context) error {
+					cli.ProfileList()
+					return nil
+				}}, {
+				Name:  "set",
+				Usage: "save quota profile",
+				Flags: []gcli.Flag{
+					gcli.StringSliceFlag{Name: "quota, q", Usage: "resource=value quota (cpu, cpuset, ram, disk, network, io, pids, rootfs, home, var, opt)"},
+					gcli.StringSliceFlag{Name: "threshold, t", Usage: "resource=percent alert threshold (cpu, ram, io, pids, rootfs, home, var, opt)"}},
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" {
+						cli.ProfileSet(c.Args().Get(0), c.StringSlice("q"), c.StringSlice("t"))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}}, {
+				Name:  "del",
+				Usage: "remove quota profile",
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" {
+						cli.ProfileDel(c.Args().Get(0))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}},
+		}}, {
+
 		Name: "proxy", Usage: "Subutai reverse proxy",
 		Subcommands: []gcli.Command{
 			{
@@ -379,13 +650,57 @@ func main() {
 
 		Name: "quota", Usage: "set quotas for Subutai container",
 		Flags: []gcli.Flag{
-			gcli.StringFlag{Name: "set, s", Usage: "set quota for the specified resource type (cpu, cpuset, ram, disk, network)"},
-			gcli.StringFlag{Name: "threshold, t", Usage: "set alert threshold"}},
+			gcli.StringFlag{Name: "set, s", Usage: "set quota for the specified resource type (cpu, cpuset, ram, disk, network, io, pids)"},
+			gcli.StringFlag{Name: "threshold, t", Usage: "set alert threshold"},
+			gcli.StringFlag{Name: "selector", Usage: "apply to containers with matching key=value labels"}},
 		Action: func(c *gcli.Context) error {
+			if c.String("selector") != "" {
+				cli.ForSelected(c.String("selector"), "quota", func(name string) {
+					cli.LxcQuota(name, c.Args().Get(0), c.String("s"), c.String("t"))
+				})
+				return nil
+			}
 			cli.LxcQuota(c.Args().Get(0), c.Args().Get(1), c.String("s"), c.String("t"))
 			return nil
 		}}, {
 
+		Name: "registry", Usage: "manage local template registry serving cached templates to other agents",
+		Subcommands: []gcli.Command{
+			{
+				Name:  "list",
+				Usage: "list templates cached in registry",
+				Action: func(c *gcli.Context) error {
+					cli.RegistryList()
+					return nil
+				}}, {
+				Name:  "sync",
+				Usage: "mirror templates from CDN: sync [template...], all cached templates are refreshed if none passed",
+				Action: func(c *gcli.Context) error {
+					cli.RegistrySync(c.Args())
+					return nil
+				}}, {
+				Name:  "rm",
+				Usage: "remove template from registry: rm <name[@owner[:version]]|id:ID>",
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" {
+						cli.RegistryRemove(c.Args().Get(0))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}},
+		}}, {
+
+		Name: "resize", Usage: "apply quota profile to Subutai container",
+		Action: func(c *gcli.Context) error {
+			if c.Args().Get(0) != "" && c.Args().Get(1) != "" {
+				cli.LxcResize(c.Args().Get(0), c.Args().Get(1))
+			} else {
+				gcli.ShowSubcommandHelp(c)
+			}
+			return nil
+		}}, {
+
 		Name: "restore", Usage: "restore Subutai container",
 		Flags: []gcli.Flag{
 			gcli.StringFlag{Name: "date, d", Usage: "date of backup snapshot"},
@@ -399,15 +714,86 @@ func main() {
 			return nil
 		}}, {
 
+		Name: "security", Usage: "manage AppArmor, seccomp and capabilities of Subutai containers",
+		Subcommands: []gcli.Command{
+			{
+				Name:  "set",
+				Usage: "set confinement of container or template",
+				Flags: []gcli.Flag{
+					gcli.StringFlag{Name: "profile, p", Usage: "built-in profile: default, strict or nesting"},
+					gcli.StringFlag{Name: "apparmor", Usage: "AppArmor profile"},
+					gcli.StringFlag{Name: "seccomp", Usage: "seccomp policy: built-in profile name or policy file path"},
+					gcli.StringFlag{Name: "caps-drop", Usage: "comma separated capabilities to drop, \"none\" for LXC defaults"}},
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" {
+						cli.SecuritySet(c.Args().Get(0), c.String("p"), c.String("apparmor"), c.String("seccomp"), c.String("caps-drop"))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}},
+		}}, {
+
 		Name: "stats", Usage: "statistics from host",
 		Action: func(c *gcli.Context) error {
 			cli.Info(c.Args().Get(0), c.Args().Get(1))
 			return nil
 		}}, {
 
+		Name: "snapshot", Usage: "Subutai container snapshots",
+		Subcommands: []gcli.Command{
+			{
+				Name:  "create",
+				Usage: "create container snapshot",
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" && c.Args().Get(1) != "" {
+						cli.SnapshotCreate(c.Args().Get(0), c.Args().Get(1))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}}, {
+				Name:  "list",
+				Usage: "list container snapshots",
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" {
+						cli.SnapshotList(c.Args().Get(0))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}}, {
+				Name:  "rollback",
+				Usage: "rollback container to snapshot",
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" && c.Args().Get(1) != "" {
+						cli.SnapshotRollback(c.Args().Get(0), c.Args().Get(1))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}}, {
+				Name:  "delete",
+				Usage: "delete container snapshot",
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" && c.Args().Get(1) != "" {
+						cli.SnapshotDelete(c.Args().Get(0), c.Args().Get(1))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}},
+		}}, {
+
 		Name: "start", Usage: "start Subutai container",
+		Flags: []gcli.Flag{
+			gcli.StringFlag{Name: "selector", Usage: "start containers with matching key=value labels"}},
 		Action: func(c *gcli.Context) error {
-			if c.Args().Get(0) != "" {
+			if c.String("selector") != "" {
+				cli.ForSelected(c.String("selector"), "start", func(name string) {
+					cli.LxcStart(name)
+				})
+			} else if c.Args().Get(0) != "" {
 				cli.LxcStart(c.Args().Get(0))
 			} else {
 				gcli.ShowSubcommandHelp(c)
@@ -416,8 +802,14 @@ func main() {
 		}}, {
 
 		Name: "stop", Usage: "stop Subutai container",
+		Flags: []gcli.Flag{
+			gcli.StringFlag{Name: "selector", Usage: "stop containers with matching key=value labels"}},
 		Action: func(c *gcli.Context) error {
-			if c.Args().Get(0) != "" {
+			if c.String("selector") != "" {
+				cli.ForSelected(c.String("selector"), "stop", func(name string) {
+					cli.LxcStop(name)
+				})
+			} else if c.Args().Get(0) != "" {
 				cli.LxcStop(c.Args().Get(0))
 			} else {
 				gcli.ShowSubcommandHelp(c)
@@ -425,6 +817,65 @@ func main() {
 			return nil
 		}}, {
 
+		Name: "top", Usage: "show resource usage of Subutai containers",
+		Flags: []gcli.Flag{
+			gcli.StringFlag{Name: "sort, s", Value: "cpu", Usage: "sort by name, cpu, ram, disk, net, pids or saturation"},
+			gcli.StringFlag{Name: "vlan, v", Usage: "show containers of vlan"},
+			gcli.StringFlag{Name: "env, e", Usage: "show containers of environment"},
+			gcli.IntFlag{Name: "interval, n", Value: 2, Usage: "refresh interval in seconds"},
+			gcli.BoolFlag{Name: "once", Usage: "print usage once and exit"},
+			gcli.BoolFlag{Name: "json", Usage: "print usage in json format"}},
+		Action: func(c *gcli.Context) error {
+			cli.Top(c.String("s"), c.String("v"), c.String("e"), c.Int("n"), c.Bool("once"), c.Bool("json"))
+			return nil
+		}}, {
+
+		Name: "trust", Usage: "manage template owner keys used to verify template signatures",
+		Subcommands: []gcli.Command{
+			{
+				Name:  "add",
+				Usage: "add owner key: add <owner> [keyfile|-], keys are fetched from CDN if no file passed",
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" {
+						cli.TrustAdd(c.Args().Get(0), c.Args().Get(1))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}}, {
+				Name:  "list",
+				Usage: "list trusted owner keys",
+				Action: func(c *gcli.Context) error {
+					cli.TrustList()
+					return nil
+				}}, {
+				Name:  "rm",
+				Usage: "remove owner keys: rm <owner> [fingerprint]",
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" {
+						cli.TrustRemove(c.Args().Get(0), c.Args().Get(1))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}},
+		}}, {
+
+		Name: "ttl", Usage: "manage lifetime of Subutai containers",
+		Subcommands: []gcli.Command{
+			{
+				Name:  "extend",
+				Usage: "prolong container lifetime",
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" && c.Args().Get(1) != "" {
+						cli.TTLExtend(c.Args().Get(0), c.Args().Get(1))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}},
+		}}, {
+
 		Name: "tunnel", Usage: "SSH tunnel management",
 		Subcommands: []gcli.Command{
 			{
@@ -468,6 +919,61 @@ func main() {
 			return nil
 		}}, {
 
+		Name: "volume", Usage: "manage named volumes of Subutai containers",
+		Subcommands: []gcli.Command{
+			{
+				Name:  "create",
+				Usage: "create named volume",
+				Flags: []gcli.Flag{
+					gcli.StringFlag{Name: "size, s", Usage: "volume quota in Gb"}},
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" {
+						cli.VolumeCreate(c.Args().Get(0), c.String("s"))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}}, {
+				Name:  "list",
+				Usage: "list named volumes",
+				Action: func(c *gcli.Context) error {
+					cli.VolumeList()
+					return nil
+				}}, {
+				Name:  "attach",
+				Usage: "mount volume into container: attach <volume> <container> <path>",
+				Flags: []gcli.Flag{
+					gcli.BoolFlag{Name: "readonly, r", Usage: "mount volume read-only"}},
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" && c.Args().Get(1) != "" && c.Args().Get(2) != "" {
+						cli.VolumeAttach(c.Args().Get(0), c.Args().Get(1), c.Args().Get(2), c.Bool("r"))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}}, {
+				Name:  "detach",
+				Usage: "unmount volume from container: detach <volume> <container>",
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" && c.Args().Get(1) != "" {
+						cli.VolumeDetach(c.Args().Get(0), c.Args().Get(1))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}}, {
+				Name:  "rm",
+				Usage: "remove volume and its data",
+				Action: func(c *gcli.Context) error {
+					if c.Args().Get(0) != "" {
+						cli.VolumeRemove(c.Args().Get(0))
+					} else {
+						gcli.ShowSubcommandHelp(c)
+					}
+					return nil
+				}},
+		}}, {
+
 		Name: "vxlan", Usage: "VXLAN tunnels operation",
 		Flags: []gcli.Flag{
 			gcli.StringFlag{Name: "create, c", Usage: "create vxlan tunnel"},
@@ -486,3 +992,20 @@ func main() {
 
 	app.Run(os.Args)
 }
+
+// tailFlags parses flags placed after the first argument of the command with subcommands, since gcli doesn't reorder arguments of such commands.
+// Values of the listed flags parsed before the argument are kept.
+func tailFlags(c *gcli.Context, names ...string) *gcli.Context {
+	if c.NArg() < 2 {
+		return c
+	}
+	set := flag.NewFlagSet(c.App.Name, flag.ExitOnError)
+	for _, f := range c.App.Flags {
+		f.Apply(set)
+	}
+	for _, name := range names {
+		set.Set(name, c.String(name))
+	}
+	set.Parse(c.Args().Tail())
+	return gcli.NewContext(c.App, set, c)
+}